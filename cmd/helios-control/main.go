@@ -10,6 +10,7 @@ import (
 
 	"github.com/xizzxy/helios/internal/config"
 	"github.com/xizzxy/helios/internal/control"
+	"github.com/xizzxy/helios/internal/tracing"
 )
 
 func main() {
@@ -24,6 +25,13 @@ func main() {
 		"grpc_address", cfg.Control.GRPCAddress,
 	)
 
+	// Tracing (propagators are installed even when export is disabled)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Observability, "helios-control")
+	if err != nil {
+		logger.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
 	// Create control plane server
 	server, err := control.NewServer(cfg, logger)
 	if err != nil {
@@ -55,6 +63,9 @@ func main() {
 		logger.Error("Control server shutdown error", "error", err)
 		os.Exit(1)
 	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Failed to flush traces", "error", err)
+	}
 
 	logger.Info("Control plane shutdown complete")
 }
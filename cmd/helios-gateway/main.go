@@ -8,6 +8,7 @@ import (
 	"syscall"
 	"github.com/xizzxy/helios/internal/config"
 	"github.com/xizzxy/helios/internal/gateway"
+	"github.com/xizzxy/helios/internal/tracing"
 )
 
 func main() {
@@ -23,6 +24,13 @@ func main() {
 		"grpc_address", cfg.Gateway.GRPCAddress,
 	)
 
+	// Tracing (propagators are installed even when export is disabled)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Observability, "helios-gateway")
+	if err != nil {
+		logger.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
 	// Create server
 	server, err := gateway.NewServer(cfg, logger)
 	if err != nil {
@@ -54,6 +62,9 @@ func main() {
 		logger.Error("Server shutdown error", "error", err)
 		os.Exit(1)
 	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Failed to flush traces", "error", err)
+	}
 
 	logger.Info("Gateway shutdown complete")
 }
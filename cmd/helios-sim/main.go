@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/xizzxy/helios/internal/sim"
+)
+
+// policyFlags collects repeated -policy flags.
+type policyFlags []string
+
+func (p *policyFlags) String() string     { return strings.Join(*p, " ") }
+func (p *policyFlags) Set(v string) error { *p = append(*p, v); return nil }
+
+func main() {
+	var (
+		policies policyFlags
+		trace    = flag.String("trace", "", "request trace to replay (.csv or .jsonl)")
+		format   = flag.String("format", "", "trace format: csv or jsonl (default: from the file extension)")
+		tenant   = flag.String("tenant", "", "only replay requests from this tenant")
+		retry    = flag.Bool("retry", true, "denied clients retry at the reported reset time")
+		maxWait  = flag.Duration("max-wait", time.Minute, "how long a client keeps retrying before giving up")
+		output   = flag.String("output", "text", "report format: text or json")
+		byTenant = flag.Bool("by-tenant", false, "break text reports down per tenant")
+	)
+	flag.Var(&policies, "policy", `policy to evaluate, repeatable: "algorithm[,limit=N][,burst=N][,window=D][,name=S]"`)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: helios-sim -trace FILE [-policy SPEC]...\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Replays a request trace through each policy on a virtual clock.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *trace == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if len(policies) == 0 {
+		policies = policyFlags{"token_bucket", "sliding_window"}
+	}
+
+	parsed := make([]sim.Policy, 0, len(policies))
+	for _, spec := range policies {
+		p, err := sim.ParsePolicy(spec)
+		if err != nil {
+			fatal(err)
+		}
+		parsed = append(parsed, p)
+	}
+
+	reqs, err := loadTrace(*trace, *format)
+	if err != nil {
+		fatal(err)
+	}
+	if *tenant != "" {
+		filtered := reqs[:0]
+		for _, r := range reqs {
+			if r.Tenant == *tenant {
+				filtered = append(filtered, r)
+			}
+		}
+		reqs = filtered
+	}
+
+	opts := sim.Options{Retry: *retry, MaxWait: *maxWait}
+	reports := make([]*sim.Report, 0, len(parsed))
+	for _, p := range parsed {
+		start := time.Now()
+		report, err := sim.Run(context.Background(), reqs, p, opts)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "replayed %d requests through %s in %v\n", len(reqs), p.Name, time.Since(start).Round(time.Millisecond))
+		reports = append(reports, report)
+	}
+
+	switch *output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			fatal(err)
+		}
+	case "text":
+		printText(reports, *byTenant)
+	default:
+		fatal(fmt.Errorf("unknown output %q (want text or json)", *output))
+	}
+}
+
+func loadTrace(path, format string) ([]sim.Request, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return sim.ReadTrace(f, format)
+}
+
+func printText(reports []*sim.Report, byTenant bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POLICY\tREQUESTS\tALLOWED\tDENIED\tDENIED%\tBURSTS\tMAX BURST\tLONGEST BURST\tRETRIES\tDROPPED\tP50\tP90\tP99\tMAX")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.2f\t%d\t%d\t%v\t%d\t%d\t%v\t%v\t%v\t%v\n",
+			r.Policy, r.Requests, r.Allowed, r.Denied, 100*r.DenialRate(),
+			r.Bursts, r.MaxBurst, r.LongestBurst, r.Retries, r.Dropped,
+			r.AdmissionP50, r.AdmissionP90, r.AdmissionP99, r.AdmissionMax)
+	}
+	w.Flush()
+
+	if !byTenant {
+		return
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POLICY\tTENANT\tREQUESTS\tALLOWED\tDENIED\tDENIED%")
+	for _, r := range reports {
+		tenants := make([]string, 0, len(r.Tenants))
+		for t := range r.Tenants {
+			tenants = append(tenants, t)
+		}
+		sort.Strings(tenants)
+		for _, t := range tenants {
+			c := r.Tenants[t]
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%.2f\n",
+				r.Policy, t, c.Requests, c.Allowed, c.Denied, 100*float64(c.Denied)/float64(c.Requests))
+		}
+	}
+	w.Flush()
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "helios-sim:", err)
+	os.Exit(1)
+}
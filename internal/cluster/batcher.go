@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xizzxy/helios/internal/limiter"
+)
+
+// batcher coalesces calls bound for one peer into AllowBatch RPCs. A batch
+// is sent when it reaches maxBatch items or maxDelay after its first item.
+type batcher struct {
+	client   PeerServer
+	maxBatch int
+	maxDelay time.Duration
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	pending []*pendingCall
+	timer   *time.Timer
+}
+
+type pendingCall struct {
+	item AllowItem
+	done chan callResult
+}
+
+type callResult struct {
+	res *limiter.Result
+	err error
+}
+
+func newBatcher(client PeerServer, maxBatch int, maxDelay, timeout time.Duration) *batcher {
+	return &batcher{
+		client:   client,
+		maxBatch: maxBatch,
+		maxDelay: maxDelay,
+		timeout:  timeout,
+	}
+}
+
+// Do queues item and waits for its result or ctx.
+func (b *batcher) Do(ctx context.Context, item AllowItem) (*limiter.Result, error) {
+	call := &pendingCall{item: item, done: make(chan callResult, 1)}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, call)
+	if len(b.pending) >= b.maxBatch {
+		b.flushLocked()
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(b.maxDelay, b.flush)
+	}
+	b.mu.Unlock()
+
+	select {
+	case r := <-call.done:
+		return r.res, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *batcher) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+}
+
+func (b *batcher) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return
+	}
+	batch := b.pending
+	b.pending = nil
+	go b.send(batch)
+}
+
+func (b *batcher) send(batch []*pendingCall) {
+	req := &AllowBatchRequest{Items: make([]AllowItem, len(batch))}
+	for i, call := range batch {
+		req.Items[i] = call.item
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	resp, err := b.client.AllowBatch(ctx, req)
+	for i, call := range batch {
+		switch {
+		case err != nil:
+			call.done <- callResult{err: err}
+		case resp.Results[i].Error != "":
+			call.done <- callResult{err: errors.New(resp.Results[i].Error)}
+		case resp.Results[i].Result == nil:
+			call.done <- callResult{err: errors.New("peer returned an empty result")}
+		default:
+			call.done <- callResult{res: resp.Results[i].Result}
+		}
+	}
+}
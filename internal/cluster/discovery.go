@@ -0,0 +1,114 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Discovery reports the peer addresses that make up the cluster. Each
+// membership change, including the initial one, is sent on the returned
+// channel until ctx is done.
+type Discovery interface {
+	Watch(ctx context.Context) (<-chan []string, error)
+}
+
+// StaticDiscovery serves a fixed peer list. Its channel is closed after
+// the one update since membership never changes.
+type StaticDiscovery struct {
+	Peers []string
+}
+
+func (d StaticDiscovery) Watch(ctx context.Context) (<-chan []string, error) {
+	ch := make(chan []string, 1)
+	ch <- append([]string(nil), d.Peers...)
+	close(ch)
+	return ch, nil
+}
+
+const registryPrefix = "/helios/gateways/"
+
+// EtcdDiscovery registers self under /helios/gateways/ with a leased key and
+// watches the prefix for other gateways.
+type EtcdDiscovery struct {
+	Client *clientv3.Client
+	Self   string
+	TTL    int64 // lease TTL in seconds
+}
+
+func (d EtcdDiscovery) Watch(ctx context.Context) (<-chan []string, error) {
+	ttl := d.TTL
+	if ttl <= 0 {
+		ttl = 10
+	}
+
+	lease, err := d.Client.Grant(ctx, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("grant registration lease: %w", err)
+	}
+	if _, err := d.Client.Put(ctx, registryPrefix+d.Self, d.Self, clientv3.WithLease(lease.ID)); err != nil {
+		return nil, fmt.Errorf("register gateway: %w", err)
+	}
+	keepAlive, err := d.Client.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		return nil, fmt.Errorf("keep registration alive: %w", err)
+	}
+
+	resp, err := d.Client.Get(ctx, registryPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("list gateways: %w", err)
+	}
+	members := make(map[string]struct{}, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		members[string(kv.Value)] = struct{}{}
+	}
+
+	ch := make(chan []string, 1)
+	ch <- sortedMembers(members)
+
+	watch := d.Client.Watch(ctx, registryPrefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-keepAlive:
+				if !ok {
+					keepAlive = nil
+				}
+			case wr, ok := <-watch:
+				if !ok {
+					return
+				}
+				for _, ev := range wr.Events {
+					addr := strings.TrimPrefix(string(ev.Kv.Key), registryPrefix)
+					if ev.Type == clientv3.EventTypeDelete {
+						delete(members, addr)
+					} else {
+						members[addr] = struct{}{}
+					}
+				}
+				select {
+				case ch <- sortedMembers(members):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func sortedMembers(set map[string]struct{}) []string {
+	out := make([]string, 0, len(set))
+	for m := range set {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,332 @@
+package cluster
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GossipOptions configure a Gossiper.
+type GossipOptions struct {
+	// Self identifies this gateway; it must match its discovered address.
+	Self     string
+	Interval time.Duration // time between gossip rounds
+	Fanout   int           // peers contacted per round
+	KeyTTL   time.Duration // keys untouched for this long are forgotten
+	// MaxKeys bounds the keys learned from peers and the keys sent or
+	// merged per push.
+	MaxKeys int
+	Auth    PeerAuth
+}
+
+// Gossiper shares per-key consumption between FAST mode gateways without
+// ever blocking a request on the network. Every key holds a G-counter: one
+// monotonic count per gateway, merged by taking the maximum, so replicas
+// converge regardless of message order or duplication. Gossiper implements
+// limiter.ClusterUsage.
+type Gossiper struct {
+	opts GossipOptions
+
+	mu       sync.Mutex
+	counters map[string]*gcounter
+	peers    []string
+	members  map[string]bool // discovered peers, whose counts are accepted
+	conns    map[string]*grpc.ClientConn
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type gcounter struct {
+	counts  map[string]int64 // gateway -> total consumed
+	updated time.Time
+}
+
+// GossipState is the payload pushed to peers: key -> gateway -> count.
+type GossipState struct {
+	From     string                      `json:"from"`
+	Counters map[string]map[string]int64 `json:"counters"`
+}
+
+type GossipAck struct{}
+
+func NewGossiper(opts GossipOptions) *Gossiper {
+	if opts.Interval <= 0 {
+		opts.Interval = 100 * time.Millisecond
+	}
+	if opts.Fanout <= 0 {
+		opts.Fanout = 3
+	}
+	if opts.KeyTTL <= 0 {
+		opts.KeyTTL = 10 * time.Minute
+	}
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = 100000
+	}
+
+	return &Gossiper{
+		opts:     opts,
+		counters: make(map[string]*gcounter),
+		members:  make(map[string]bool),
+		conns:    make(map[string]*grpc.ClientConn),
+	}
+}
+
+// Add records cost consumed by this gateway for key.
+func (g *Gossiper) Add(key string, cost int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c := g.counter(key)
+	c.counts[g.opts.Self] += cost
+	c.updated = time.Now()
+}
+
+// Remote returns the total cost other gateways have consumed for key.
+// The value only grows, except after the key has expired.
+func (g *Gossiper) Remote(key string) int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c, ok := g.counters[key]
+	if !ok {
+		return 0
+	}
+	var total int64
+	for node, n := range c.counts {
+		if node != g.opts.Self {
+			total += n
+		}
+	}
+	return total
+}
+
+// Merge folds the state pushed by peer from into ours. Only discovered
+// members are heard, and only their counts are kept: our own count is
+// never taken from a peer. At most MaxKeys keys are merged, and keys we
+// don't know yet are only added while fewer than MaxKeys are tracked. It
+// reports false, merging nothing, when from is not a member.
+func (g *Gossiper) Merge(from string, state map[string]map[string]int64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.members[from] {
+		return false
+	}
+	now := time.Now()
+	merged := 0
+	for key, counts := range state {
+		if merged == g.opts.MaxKeys {
+			break
+		}
+		merged++
+		c, ok := g.counters[key]
+		if !ok {
+			if len(g.counters) >= g.opts.MaxKeys {
+				continue
+			}
+			c = &gcounter{counts: make(map[string]int64)}
+		}
+		for node, n := range counts {
+			if g.members[node] && n > c.counts[node] {
+				c.counts[node] = n
+				c.updated = now
+			}
+		}
+		if !ok && len(c.counts) > 0 {
+			g.counters[key] = c
+		}
+	}
+	return true
+}
+
+// Register exposes the gossip endpoint on s, which should be the
+// gateway's internal server from GossipOptions.Auth.NewServer.
+func (g *Gossiper) Register(s *grpc.Server) {
+	s.RegisterService(&gossipServiceDesc, g)
+}
+
+// Start follows membership from d and gossips until Close is called.
+func (g *Gossiper) Start(ctx context.Context, d Discovery) error {
+	ctx, cancel := context.WithCancel(ctx)
+	updates, err := d.Watch(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	g.cancel = cancel
+	g.done = make(chan struct{})
+	go func() {
+		defer close(g.done)
+		ticker := time.NewTicker(g.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case members, ok := <-updates:
+				if !ok {
+					updates = nil
+					continue
+				}
+				g.setPeers(members)
+			case <-ticker.C:
+				g.round(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+func (g *Gossiper) Close() error {
+	if g.cancel != nil {
+		g.cancel()
+		<-g.done
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for addr, conn := range g.conns {
+		conn.Close()
+		delete(g.conns, addr)
+	}
+	return nil
+}
+
+func (g *Gossiper) counter(key string) *gcounter {
+	c, ok := g.counters[key]
+	if !ok {
+		c = &gcounter{counts: make(map[string]int64)}
+		g.counters[key] = c
+	}
+	return c
+}
+
+func (g *Gossiper) setPeers(members []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.peers = g.peers[:0]
+	live := make(map[string]bool, len(members))
+	for _, m := range members {
+		if m != g.opts.Self {
+			g.peers = append(g.peers, m)
+			live[m] = true
+		}
+	}
+	g.members = live
+	for addr, conn := range g.conns {
+		if !live[addr] {
+			conn.Close()
+			delete(g.conns, addr)
+		}
+	}
+}
+
+// round expires idle keys and pushes the state to Fanout random peers. Past
+// MaxKeys keys, each round sends a different random subset.
+func (g *Gossiper) round(ctx context.Context) {
+	now := time.Now()
+
+	g.mu.Lock()
+	state := &GossipState{From: g.opts.Self, Counters: make(map[string]map[string]int64, len(g.counters))}
+	for key, c := range g.counters {
+		if now.Sub(c.updated) > g.opts.KeyTTL {
+			delete(g.counters, key)
+			continue
+		}
+		if len(state.Counters) == g.opts.MaxKeys {
+			continue
+		}
+		counts := make(map[string]int64, len(c.counts))
+		for node, n := range c.counts {
+			counts[node] = n
+		}
+		state.Counters[key] = counts
+	}
+
+	targets := append([]string(nil), g.peers...)
+	rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+	if len(targets) > g.opts.Fanout {
+		targets = targets[:g.opts.Fanout]
+	}
+	conns := make([]*grpc.ClientConn, 0, len(targets))
+	for _, addr := range targets {
+		conn, ok := g.conns[addr]
+		if !ok {
+			var err error
+			conn, err = g.opts.Auth.dial(addr)
+			if err != nil {
+				continue
+			}
+			g.conns[addr] = conn
+		}
+		conns = append(conns, conn)
+	}
+	g.mu.Unlock()
+
+	if len(state.Counters) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *grpc.ClientConn) {
+			defer wg.Done()
+			pushCtx, cancel := context.WithTimeout(ctx, g.opts.Interval)
+			defer cancel()
+			// Failed pushes are harmless: the next round resends everything.
+			_ = conn.Invoke(pushCtx, gossipPushMethod, state, new(GossipAck), grpc.CallContentSubtype(codecName))
+		}(conn)
+	}
+	wg.Wait()
+}
+
+// push is the gRPC handler for incoming gossip.
+func (g *Gossiper) push(ctx context.Context, state *GossipState) (*GossipAck, error) {
+	if !g.Merge(state.From, state.Counters) {
+		return nil, status.Errorf(codes.PermissionDenied, "%q is not a cluster member", state.From)
+	}
+	return &GossipAck{}, nil
+}
+
+type gossipServer interface {
+	push(ctx context.Context, state *GossipState) (*GossipAck, error)
+}
+
+const gossipPushMethod = "/helios.cluster.v1.Gossip/Push"
+
+var gossipServiceDesc = grpc.ServiceDesc{
+	ServiceName: "helios.cluster.v1.Gossip",
+	HandlerType: (*gossipServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Push",
+			Handler:    gossipPushHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/cluster/gossip.go",
+}
+
+func gossipPushHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(GossipState)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(gossipServer).push(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: gossipPushMethod,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(gossipServer).push(ctx, req.(*GossipState))
+	}
+	return interceptor(ctx, in, info, handler)
+}
@@ -0,0 +1,178 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/limiter"
+)
+
+// startGossipers runs n in-process gateways that gossip over loopback gRPC,
+// authenticated by a shared secret.
+func startGossipers(t *testing.T, n int) []*Gossiper {
+	t.Helper()
+
+	listeners := make([]net.Listener, n)
+	addrs := make([]string, n)
+	for i := range listeners {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		listeners[i] = lis
+		addrs[i] = lis.Addr().String()
+	}
+
+	gossipers := make([]*Gossiper, n)
+	for i := range gossipers {
+		auth := PeerAuth{Secret: "s3cret"}
+		g := NewGossiper(GossipOptions{
+			Self:     addrs[i],
+			Interval: 10 * time.Millisecond,
+			Fanout:   2,
+			Auth:     auth,
+		})
+		srv := auth.NewServer()
+		g.Register(srv)
+		go srv.Serve(listeners[i])
+		if err := g.Start(context.Background(), StaticDiscovery{Peers: addrs}); err != nil {
+			t.Fatalf("start gossiper: %v", err)
+		}
+		t.Cleanup(func() {
+			g.Close()
+			srv.Stop()
+		})
+		gossipers[i] = g
+	}
+	return gossipers
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGossipConverges(t *testing.T) {
+	gossipers := startGossipers(t, 4)
+
+	var total int64
+	for i, g := range gossipers {
+		cost := int64(i + 1)
+		g.Add("acme:api:key", cost)
+		total += cost
+	}
+
+	waitFor(t, 5*time.Second, func() bool {
+		for i, g := range gossipers {
+			if g.Remote("acme:api:key") != total-int64(i+1) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestGossipMergeIsIdempotent(t *testing.T) {
+	g := NewGossiper(GossipOptions{Self: "a"})
+	g.setPeers([]string{"a", "b", "c"})
+	state := map[string]map[string]int64{"k": {"b": 5, "c": 2}}
+
+	g.Merge("b", state)
+	g.Merge("b", state)
+	g.Merge("c", map[string]map[string]int64{"k": {"b": 3}})
+
+	if got := g.Remote("k"); got != 7 {
+		t.Fatalf("Remote = %d, want 7", got)
+	}
+}
+
+func TestGossipMergeOnlyHearsMembers(t *testing.T) {
+	g := NewGossiper(GossipOptions{Self: "a"})
+	g.setPeers([]string{"a", "b"})
+	g.Add("k", 1)
+
+	if g.Merge("x", map[string]map[string]int64{"k": {"x": 100}}) {
+		t.Error("merged a push from a node that was never discovered")
+	}
+	// A member may only report members' counts, and never ours.
+	if !g.Merge("b", map[string]map[string]int64{"k": {"a": 100, "b": 2, "x": 100}}) {
+		t.Fatal("rejected a push from a member")
+	}
+	if got := g.Remote("k"); got != 2 {
+		t.Errorf("Remote = %d, want only b's 2", got)
+	}
+	g.Add("k", 1)
+	if got := g.counters["k"].counts["a"]; got != 2 {
+		t.Errorf("own count = %d, want 2", got)
+	}
+
+	// Once b leaves, its pushes are refused.
+	g.setPeers([]string{"a"})
+	if g.Merge("b", map[string]map[string]int64{"k": {"b": 50}}) {
+		t.Error("merged a push from a node that left")
+	}
+}
+
+func TestGossipMergeCapsKeys(t *testing.T) {
+	g := NewGossiper(GossipOptions{Self: "a", MaxKeys: 10})
+	g.setPeers([]string{"a", "b"})
+
+	state := make(map[string]map[string]int64)
+	for i := 0; i < 100; i++ {
+		state[fmt.Sprintf("k%d", i)] = map[string]int64{"b": 1}
+	}
+	g.Merge("b", state)
+	g.Merge("b", state)
+	if len(g.counters) != 10 {
+		t.Errorf("tracking %d keys, want at most 10", len(g.counters))
+	}
+}
+
+func TestGossipBoundsClusterAdmissions(t *testing.T) {
+	gossipers := startGossipers(t, 3)
+
+	const limit = 60
+	limiters := make([]limiter.Limiter, len(gossipers))
+	for i, g := range gossipers {
+		limiters[i] = limiter.NewTokenBucketLimiter(limiter.Config{
+			Limit:   limit,
+			Burst:   limit,
+			Window:  time.Hour,
+			Cluster: g,
+		})
+	}
+
+	var admitted int
+	for round := 0; round < 20; round++ {
+		for _, l := range limiters {
+			for j := 0; j < 5; j++ {
+				res, err := l.Allow(context.Background(), "acme:api:key", 1)
+				if err != nil {
+					t.Fatalf("Allow: %v", err)
+				}
+				if res.Allowed {
+					admitted++
+				}
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+
+	// Without gossip every gateway would admit the full limit. With it the
+	// cluster may only overshoot by what is spent between rounds.
+	if admitted > limit+len(limiters)*5*2 {
+		t.Fatalf("cluster admitted %d requests, limit is %d", admitted, limit)
+	}
+	if admitted < limit {
+		t.Fatalf("cluster admitted %d requests, expected at least %d", admitted, limit)
+	}
+}
@@ -0,0 +1,221 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/xizzxy/helios/internal/limiter"
+	"github.com/xizzxy/helios/internal/tracing"
+)
+
+// Options configure a cluster Node.
+type Options struct {
+	// Self is the gRPC address other gateways use to reach this one. It
+	// must match how this node appears in the discovered peer list.
+	Self           string
+	VirtualNodes   int
+	BatchSize      int
+	BatchDelay     time.Duration
+	ForwardTimeout time.Duration
+	Auth           PeerAuth
+}
+
+// Node makes every rate-limit key the responsibility of exactly one gateway.
+// Keys this node owns are decided by its local limiters; the rest are
+// forwarded in batches to their owner. Node implements limiter.Manager.
+type Node struct {
+	opts  Options
+	local limiter.Manager
+	ring  atomic.Pointer[Ring]
+
+	mu    sync.Mutex
+	peers map[string]*remotePeer
+
+	forwardErrors uint64
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+type remotePeer struct {
+	conn    *grpc.ClientConn
+	batcher *batcher
+}
+
+func NewNode(local limiter.Manager, opts Options) *Node {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 64
+	}
+	if opts.BatchDelay <= 0 {
+		opts.BatchDelay = time.Millisecond
+	}
+	if opts.ForwardTimeout <= 0 {
+		opts.ForwardTimeout = 100 * time.Millisecond
+	}
+
+	n := &Node{
+		opts:  opts,
+		local: local,
+		peers: make(map[string]*remotePeer),
+	}
+	n.ring.Store(NewRing(opts.VirtualNodes, []string{opts.Self}))
+	return n
+}
+
+// Register exposes the peer API on s, which should be the gateway's
+// internal server from Options.Auth.NewServer.
+func (n *Node) Register(s *grpc.Server) {
+	RegisterPeerServer(s, &localPeer{local: n.local})
+}
+
+// Start follows membership changes from d until Close is called.
+func (n *Node) Start(ctx context.Context, d Discovery) error {
+	ctx, cancel := context.WithCancel(ctx)
+	updates, err := d.Watch(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	n.cancel = cancel
+	n.done = make(chan struct{})
+	go func() {
+		defer close(n.done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case members, ok := <-updates:
+				if !ok {
+					updates = nil
+					continue
+				}
+				n.setMembers(members)
+			}
+		}
+	}()
+	return nil
+}
+
+func (n *Node) Close() error {
+	if n.cancel != nil {
+		n.cancel()
+		<-n.done
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for addr, p := range n.peers {
+		p.conn.Close()
+		delete(n.peers, addr)
+	}
+	return nil
+}
+
+// Members returns the current ring membership.
+func (n *Node) Members() []string {
+	return n.ring.Load().Members()
+}
+
+// ForwardErrors returns how many forwarded calls failed and were decided
+// locally instead.
+func (n *Node) ForwardErrors() uint64 {
+	return atomic.LoadUint64(&n.forwardErrors)
+}
+
+func (n *Node) ForTenant(tenant string) limiter.Limiter {
+	return &clusterLimiter{node: n, tenant: tenant}
+}
+
+func (n *Node) setMembers(members []string) {
+	seen := make(map[string]bool, len(members))
+	for _, m := range members {
+		seen[m] = true
+	}
+	if !seen[n.opts.Self] {
+		// Always own part of the ring, even before our registration is seen.
+		members = append(members, n.opts.Self)
+	}
+	n.ring.Store(NewRing(n.opts.VirtualNodes, members))
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for addr, p := range n.peers {
+		if !seen[addr] {
+			p.conn.Close()
+			delete(n.peers, addr)
+		}
+	}
+}
+
+func (n *Node) peer(addr string) (*remotePeer, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if p, ok := n.peers[addr]; ok {
+		return p, nil
+	}
+	conn, err := n.opts.Auth.dial(addr, grpc.WithUnaryInterceptor(tracing.UnaryClientInterceptor()))
+	if err != nil {
+		return nil, err
+	}
+	p := &remotePeer{
+		conn:    conn,
+		batcher: newBatcher(&peerClient{conn: conn}, n.opts.BatchSize, n.opts.BatchDelay, n.opts.ForwardTimeout),
+	}
+	n.peers[addr] = p
+	return p, nil
+}
+
+type clusterLimiter struct {
+	node   *Node
+	tenant string
+}
+
+func (c *clusterLimiter) Allow(ctx context.Context, key string, cost int64) (*limiter.Result, error) {
+	return c.do(ctx, AllowItem{Tenant: c.tenant, Key: key, Cost: cost})
+}
+
+func (c *clusterLimiter) GetQuota(ctx context.Context, key string) (*limiter.Result, error) {
+	return c.do(ctx, AllowItem{Tenant: c.tenant, Key: key, Quota: true})
+}
+
+func (c *clusterLimiter) do(ctx context.Context, item AllowItem) (*limiter.Result, error) {
+	n := c.node
+	owner := n.ring.Load().Owner(item.Key)
+	if owner == "" || owner == n.opts.Self {
+		return c.local(ctx, item)
+	}
+
+	p, err := n.peer(owner)
+	if err == nil {
+		var res *limiter.Result
+		if res, err = p.batcher.Do(ctx, item); err == nil {
+			return res, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// The owner is unreachable: decide locally rather than failing the
+	// request, and flag the answer as approximate.
+	atomic.AddUint64(&n.forwardErrors, 1)
+	res, err := c.local(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	res.Degraded = true
+	return res, nil
+}
+
+func (c *clusterLimiter) local(ctx context.Context, item AllowItem) (*limiter.Result, error) {
+	rl := c.node.local.ForTenant(item.Tenant)
+	if item.Quota {
+		return rl.GetQuota(ctx, item.Key)
+	}
+	return rl.Allow(ctx, item.Key, item.Cost)
+}
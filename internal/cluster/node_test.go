@@ -0,0 +1,265 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/xizzxy/helios/internal/limiter"
+)
+
+// chanDiscovery hands out a channel the test sends membership on.
+type chanDiscovery chan []string
+
+func (d chanDiscovery) Watch(ctx context.Context) (<-chan []string, error) {
+	return d, nil
+}
+
+func newTestNode(self string) *Node {
+	local := limiter.NewLocalManager(limiter.Config{Limit: 10, Burst: 10, Window: time.Minute})
+	return NewNode(local, Options{Self: self, ForwardTimeout: time.Second})
+}
+
+// closeWithin fails the test if n.Close does not return in time.
+func closeWithin(t *testing.T, n *Node, timeout time.Duration) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		n.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("Close did not return")
+	}
+}
+
+func TestNodeCloseReturns(t *testing.T) {
+	for name, d := range map[string]Discovery{
+		"static":         StaticDiscovery{Peers: []string{"a", "b"}},
+		"open channel":   make(chanDiscovery),
+		"closed channel": func() chanDiscovery { ch := make(chanDiscovery); close(ch); return ch }(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			n := newTestNode("a")
+			if err := n.Start(context.Background(), d); err != nil {
+				t.Fatalf("start: %v", err)
+			}
+			closeWithin(t, n, time.Second)
+		})
+	}
+}
+
+func TestNodeOwnershipFollowsMembership(t *testing.T) {
+	updates := make(chanDiscovery)
+	n := newTestNode("a")
+	if err := n.Start(context.Background(), updates); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer closeWithin(t, n, time.Second)
+
+	owners := func() map[string]string {
+		m := make(map[string]string)
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			m[key] = n.ring.Load().Owner(key)
+		}
+		return m
+	}
+	setMembers := func(members ...string) {
+		updates <- members
+		waitFor(t, time.Second, func() bool { return len(n.Members()) == len(members) })
+	}
+
+	setMembers("a", "b")
+	before := owners()
+	setMembers("a", "b", "c")
+	after := owners()
+
+	moved := 0
+	for key, owner := range after {
+		if owner == before[key] {
+			continue
+		}
+		moved++
+		if owner != "c" {
+			t.Errorf("%s moved from %s to %s, want only moves to the new member", key, before[key], owner)
+		}
+	}
+	if moved == 0 || moved > 500 {
+		t.Errorf("%d of 1000 keys moved when a third member joined, want about a third", moved)
+	}
+
+	// When c leaves only its keys move. The list no longer names this
+	// node either, but it keeps its own share of the ring.
+	updates <- []string{"b"}
+	waitFor(t, time.Second, func() bool { return len(n.Members()) == 2 })
+	for key, owner := range owners() {
+		if was := after[key]; was != "c" && owner != was {
+			t.Errorf("%s moved from %s to %s when c left", key, was, owner)
+		}
+		if owner == "c" {
+			t.Errorf("%s is still owned by c after it left", key)
+		}
+	}
+}
+
+// recordingPeer answers every item and records each batch it is sent.
+type recordingPeer struct {
+	mu      sync.Mutex
+	batches [][]AllowItem
+	err     error
+}
+
+func (p *recordingPeer) AllowBatch(ctx context.Context, req *AllowBatchRequest) (*AllowBatchResponse, error) {
+	p.mu.Lock()
+	p.batches = append(p.batches, req.Items)
+	p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	resp := &AllowBatchResponse{Results: make([]ItemResult, len(req.Items))}
+	for i, item := range req.Items {
+		if item.Key == "bad" {
+			resp.Results[i].Error = "no such key"
+			continue
+		}
+		resp.Results[i].Result = &limiter.Result{Allowed: true, Remaining: item.Cost}
+	}
+	return resp, nil
+}
+
+func (p *recordingPeer) sizes() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []int
+	for _, b := range p.batches {
+		out = append(out, len(b))
+	}
+	return out
+}
+
+func TestBatcherFlush(t *testing.T) {
+	t.Run("when full", func(t *testing.T) {
+		peer := &recordingPeer{}
+		b := newBatcher(peer, 3, time.Hour, time.Second)
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				res, err := b.Do(context.Background(), AllowItem{Key: "k", Cost: int64(i)})
+				if err != nil || res.Remaining != int64(i) {
+					t.Errorf("item %d: %+v, %v, want its own result", i, res, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if got := peer.sizes(); len(got) != 1 || got[0] != 3 {
+			t.Errorf("batches = %v, want one of 3", got)
+		}
+	})
+
+	t.Run("after the delay", func(t *testing.T) {
+		peer := &recordingPeer{}
+		b := newBatcher(peer, 64, 5*time.Millisecond, time.Second)
+		if _, err := b.Do(context.Background(), AllowItem{Key: "k", Cost: 1}); err != nil {
+			t.Fatalf("do: %v", err)
+		}
+		if got := peer.sizes(); len(got) != 1 || got[0] != 1 {
+			t.Errorf("batches = %v, want one of 1", got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		b := newBatcher(&recordingPeer{}, 1, time.Hour, time.Second)
+		if _, err := b.Do(context.Background(), AllowItem{Key: "bad"}); err == nil || err.Error() != "no such key" {
+			t.Errorf("item error = %v, want the peer's message", err)
+		}
+
+		errDown := errors.New("peer down")
+		b = newBatcher(&recordingPeer{err: errDown}, 1, time.Hour, time.Second)
+		if _, err := b.Do(context.Background(), AllowItem{Key: "k"}); !errors.Is(err, errDown) {
+			t.Errorf("batch error = %v, want %v", err, errDown)
+		}
+	})
+}
+
+func TestNodeFallsBackWhenForwardingFails(t *testing.T) {
+	// Nothing listens on the owner's address, so every forward fails.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	dead := lis.Addr().String()
+	lis.Close()
+
+	n := newTestNode("self")
+	n.setMembers([]string{"self", dead})
+	defer n.Close()
+
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key-%d", i); n.ring.Load().Owner(k) == dead {
+			key = k
+		}
+	}
+
+	l := n.ForTenant("acme")
+	res, err := l.Allow(context.Background(), key, 1)
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	if !res.Allowed || !res.Degraded {
+		t.Errorf("result = %+v, want a degraded local admit", res)
+	}
+	if n.ForwardErrors() != 1 {
+		t.Errorf("forward errors = %d, want 1", n.ForwardErrors())
+	}
+	if res, _ := n.local.ForTenant("acme").GetQuota(context.Background(), key); res.Remaining != 9 {
+		t.Errorf("local remaining = %d, want the fallback charged locally", res.Remaining)
+	}
+
+	// A cancelled caller gets its own error, not a local decision.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Allow(ctx, key, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled allow: err = %v, want context.Canceled", err)
+	}
+}
+
+func TestPeerAuthRequiresSecret(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := PeerAuth{Secret: "s3cret"}.NewServer()
+	newTestNode(lis.Addr().String()).Register(srv)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	req := &AllowBatchRequest{Items: []AllowItem{{Tenant: "acme", Key: "k", Cost: 1}}}
+	for secret, want := range map[string]codes.Code{
+		"":       codes.Unauthenticated,
+		"wrong":  codes.Unauthenticated,
+		"s3cret": codes.OK,
+	} {
+		conn, err := PeerAuth{Secret: secret}.dial(lis.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		_, err = (&peerClient{conn: conn}).AllowBatch(context.Background(), req)
+		if status.Code(err) != want {
+			t.Errorf("secret %q: err = %v, want %v", secret, err, want)
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,120 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+
+	"github.com/xizzxy/helios/internal/limiter"
+)
+
+// AllowItem is one forwarded limiter call.
+type AllowItem struct {
+	Tenant string `json:"tenant"`
+	Key    string `json:"key"`
+	Cost   int64  `json:"cost"`
+	Quota  bool   `json:"quota,omitempty"` // GetQuota instead of Allow
+}
+
+type AllowBatchRequest struct {
+	Items []AllowItem `json:"items"`
+}
+
+// ItemResult carries either a decision or the error the owner hit.
+type ItemResult struct {
+	Result *limiter.Result `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type AllowBatchResponse struct {
+	Results []ItemResult `json:"results"`
+}
+
+// PeerServer is the internal API a key owner exposes to the other gateways.
+type PeerServer interface {
+	AllowBatch(ctx context.Context, req *AllowBatchRequest) (*AllowBatchResponse, error)
+}
+
+const allowBatchMethod = "/helios.cluster.v1.Peer/AllowBatch"
+
+var peerServiceDesc = grpc.ServiceDesc{
+	ServiceName: "helios.cluster.v1.Peer",
+	HandlerType: (*PeerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AllowBatch",
+			Handler:    allowBatchHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/cluster/peer.go",
+}
+
+// RegisterPeerServer exposes srv on a gRPC server.
+func RegisterPeerServer(s *grpc.Server, srv PeerServer) {
+	s.RegisterService(&peerServiceDesc, srv)
+}
+
+func allowBatchHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(AllowBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServer).AllowBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: allowBatchMethod,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(PeerServer).AllowBatch(ctx, req.(*AllowBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// localPeer answers forwarded calls from this node's own limiters. It never
+// forwards again, so a stale ring view cannot cause loops.
+type localPeer struct {
+	local limiter.Manager
+}
+
+func (p *localPeer) AllowBatch(ctx context.Context, req *AllowBatchRequest) (*AllowBatchResponse, error) {
+	resp := &AllowBatchResponse{Results: make([]ItemResult, len(req.Items))}
+	for i, item := range req.Items {
+		rl := p.local.ForTenant(item.Tenant)
+
+		var (
+			res *limiter.Result
+			err error
+		)
+		if item.Quota {
+			res, err = rl.GetQuota(ctx, item.Key)
+		} else {
+			res, err = rl.Allow(ctx, item.Key, item.Cost)
+		}
+		if err != nil {
+			resp.Results[i].Error = err.Error()
+			continue
+		}
+		resp.Results[i].Result = res
+	}
+	return resp, nil
+}
+
+// peerClient calls AllowBatch on a remote gateway.
+type peerClient struct {
+	conn *grpc.ClientConn
+}
+
+func (c *peerClient) AllowBatch(ctx context.Context, req *AllowBatchRequest) (*AllowBatchResponse, error) {
+	out := new(AllowBatchResponse)
+	if err := c.conn.Invoke(ctx, allowBatchMethod, req, out, grpc.CallContentSubtype(codecName)); err != nil {
+		return nil, err
+	}
+	if len(out.Results) != len(req.Items) {
+		return nil, errors.New("peer returned a mismatched batch")
+	}
+	return out, nil
+}
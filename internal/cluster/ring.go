@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// Ring assigns keys to members by consistent hashing. Each member is placed
+// on the ring at several virtual points so ownership stays balanced and only
+// about 1/N of the keys move when a member joins or leaves. A Ring is
+// immutable; build a new one when membership changes.
+type Ring struct {
+	points  []uint32
+	owners  map[uint32]string
+	members []string
+}
+
+func NewRing(virtualNodes int, members []string) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = 128
+	}
+
+	r := &Ring{
+		owners:  make(map[uint32]string, len(members)*virtualNodes),
+		members: append([]string(nil), members...),
+	}
+	sort.Strings(r.members)
+
+	for _, m := range r.members {
+		for i := 0; i < virtualNodes; i++ {
+			p := hashKey(m + "#" + strconv.Itoa(i))
+			if _, taken := r.owners[p]; taken {
+				continue
+			}
+			r.owners[p] = m
+			r.points = append(r.points, p)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// Owner returns the member responsible for key, or "" for an empty ring.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Members returns the sorted member list.
+func (r *Ring) Members() []string {
+	return append([]string(nil), r.members...)
+}
+
+func hashKey(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -4,6 +4,7 @@ import (
 	// "fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,13 +19,123 @@ type Config struct {
 }
 
 type GatewayConfig struct {
-	Address         string        `yaml:"address"`
-	GRPCAddress     string        `yaml:"grpc_address"`
-	ReadTimeout     time.Duration `yaml:"read_timeout"`
-	WriteTimeout    time.Duration `yaml:"write_timeout"`
-	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
-	MaxRequestSize  int64         `yaml:"max_request_size"`
-	ConsistencyMode string        `yaml:"consistency_mode"` // "fast" or "strong"
+	Address         string            `yaml:"address"`
+	GRPCAddress     string            `yaml:"grpc_address"`
+	ReadTimeout     time.Duration     `yaml:"read_timeout"`
+	WriteTimeout    time.Duration     `yaml:"write_timeout"`
+	ShutdownTimeout time.Duration     `yaml:"shutdown_timeout"`
+	MaxRequestSize  int64             `yaml:"max_request_size"`
+	DecisionTimeout time.Duration     `yaml:"decision_timeout"` // bounds each limiter call, retries included
+	ConsistencyMode string            `yaml:"consistency_mode"` // "fast", "strong" or "cluster"
+	FastSync        FastSyncConfig    `yaml:"fast_sync"`
+	Lease           LeaseConfig       `yaml:"lease"`
+	Cluster         ClusterConfig     `yaml:"cluster"`
+	Gossip          GossipConfig      `yaml:"gossip"`
+	LocalState      StateConfig       `yaml:"local_state"`
+	Policies        PoliciesConfig    `yaml:"policies"`
+	DecisionLog     DecisionLogConfig `yaml:"decision_log"`
+	Usage           UsageConfig       `yaml:"usage"`
+	Adaptive        AdaptiveConfig    `yaml:"adaptive"`
+}
+
+// AdaptiveConfig tunes policies using the "adaptive" algorithm, which
+// learn a concurrency limit from the outcomes callers report.
+type AdaptiveConfig struct {
+	Strategy          string        `yaml:"strategy"` // "aimd", "vegas" or "gradient2"
+	MinLimit          int64         `yaml:"min_limit"`
+	MaxLimit          int64         `yaml:"max_limit"`          // unless the policy's burst is set
+	Timeout           time.Duration `yaml:"timeout"`            // AIMD counts slower calls as dropped
+	BackoffRatio      float64       `yaml:"backoff_ratio"`      // AIMD decrease on a drop
+	CompletionTimeout time.Duration `yaml:"completion_timeout"` // unreported calls count as dropped after this
+}
+
+// UsageConfig meters consumed and denied cost per tenant, resource and API
+// key into minute, hour and day buckets, stored in etcd where the control
+// plane reports on them. Each granularity expires after its retention.
+type UsageConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	FlushInterval   time.Duration `yaml:"flush_interval"`
+	MinuteRetention time.Duration `yaml:"minute_retention"`
+	HourRetention   time.Duration `yaml:"hour_retention"`
+	DayRetention    time.Duration `yaml:"day_retention"`
+}
+
+// DecisionLogConfig streams every decision to audit and billing sinks.
+// Events are batched off the request path; when the buffer is full they
+// are dropped and counted rather than slowing requests down.
+type DecisionLogConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Sinks          []string      `yaml:"sinks"`       // any of "stdout", "file", "webhook"
+	Instance       string        `yaml:"instance"`    // recorded on each event
+	BufferSize     int           `yaml:"buffer_size"` // queued events before dropping
+	BatchSize      int           `yaml:"batch_size"`
+	FlushInterval  time.Duration `yaml:"flush_interval"`
+	FilePath       string        `yaml:"file_path"`
+	MaxFileSizeMB  int           `yaml:"max_file_size_mb"` // rotate beyond this size
+	MaxBackups     int           `yaml:"max_backups"`      // rotated files kept
+	WebhookURL     string        `yaml:"webhook_url"`
+	WebhookToken   string        `yaml:"webhook_token"`   // sent as a bearer token
+	WebhookRetries int           `yaml:"webhook_retries"` // resends of a failed batch, with backoff
+	WriteTimeout   time.Duration `yaml:"write_timeout"`   // per batch and sink
+}
+
+// PoliciesConfig loads per-tenant policies from the control plane's etcd
+// records. Requests for tenants or resources without a policy use the
+// gateway default.
+type PoliciesConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// StateConfig bounds the per-key state in-memory limiters keep.
+type StateConfig struct {
+	MaxKeys       int           `yaml:"max_keys"`       // LRU cap; 0 means unbounded
+	SweepInterval time.Duration `yaml:"sweep_interval"` // how often idle keys are dropped
+	Shards        int           `yaml:"shards"`         // lock partitions; 0 means 4×GOMAXPROCS
+}
+
+// GossipConfig lets FAST mode gateways share approximate per-key usage.
+// Membership, the peer listener and its authentication come from the
+// Cluster settings.
+type GossipConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+	Fanout   int           `yaml:"fanout"`
+	KeyTTL   time.Duration `yaml:"key_ttl"`
+	MaxKeys  int           `yaml:"max_keys"` // keys learned from peers and sent per push
+}
+
+// ClusterConfig drives CLUSTER mode, where gateways own keys by consistent
+// hashing and forward calls for keys they don't own to the owner. The peer
+// APIs of CLUSTER and gossip modes are served on ListenAddress, apart from
+// the public gRPC API, and need the shared Secret, mutual TLS, or both.
+type ClusterConfig struct {
+	ListenAddress    string        `yaml:"listen_address"`    // internal gRPC address for the peer APIs
+	AdvertiseAddress string        `yaml:"advertise_address"` // ListenAddress as other gateways dial it
+	Discovery        string        `yaml:"discovery"`         // "static" or "etcd"
+	Peers            []string      `yaml:"peers"`             // static peer gRPC addresses
+	VirtualNodes     int           `yaml:"virtual_nodes"`
+	BatchSize        int           `yaml:"batch_size"`
+	BatchDelay       time.Duration `yaml:"batch_delay"`
+	ForwardTimeout   time.Duration `yaml:"forward_timeout"`
+	Secret           string        `yaml:"secret"` // shared by every gateway and sent on each peer call
+	TLS              TLSConfig     `yaml:"tls"`    // one certificate per gateway, served and presented to peers
+}
+
+// LeaseConfig makes STRONG mode borrow blocks of quota from Redis instead
+// of spending one script call per request.
+type LeaseConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	TTL         time.Duration `yaml:"ttl"`
+	MaxFraction float64       `yaml:"max_fraction"` // share of remaining tokens per lease
+}
+
+// FastSyncConfig enables periodic reconciliation of FAST mode buckets
+// against Redis so that replicas share one global limit.
+type FastSyncConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Interval    time.Duration `yaml:"interval"`
+	ErrorBudget float64       `yaml:"error_budget"` // fraction of the limit
+	InstanceID  string        `yaml:"instance_id"`
 }
 
 type ControlConfig struct {
@@ -33,10 +144,18 @@ type ControlConfig struct {
 	ReadTimeout     time.Duration `yaml:"read_timeout"`
 	WriteTimeout    time.Duration `yaml:"write_timeout"`
 	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// MaxOverrideDuration caps how long a temporary limit override may
+	// last.
+	MaxOverrideDuration time.Duration `yaml:"max_override_duration"`
+	// OperatorTokens maps operator names to the bearer tokens that
+	// authenticate their override changes. Without any, the operator
+	// names itself in the X-Helios-Actor header.
+	OperatorTokens map[string]string `yaml:"operator_tokens"`
 }
 
 type RedisConfig struct {
 	Address      string        `yaml:"address"`
+	Username     string        `yaml:"username"` // Redis 6+ ACL user
 	Password     string        `yaml:"password"`
 	Database     int           `yaml:"database"`
 	PoolSize     int           `yaml:"pool_size"`
@@ -45,6 +164,7 @@ type RedisConfig struct {
 	DialTimeout  time.Duration `yaml:"dial_timeout"`
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
+	TLS          TLSConfig     `yaml:"tls"`
 }
 
 type EtcdConfig struct {
@@ -52,18 +172,47 @@ type EtcdConfig struct {
 	DialTimeout time.Duration `yaml:"dial_timeout"`
 	Username    string        `yaml:"username"`
 	Password    string        `yaml:"password"`
+	TLS         TLSConfig     `yaml:"tls"`
+}
+
+// TLSConfig describes TLS for connections to backing stores and between
+// gateways.
+type TLSConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	CAFile     string `yaml:"ca_file"`     // PEM bundle used to verify the server
+	CertFile   string `yaml:"cert_file"`   // client certificate for mutual TLS
+	KeyFile    string `yaml:"key_file"`    // client private key for mutual TLS
+	ServerName string `yaml:"server_name"` // overrides the SNI / verification host name
 }
 
 type ObservabilityConfig struct {
-	MetricsEnabled   bool   `yaml:"metrics_enabled"`
-	MetricsAddress   string `yaml:"metrics_address"`
-	TracingEnabled   bool   `yaml:"tracing_enabled"`
-	JaegerEndpoint   string `yaml:"jaeger_endpoint"`
-	ServiceName      string `yaml:"service_name"`
-	ServiceVersion   string `yaml:"service_version"`
-	LogLevel         string `yaml:"log_level"`
-	EnableProfiling  bool   `yaml:"enable_profiling"`
-	ProfilingAddress string `yaml:"profiling_address"`
+	MetricsEnabled     bool    `yaml:"metrics_enabled"`
+	MetricsAddress     string  `yaml:"metrics_address"`
+	TracingEnabled     bool    `yaml:"tracing_enabled"`
+	JaegerEndpoint     string  `yaml:"jaeger_endpoint"`
+	TracingExporter    string  `yaml:"tracing_exporter"` // "jaeger" or "otlp" (gRPC)
+	OTLPEndpoint       string  `yaml:"otlp_endpoint"`
+	OTLPInsecure       bool    `yaml:"otlp_insecure"`
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio"`
+	ServiceName        string  `yaml:"service_name"` // defaults to the binary name
+	ServiceVersion     string  `yaml:"service_version"`
+	LogLevel           string  `yaml:"log_level"`
+	EnableProfiling    bool    `yaml:"enable_profiling"`
+	ProfilingAddress   string  `yaml:"profiling_address"`
+	ProfilingToken     string  `yaml:"profiling_token"` // bearer token for the diagnostics server; empty disables auth
+
+	TenantLabels TenantLabelConfig `yaml:"tenant_labels"`
+}
+
+// TenantLabelConfig bounds the tenant label on metrics. Allow-listed
+// tenants and up to TopN heavy hitters get their own series; the rest are
+// reported as tenant="other".
+type TenantLabelConfig struct {
+	AllowList       []string      `yaml:"allow_list"`
+	TopN            int           `yaml:"top_n"`
+	SketchSize      int           `yaml:"sketch_size"`      // keys tracked per top-K sketch
+	RefreshInterval time.Duration `yaml:"refresh_interval"` // how often heavy hitters are promoted
+	MaxResources    int           `yaml:"max_resources"`    // resources with their own top-K sketches
 }
 
 type AuthConfig struct {
@@ -86,21 +235,37 @@ type CircuitBreakerConfig struct {
 	FailureThreshold     int           `yaml:"failure_threshold"`
 	TimeoutDuration      time.Duration `yaml:"timeout_duration"`
 	MaxConcurrentRequest int           `yaml:"max_concurrent_request"`
+	// Fallback is the default policy while the breaker is open:
+	// "open", "closed" or "local". TenantFallbacks overrides it per tenant.
+	Fallback        string            `yaml:"fallback"`
+	TenantFallbacks map[string]string `yaml:"tenant_fallbacks"`
 }
 
+// BulkheadConfig caps concurrent requests and queues the excess in FIFO
+// order. With TenantIsolation each tenant gets a weighted fair share of the
+// slots and the queue, and runs at most TenantMaxConcurrency times its
+// weight at once.
 type BulkheadConfig struct {
-	Enabled         bool `yaml:"enabled"`
-	MaxConcurrency  int  `yaml:"max_concurrency"`
-	QueueSize       int  `yaml:"queue_size"`
-	TenantIsolation bool `yaml:"tenant_isolation"`
+	Enabled              bool               `yaml:"enabled"`
+	MaxConcurrency       int                `yaml:"max_concurrency"`
+	QueueSize            int                `yaml:"queue_size"`
+	QueueTimeout         time.Duration      `yaml:"queue_timeout"` // longest a request waits for a slot
+	TenantIsolation      bool               `yaml:"tenant_isolation"`
+	TenantWeights        map[string]float64 `yaml:"tenant_weights"`         // relative shares; tenants default to 1
+	TenantMaxConcurrency int                `yaml:"tenant_max_concurrency"` // per unit of weight; 0 for no cap
 }
 
+// LoadSheddingConfig sets the overload thresholds. Crossing any of them
+// sheds low priority requests; crossing one by 25% sheds all but critical
+// ones.
 type LoadSheddingConfig struct {
 	Enabled              bool          `yaml:"enabled"`
-	CPUThreshold         float64       `yaml:"cpu_threshold"`
-	MemoryThreshold      float64       `yaml:"memory_threshold"`
-	LatencyThreshold     time.Duration `yaml:"latency_threshold"`
-	QueueLengthThreshold int           `yaml:"queue_length_threshold"`
+	CPUThreshold         float64       `yaml:"cpu_threshold"`          // fraction of GOMAXPROCS
+	MemoryThreshold      float64       `yaml:"memory_threshold"`       // heap as a fraction of the memory limit
+	LatencyThreshold     time.Duration `yaml:"latency_threshold"`      // p99 request latency
+	QueueLengthThreshold int           `yaml:"queue_length_threshold"` // in-flight requests
+	SampleInterval       time.Duration `yaml:"sample_interval"`
+	Cooldown             time.Duration `yaml:"cooldown"` // minimum time before shedding eases off
 }
 
 type RetryConfig struct {
@@ -121,17 +286,89 @@ func LoadConfig() *Config {
 			WriteTimeout:    getEnvDuration("HELIOS_GATEWAY_WRITE_TIMEOUT", 30*time.Second),
 			ShutdownTimeout: getEnvDuration("HELIOS_GATEWAY_SHUTDOWN_TIMEOUT", 30*time.Second),
 			MaxRequestSize:  getEnvInt64("HELIOS_GATEWAY_MAX_REQUEST_SIZE", 1024*1024), // 1MB
+			DecisionTimeout: getEnvDuration("HELIOS_GATEWAY_DECISION_TIMEOUT", 500*time.Millisecond),
 			ConsistencyMode: getEnv("HELIOS_CONSISTENCY_MODE", "fast"),
+			FastSync: FastSyncConfig{
+				Enabled:     getEnvBool("HELIOS_FAST_SYNC_ENABLED", false),
+				Interval:    getEnvDuration("HELIOS_FAST_SYNC_INTERVAL", 10*time.Millisecond),
+				ErrorBudget: getEnvFloat64("HELIOS_FAST_SYNC_ERROR_BUDGET", 0.05),
+				InstanceID:  getEnv("HELIOS_INSTANCE_ID", hostname()),
+			},
+			Lease: LeaseConfig{
+				Enabled:     getEnvBool("HELIOS_LEASE_ENABLED", false),
+				TTL:         getEnvDuration("HELIOS_LEASE_TTL", time.Second),
+				MaxFraction: getEnvFloat64("HELIOS_LEASE_MAX_FRACTION", 0.1),
+			},
+			Cluster: ClusterConfig{
+				ListenAddress:    getEnv("HELIOS_CLUSTER_LISTEN_ADDRESS", ":9082"),
+				AdvertiseAddress: getEnv("HELIOS_CLUSTER_ADVERTISE_ADDRESS", hostname()+":9082"),
+				Discovery:        getEnv("HELIOS_CLUSTER_DISCOVERY", "static"),
+				Peers:            getEnvStringSlice("HELIOS_CLUSTER_PEERS", nil),
+				VirtualNodes:     getEnvInt("HELIOS_CLUSTER_VIRTUAL_NODES", 128),
+				BatchSize:        getEnvInt("HELIOS_CLUSTER_BATCH_SIZE", 64),
+				BatchDelay:       getEnvDuration("HELIOS_CLUSTER_BATCH_DELAY", time.Millisecond),
+				ForwardTimeout:   getEnvDuration("HELIOS_CLUSTER_FORWARD_TIMEOUT", 100*time.Millisecond),
+				Secret:           getEnv("HELIOS_CLUSTER_SECRET", ""),
+				TLS:              loadTLSConfig("HELIOS_CLUSTER_TLS"),
+			},
+			Gossip: GossipConfig{
+				Enabled:  getEnvBool("HELIOS_GOSSIP_ENABLED", false),
+				Interval: getEnvDuration("HELIOS_GOSSIP_INTERVAL", 100*time.Millisecond),
+				Fanout:   getEnvInt("HELIOS_GOSSIP_FANOUT", 3),
+				KeyTTL:   getEnvDuration("HELIOS_GOSSIP_KEY_TTL", 10*time.Minute),
+				MaxKeys:  getEnvInt("HELIOS_GOSSIP_MAX_KEYS", 100000),
+			},
+			LocalState: StateConfig{
+				MaxKeys:       getEnvInt("HELIOS_LOCAL_STATE_MAX_KEYS", 1000000),
+				SweepInterval: getEnvDuration("HELIOS_LOCAL_STATE_SWEEP_INTERVAL", time.Minute),
+				Shards:        getEnvInt("HELIOS_LOCAL_STATE_SHARDS", 0),
+			},
+			Policies: PoliciesConfig{
+				Enabled: getEnvBool("HELIOS_POLICIES_ENABLED", false),
+			},
+			DecisionLog: DecisionLogConfig{
+				Enabled:        getEnvBool("HELIOS_DECISION_LOG_ENABLED", false),
+				Sinks:          getEnvStringSlice("HELIOS_DECISION_LOG_SINKS", []string{"stdout"}),
+				Instance:       getEnv("HELIOS_INSTANCE_ID", hostname()),
+				BufferSize:     getEnvInt("HELIOS_DECISION_LOG_BUFFER_SIZE", 10000),
+				BatchSize:      getEnvInt("HELIOS_DECISION_LOG_BATCH_SIZE", 500),
+				FlushInterval:  getEnvDuration("HELIOS_DECISION_LOG_FLUSH_INTERVAL", time.Second),
+				FilePath:       getEnv("HELIOS_DECISION_LOG_FILE_PATH", "/var/log/helios/decisions.jsonl"),
+				MaxFileSizeMB:  getEnvInt("HELIOS_DECISION_LOG_MAX_FILE_SIZE_MB", 100),
+				MaxBackups:     getEnvInt("HELIOS_DECISION_LOG_MAX_BACKUPS", 10),
+				WebhookURL:     getEnv("HELIOS_DECISION_LOG_WEBHOOK_URL", ""),
+				WebhookToken:   getEnv("HELIOS_DECISION_LOG_WEBHOOK_TOKEN", ""),
+				WebhookRetries: getEnvInt("HELIOS_DECISION_LOG_WEBHOOK_RETRIES", 3),
+				WriteTimeout:   getEnvDuration("HELIOS_DECISION_LOG_WRITE_TIMEOUT", 5*time.Second),
+			},
+			Usage: UsageConfig{
+				Enabled:         getEnvBool("HELIOS_USAGE_ENABLED", false),
+				FlushInterval:   getEnvDuration("HELIOS_USAGE_FLUSH_INTERVAL", 10*time.Second),
+				MinuteRetention: getEnvDuration("HELIOS_USAGE_MINUTE_RETENTION", time.Hour),
+				HourRetention:   getEnvDuration("HELIOS_USAGE_HOUR_RETENTION", 35*24*time.Hour),
+				DayRetention:    getEnvDuration("HELIOS_USAGE_DAY_RETENTION", 400*24*time.Hour),
+			},
+			Adaptive: AdaptiveConfig{
+				Strategy:          getEnv("HELIOS_ADAPTIVE_STRATEGY", "aimd"),
+				MinLimit:          getEnvInt64("HELIOS_ADAPTIVE_MIN_LIMIT", 1),
+				MaxLimit:          getEnvInt64("HELIOS_ADAPTIVE_MAX_LIMIT", 1000),
+				Timeout:           getEnvDuration("HELIOS_ADAPTIVE_TIMEOUT", 5*time.Second),
+				BackoffRatio:      getEnvFloat64("HELIOS_ADAPTIVE_BACKOFF_RATIO", 0.9),
+				CompletionTimeout: getEnvDuration("HELIOS_ADAPTIVE_COMPLETION_TIMEOUT", 30*time.Second),
+			},
 		},
 		Control: ControlConfig{
-			Address:         getEnv("HELIOS_CONTROL_ADDRESS", ":8081"),
-			GRPCAddress:     getEnv("HELIOS_CONTROL_GRPC_ADDRESS", ":9081"),
-			ReadTimeout:     getEnvDuration("HELIOS_CONTROL_READ_TIMEOUT", 30*time.Second),
-			WriteTimeout:    getEnvDuration("HELIOS_CONTROL_WRITE_TIMEOUT", 30*time.Second),
-			ShutdownTimeout: getEnvDuration("HELIOS_CONTROL_SHUTDOWN_TIMEOUT", 30*time.Second),
+			Address:             getEnv("HELIOS_CONTROL_ADDRESS", ":8081"),
+			GRPCAddress:         getEnv("HELIOS_CONTROL_GRPC_ADDRESS", ":9081"),
+			ReadTimeout:         getEnvDuration("HELIOS_CONTROL_READ_TIMEOUT", 30*time.Second),
+			WriteTimeout:        getEnvDuration("HELIOS_CONTROL_WRITE_TIMEOUT", 30*time.Second),
+			ShutdownTimeout:     getEnvDuration("HELIOS_CONTROL_SHUTDOWN_TIMEOUT", 30*time.Second),
+			MaxOverrideDuration: getEnvDuration("HELIOS_CONTROL_MAX_OVERRIDE_DURATION", 30*24*time.Hour),
+			OperatorTokens:      getEnvMap("HELIOS_CONTROL_OPERATOR_TOKENS"),
 		},
 		Redis: RedisConfig{
 			Address:      getEnv("HELIOS_REDIS_ADDRESS", "localhost:6379"),
+			Username:     getEnv("HELIOS_REDIS_USERNAME", ""),
 			Password:     getEnv("HELIOS_REDIS_PASSWORD", ""),
 			Database:     getEnvInt("HELIOS_REDIS_DATABASE", 0),
 			PoolSize:     getEnvInt("HELIOS_REDIS_POOL_SIZE", 100),
@@ -140,23 +377,37 @@ func LoadConfig() *Config {
 			DialTimeout:  getEnvDuration("HELIOS_REDIS_DIAL_TIMEOUT", 5*time.Second),
 			ReadTimeout:  getEnvDuration("HELIOS_REDIS_READ_TIMEOUT", 3*time.Second),
 			WriteTimeout: getEnvDuration("HELIOS_REDIS_WRITE_TIMEOUT", 3*time.Second),
+			TLS:          loadTLSConfig("HELIOS_REDIS_TLS"),
 		},
 		Etcd: EtcdConfig{
 			Endpoints:   getEnvStringSlice("HELIOS_ETCD_ENDPOINTS", []string{"localhost:2379"}),
 			DialTimeout: getEnvDuration("HELIOS_ETCD_DIAL_TIMEOUT", 5*time.Second),
 			Username:    getEnv("HELIOS_ETCD_USERNAME", ""),
 			Password:    getEnv("HELIOS_ETCD_PASSWORD", ""),
+			TLS:         loadTLSConfig("HELIOS_ETCD_TLS"),
 		},
 		Observability: ObservabilityConfig{
-			MetricsEnabled:   getEnvBool("HELIOS_METRICS_ENABLED", true),
-			MetricsAddress:   getEnv("HELIOS_METRICS_ADDRESS", ":2112"),
-			TracingEnabled:   getEnvBool("HELIOS_TRACING_ENABLED", false),
-			JaegerEndpoint:   getEnv("HELIOS_JAEGER_ENDPOINT", "http://localhost:14268/api/traces"),
-			ServiceName:      getEnv("HELIOS_SERVICE_NAME", "helios-gateway"),
-			ServiceVersion:   getEnv("HELIOS_SERVICE_VERSION", "dev"),
-			LogLevel:         getEnv("HELIOS_LOG_LEVEL", "info"),
-			EnableProfiling:  getEnvBool("HELIOS_ENABLE_PROFILING", false),
-			ProfilingAddress: getEnv("HELIOS_PROFILING_ADDRESS", ":6060"),
+			MetricsEnabled:     getEnvBool("HELIOS_METRICS_ENABLED", true),
+			MetricsAddress:     getEnv("HELIOS_METRICS_ADDRESS", ":2112"),
+			TracingEnabled:     getEnvBool("HELIOS_TRACING_ENABLED", false),
+			JaegerEndpoint:     getEnv("HELIOS_JAEGER_ENDPOINT", "http://localhost:14268/api/traces"),
+			TracingExporter:    getEnv("HELIOS_TRACING_EXPORTER", "jaeger"),
+			OTLPEndpoint:       getEnv("HELIOS_OTLP_ENDPOINT", "localhost:4317"),
+			OTLPInsecure:       getEnvBool("HELIOS_OTLP_INSECURE", true),
+			TracingSampleRatio: getEnvFloat64("HELIOS_TRACING_SAMPLE_RATIO", 1.0),
+			ServiceName:        getEnv("HELIOS_SERVICE_NAME", ""),
+			ServiceVersion:     getEnv("HELIOS_SERVICE_VERSION", "dev"),
+			LogLevel:           getEnv("HELIOS_LOG_LEVEL", "info"),
+			EnableProfiling:    getEnvBool("HELIOS_ENABLE_PROFILING", false),
+			ProfilingAddress:   getEnv("HELIOS_PROFILING_ADDRESS", ":6060"),
+			ProfilingToken:     getEnv("HELIOS_PROFILING_TOKEN", ""),
+			TenantLabels: TenantLabelConfig{
+				AllowList:       getEnvStringSlice("HELIOS_METRICS_TENANT_ALLOW_LIST", nil),
+				TopN:            getEnvInt("HELIOS_METRICS_TENANT_TOP_N", 20),
+				SketchSize:      getEnvInt("HELIOS_METRICS_SKETCH_SIZE", 1000),
+				RefreshInterval: getEnvDuration("HELIOS_METRICS_TOPK_REFRESH_INTERVAL", 10*time.Second),
+				MaxResources:    getEnvInt("HELIOS_METRICS_MAX_RESOURCES", 100),
+			},
 		},
 		Auth: AuthConfig{
 			JWTEnabled:    getEnvBool("HELIOS_JWT_ENABLED", false),
@@ -171,12 +422,17 @@ func LoadConfig() *Config {
 				FailureThreshold:     getEnvInt("HELIOS_CIRCUIT_BREAKER_FAILURE_THRESHOLD", 10),
 				TimeoutDuration:      getEnvDuration("HELIOS_CIRCUIT_BREAKER_TIMEOUT", 60*time.Second),
 				MaxConcurrentRequest: getEnvInt("HELIOS_CIRCUIT_BREAKER_MAX_CONCURRENT", 100),
+				Fallback:             getEnv("HELIOS_CIRCUIT_BREAKER_FALLBACK", "local"),
+				TenantFallbacks:      getEnvMap("HELIOS_CIRCUIT_BREAKER_TENANT_FALLBACKS"),
 			},
 			Bulkhead: BulkheadConfig{
-				Enabled:         getEnvBool("HELIOS_BULKHEAD_ENABLED", true),
-				MaxConcurrency:  getEnvInt("HELIOS_BULKHEAD_MAX_CONCURRENCY", 1000),
-				QueueSize:       getEnvInt("HELIOS_BULKHEAD_QUEUE_SIZE", 10000),
-				TenantIsolation: getEnvBool("HELIOS_BULKHEAD_TENANT_ISOLATION", true),
+				Enabled:              getEnvBool("HELIOS_BULKHEAD_ENABLED", true),
+				MaxConcurrency:       getEnvInt("HELIOS_BULKHEAD_MAX_CONCURRENCY", 1000),
+				QueueSize:            getEnvInt("HELIOS_BULKHEAD_QUEUE_SIZE", 10000),
+				QueueTimeout:         getEnvDuration("HELIOS_BULKHEAD_QUEUE_TIMEOUT", time.Second),
+				TenantIsolation:      getEnvBool("HELIOS_BULKHEAD_TENANT_ISOLATION", true),
+				TenantWeights:        getEnvFloatMap("HELIOS_BULKHEAD_TENANT_WEIGHTS"),
+				TenantMaxConcurrency: getEnvInt("HELIOS_BULKHEAD_TENANT_MAX_CONCURRENCY", 250),
 			},
 			LoadShedding: LoadSheddingConfig{
 				Enabled:              getEnvBool("HELIOS_LOAD_SHEDDING_ENABLED", true),
@@ -184,6 +440,8 @@ func LoadConfig() *Config {
 				MemoryThreshold:      getEnvFloat64("HELIOS_LOAD_SHEDDING_MEMORY_THRESHOLD", 0.85),
 				LatencyThreshold:     getEnvDuration("HELIOS_LOAD_SHEDDING_LATENCY_THRESHOLD", 100*time.Millisecond),
 				QueueLengthThreshold: getEnvInt("HELIOS_LOAD_SHEDDING_QUEUE_THRESHOLD", 1000),
+				SampleInterval:       getEnvDuration("HELIOS_LOAD_SHEDDING_SAMPLE_INTERVAL", 100*time.Millisecond),
+				Cooldown:             getEnvDuration("HELIOS_LOAD_SHEDDING_COOLDOWN", 5*time.Second),
 			},
 			Retry: RetryConfig{
 				Enabled:         getEnvBool("HELIOS_RETRY_ENABLED", true),
@@ -196,6 +454,18 @@ func LoadConfig() *Config {
 	}
 }
 
+// loadTLSConfig reads the <prefix>_ENABLED, _CA_FILE, _CERT_FILE, _KEY_FILE
+// and _SERVER_NAME variables.
+func loadTLSConfig(prefix string) TLSConfig {
+	return TLSConfig{
+		Enabled:    getEnvBool(prefix+"_ENABLED", false),
+		CAFile:     getEnv(prefix+"_CA_FILE", ""),
+		CertFile:   getEnv(prefix+"_CERT_FILE", ""),
+		KeyFile:    getEnv(prefix+"_KEY_FILE", ""),
+		ServerName: getEnv(prefix+"_SERVER_NAME", ""),
+	}
+}
+
 // Helper functions for environment variable parsing
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -251,7 +521,46 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 
 func getEnvStringSlice(key string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
-		return []string{value} // Simplified - could parse comma-separated values
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
 	}
 	return defaultValue
 }
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "helios"
+	}
+	return name
+}
+
+// getEnvMap parses "key=value,key=value" pairs.
+func getEnvMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return result
+}
+
+// getEnvFloatMap parses "key=number,key=number" pairs, skipping any whose
+// value is not a number.
+func getEnvFloatMap(key string) map[string]float64 {
+	result := make(map[string]float64)
+	for k, v := range getEnvMap(key) {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			result[k] = f
+		}
+	}
+	return result
+}
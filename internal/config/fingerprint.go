@@ -0,0 +1,19 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Fingerprint identifies the loaded configuration, so that diagnostics can
+// tell whether two processes run with the same settings. It is a hash and
+// does not reveal secrets.
+func (c *Config) Fingerprint() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ClientTLS builds a *tls.Config from the settings. It returns nil when TLS
+// is disabled so callers can pass the result straight to client options.
+func (t TLSConfig) ClientTLS() (*tls.Config, error) {
+	if !t.Enabled {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: t.ServerName,
+	}
+
+	if t.CAFile != "" {
+		pool, err := t.caPool()
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, errors.New("both cert_file and key_file must be set for client certificates")
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// ServerTLS builds a *tls.Config that serves CertFile and, when CAFile is
+// set, only accepts clients presenting a certificate it signed. It returns
+// nil when TLS is disabled.
+func (t TLSConfig) ServerTLS() (*tls.Config, error) {
+	if !t.Enabled {
+		return nil, nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return nil, errors.New("cert_file and key_file must be set to serve TLS")
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server certificate: %w", err)
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if t.CAFile != "" {
+		pool, err := t.caPool()
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
+
+// MutualTLS reports whether the settings both present and verify
+// certificates, so each side of a connection is authenticated.
+func (t TLSConfig) MutualTLS() bool {
+	return t.Enabled && t.CAFile != "" && t.CertFile != "" && t.KeyFile != ""
+}
+
+func (t TLSConfig) caPool() (*x509.CertPool, error) {
+	pem, err := os.ReadFile(t.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", t.CAFile)
+	}
+	return pool, nil
+}
@@ -0,0 +1,294 @@
+package control
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/xizzxy/helios/internal/policy"
+)
+
+// overrideLeaseGrace keeps an override in etcd a little past its end, so
+// gateways remove it on time rather than when the lease happens to expire.
+const overrideLeaseGrace = time.Minute
+
+// actor names who made a change to overrides. With operator tokens
+// configured it is the operator whose bearer token the request carries;
+// without, it is whatever the X-Helios-Actor header claims, and the audit
+// trail records it as unauthenticated.
+func (s *Server) actor(c *gin.Context) (string, bool) {
+	tokens := s.config.Control.OperatorTokens
+	if len(tokens) == 0 {
+		who := c.GetHeader("X-Helios-Actor")
+		if who == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "X-Helios-Actor header is required"})
+			return "", false
+		}
+		return who, true
+	}
+
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if ok {
+		for name, want := range tokens {
+			if want != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1 {
+				return name, true
+			}
+		}
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "an operator bearer token is required"})
+	return "", false
+}
+
+func auditKey(tenantID string, at time.Time, id string) string {
+	return fmt.Sprintf("%s%s/%020d-%s", policy.OverrideAuditPrefix, tenantID, at.UnixNano(), id)
+}
+
+func (s *Server) auditOp(action, who string, at time.Time, o policy.Override) (clientv3.Op, error) {
+	data, err := json.Marshal(policy.OverrideEvent{
+		Action:        action,
+		Actor:         who,
+		Authenticated: len(s.config.Control.OperatorTokens) > 0,
+		At:            at,
+		Override:      o,
+	})
+	if err != nil {
+		return clientv3.Op{}, err
+	}
+	return clientv3.OpPut(auditKey(o.TenantID, at, o.ID), string(data)), nil
+}
+
+// createOverride grants a temporary limit for one of a tenant's resources:
+//
+//	POST /api/v1/tenants/:tenant_id/overrides
+//	Authorization: Bearer <alice's operator token>
+//	{"resource": "search", "limit": 1200, "end": "2024-06-03T00:00:00Z", "reason": "launch"}
+//
+// start defaults to now. The override is stored on a lease that outlives
+// its end by a minute, and the grant is recorded in the audit trail.
+func (s *Server) createOverride(c *gin.Context) {
+	who, ok := s.actor(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Resource string        `json:"resource"`
+		Limit    int64         `json:"limit"`
+		Burst    int64         `json:"burst"`
+		Window   time.Duration `json:"window"`
+		Start    time.Time     `json:"start"`
+		End      time.Time     `json:"end"`
+		Reason   string        `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().UTC()
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		s.logger.Error("Failed to generate override ID", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate override ID"})
+		return
+	}
+	o := policy.Override{
+		ID:        hex.EncodeToString(b[:]),
+		TenantID:  c.Param("tenant_id"),
+		Resource:  req.Resource,
+		Limit:     req.Limit,
+		Burst:     req.Burst,
+		Window:    req.Window,
+		Start:     req.Start.UTC(),
+		End:       req.End.UTC(),
+		Reason:    req.Reason,
+		GrantedBy: who,
+		Created:   now,
+	}
+	if o.Resource == "" {
+		o.Resource = "default"
+	}
+	if o.Start.IsZero() {
+		o.Start = now
+	}
+	if err := o.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !o.End.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "override must end in the future"})
+		return
+	}
+	if longest := s.config.Control.MaxOverrideDuration; longest > 0 && o.End.Sub(o.Start) > longest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("override may last at most %s", longest)})
+		return
+	}
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal override"})
+		return
+	}
+	audit, err := s.auditOp(policy.OverrideGranted, who, now, o)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal audit event"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	ttl := o.End.Sub(now) + overrideLeaseGrace
+	lease, err := s.etcd.Grant(ctx, int64(ttl/time.Second)+1)
+	if err != nil {
+		s.logger.Error("Failed to grant override lease", "tenant_id", o.TenantID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store override"})
+		return
+	}
+	_, err = s.etcd.Txn(ctx).Then(
+		clientv3.OpPut(policy.OverrideKey(o.TenantID, o.ID), string(data), clientv3.WithLease(lease.ID)),
+		audit,
+	).Commit()
+	if err != nil {
+		s.logger.Error("Failed to store override", "tenant_id", o.TenantID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store override"})
+		return
+	}
+
+	s.logger.Info("Granted override",
+		"tenant_id", o.TenantID,
+		"resource", o.Resource,
+		"override", o.ID,
+		"limit", o.Limit,
+		"start", o.Start,
+		"end", o.End,
+		"actor", who,
+		"reason", o.Reason,
+	)
+	c.JSON(http.StatusCreated, o)
+}
+
+// listOverrides lists a tenant's current and upcoming overrides, earliest
+// start first.
+func (s *Server) listOverrides(c *gin.Context) {
+	tenantID := c.Param("tenant_id")
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := s.etcd.Get(ctx, policy.OverridePrefix+tenantID+"/", clientv3.WithPrefix())
+	if err != nil {
+		s.logger.Error("Failed to list overrides", "tenant_id", tenantID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list overrides"})
+		return
+	}
+
+	now := time.Now()
+	overrides := make([]policy.Override, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var o policy.Override
+		if err := json.Unmarshal(kv.Value, &o); err != nil {
+			s.logger.Warn("Failed to parse override", "key", string(kv.Key), "error", err)
+			continue
+		}
+		if o.End.After(now) {
+			overrides = append(overrides, o)
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Start.Before(overrides[j].Start) })
+
+	c.JSON(http.StatusOK, gin.H{
+		"overrides": overrides,
+		"count":     len(overrides),
+	})
+}
+
+// revokeOverride ends an override early and records who did.
+func (s *Server) revokeOverride(c *gin.Context) {
+	who, ok := s.actor(c)
+	if !ok {
+		return
+	}
+	tenantID, id := c.Param("tenant_id"), c.Param("override_id")
+	key := policy.OverrideKey(tenantID, id)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := s.etcd.Get(ctx, key)
+	if err != nil {
+		s.logger.Error("Failed to get override", "tenant_id", tenantID, "override", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve override"})
+		return
+	}
+	if len(resp.Kvs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "override not found"})
+		return
+	}
+	var o policy.Override
+	if err := json.Unmarshal(resp.Kvs[0].Value, &o); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse override"})
+		return
+	}
+
+	audit, err := s.auditOp(policy.OverrideRevoked, who, time.Now().UTC(), o)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal audit event"})
+		return
+	}
+	// Only revoke the version that was read, so a concurrent revocation
+	// is not audited twice.
+	txn, err := s.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)).
+		Then(clientv3.OpDelete(key), audit).
+		Commit()
+	if err != nil {
+		s.logger.Error("Failed to revoke override", "tenant_id", tenantID, "override", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke override"})
+		return
+	}
+	if !txn.Succeeded {
+		c.JSON(http.StatusNotFound, gin.H{"error": "override not found"})
+		return
+	}
+
+	s.logger.Info("Revoked override", "tenant_id", tenantID, "override", id, "actor", who)
+	c.Status(http.StatusNoContent)
+}
+
+// getOverrideAudit returns a tenant's override audit trail, oldest first.
+func (s *Server) getOverrideAudit(c *gin.Context) {
+	tenantID := c.Param("tenant_id")
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := s.etcd.Get(ctx, policy.OverrideAuditPrefix+tenantID+"/",
+		clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		s.logger.Error("Failed to read override audit trail", "tenant_id", tenantID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read audit trail"})
+		return
+	}
+
+	events := make([]policy.OverrideEvent, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var ev policy.OverrideEvent
+		if err := json.Unmarshal(kv.Value, &ev); err != nil {
+			s.logger.Warn("Failed to parse override audit event", "key", string(kv.Key), "error", err)
+			continue
+		}
+		events = append(events, ev)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
+}
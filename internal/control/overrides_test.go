@@ -0,0 +1,52 @@
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xizzxy/helios/internal/config"
+)
+
+func TestActor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := map[string]string{"alice": "alice-token", "bob": "bob-token"}
+	for _, tc := range []struct {
+		name    string
+		tokens  map[string]string
+		headers map[string]string
+		want    string
+		status  int
+	}{
+		{name: "token", tokens: tokens, headers: map[string]string{"Authorization": "Bearer bob-token"}, want: "bob"},
+		{name: "claimed name ignored", tokens: tokens, headers: map[string]string{"X-Helios-Actor": "alice"}, status: http.StatusUnauthorized},
+		{name: "unknown token", tokens: tokens, headers: map[string]string{"Authorization": "Bearer guess", "X-Helios-Actor": "alice"}, status: http.StatusUnauthorized},
+		{name: "self-reported", headers: map[string]string{"X-Helios-Actor": "carol"}, want: "carol"},
+		{name: "self-reported missing", status: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Control.OperatorTokens = tc.tokens
+			s := &Server{config: cfg}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/tenants/acme/overrides", nil)
+			for k, v := range tc.headers {
+				c.Request.Header.Set(k, v)
+			}
+			who, ok := s.actor(c)
+			if tc.status != 0 {
+				if ok || w.Code != tc.status {
+					t.Errorf("actor = %q, %v with status %d, want status %d", who, ok, w.Code, tc.status)
+				}
+				return
+			}
+			if !ok || who != tc.want {
+				t.Errorf("actor = %q, %v, want %q", who, ok, tc.want)
+			}
+		})
+	}
+}
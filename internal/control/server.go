@@ -12,6 +12,11 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 
 	"github.com/xizzxy/helios/internal/config"
+	"github.com/xizzxy/helios/internal/diagnostics"
+	"github.com/xizzxy/helios/internal/metrics"
+	"github.com/xizzxy/helios/internal/policy"
+	"github.com/xizzxy/helios/internal/tracing"
+	"github.com/xizzxy/helios/internal/usage"
 )
 
 type Server struct {
@@ -19,53 +24,82 @@ type Server struct {
 	logger     *slog.Logger
 	etcd       *clientv3.Client
 	httpServer *http.Server
-}
-
-type TenantConfig struct {
-	TenantID  string           `json:"tenant_id"`
-	Limits    map[string]Limit `json:"limits"`
-	APIKeys   []string         `json:"api_keys"`
-	Algorithm string           `json:"algorithm"` // "token_bucket" or "sliding_window"
-	Mode      string           `json:"mode"`      // "fast" or "strong"
-	Created   time.Time        `json:"created"`
-	Updated   time.Time        `json:"updated"`
-}
-
-type Limit struct {
-	Limit  int64         `json:"limit"`
-	Window time.Duration `json:"window"`
-	Burst  int64         `json:"burst"`
+	metrics    *metrics.Metrics
+	metricsSrv *http.Server
+	usage      usage.Store
+	diag       *diagnostics.Server
 }
 
 func NewServer(cfg *config.Config, logger *slog.Logger) (*Server, error) {
+	tlsCfg, err := cfg.Etcd.TLS.ClientTLS()
+	if err != nil {
+		return nil, fmt.Errorf("etcd tls: %w", err)
+	}
+	if tlsCfg == nil && cfg.Etcd.Username != "" {
+		logger.Warn("etcd credentials are sent without TLS; set HELIOS_ETCD_TLS_ENABLED=true")
+	}
+	if len(cfg.Control.OperatorTokens) == 0 {
+		logger.Warn("Override actors are self-reported; set HELIOS_CONTROL_OPERATOR_TOKENS to authenticate them")
+	}
+
 	// Connect to etcd
 	etcdClient, err := clientv3.New(clientv3.Config{
 		Endpoints:   cfg.Etcd.Endpoints,
 		DialTimeout: cfg.Etcd.DialTimeout,
 		Username:    cfg.Etcd.Username,
 		Password:    cfg.Etcd.Password,
+		TLS:         tlsCfg,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to etcd: %w", err)
 	}
 
-	return &Server{
-		config: cfg,
-		logger: logger,
-		etcd:   etcdClient,
-	}, nil
+	s := &Server{
+		config:  cfg,
+		logger:  logger,
+		etcd:    etcdClient,
+		metrics: metrics.New(),
+		usage:   usage.NewEtcdStore(etcdClient, nil),
+		diag:    diagnostics.New(cfg.Observability.ProfilingToken),
+	}
+	s.diag.Add("config", func() any {
+		return map[string]any{
+			"fingerprint":     cfg.Fingerprint(),
+			"service_version": cfg.Observability.ServiceVersion,
+		}
+	})
+	s.diag.Add("etcd", s.etcdDiagnostics)
+	return s, nil
+}
+
+// etcdDiagnostics reports the store revision and how many tenants it holds.
+func (s *Server) etcdDiagnostics() any {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	out := map[string]any{"endpoints": s.config.Etcd.Endpoints}
+	resp, err := s.etcd.Get(ctx, policy.TenantPrefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		out["error"] = err.Error()
+		return out
+	}
+	out["revision"] = resp.Header.Revision
+	out["tenants"] = resp.Count
+	return out
 }
 
 func (s *Server) Start(ctx context.Context) error {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 	router.Use(gin.Recovery())
+	router.Use(tracing.Middleware())
 
 	// Add logging middleware
 	router.Use(func(c *gin.Context) {
 		start := time.Now()
 		c.Next()
 
+		s.metrics.ObserveHTTP(c.FullPath(), c.Request.Method, c.Writer.Status(), time.Since(start))
 		s.logger.Info("HTTP request",
 			"method", c.Request.Method,
 			"path", c.Request.URL.Path,
@@ -86,6 +120,11 @@ func (s *Server) Start(ctx context.Context) error {
 		api.PUT("/tenants/:tenant_id", s.updateTenant)
 		api.DELETE("/tenants/:tenant_id", s.deleteTenant)
 		api.GET("/tenants", s.listTenants)
+		api.GET("/tenants/:tenant_id/usage", s.getUsage)
+		api.POST("/tenants/:tenant_id/overrides", s.createOverride)
+		api.GET("/tenants/:tenant_id/overrides", s.listOverrides)
+		api.GET("/tenants/:tenant_id/overrides/audit", s.getOverrideAudit)
+		api.DELETE("/tenants/:tenant_id/overrides/:override_id", s.revokeOverride)
 	}
 
 	s.httpServer = &http.Server{
@@ -101,6 +140,22 @@ func (s *Server) Start(ctx context.Context) error {
 		}
 	}()
 
+	if s.config.Observability.MetricsEnabled {
+		s.metricsSrv = &http.Server{
+			Addr:    s.config.Observability.MetricsAddress,
+			Handler: s.metrics.Handler(),
+		}
+		go func() {
+			if err := s.metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.logger.Error("Metrics server error", "error", err)
+			}
+		}()
+	}
+
+	if s.config.Observability.EnableProfiling {
+		s.diag.Start(s.config.Observability.ProfilingAddress, s.logger)
+	}
+
 	s.logger.Info("Control plane server started", "address", s.config.Control.Address)
 	return nil
 }
@@ -114,6 +169,15 @@ func (s *Server) Stop(ctx context.Context) error {
 		}
 	}
 
+	if s.metricsSrv != nil {
+		if err := s.metricsSrv.Shutdown(ctx); err != nil {
+			s.logger.Error("Metrics server shutdown error", "error", err)
+		}
+	}
+	if err := s.diag.Shutdown(ctx); err != nil {
+		s.logger.Error("Diagnostics server shutdown error", "error", err)
+	}
+
 	if s.etcd != nil {
 		return s.etcd.Close()
 	}
@@ -144,7 +208,7 @@ func (s *Server) healthHandler(c *gin.Context) {
 }
 
 func (s *Server) createTenant(c *gin.Context) {
-	var tenantConfig TenantConfig
+	var tenantConfig policy.TenantConfig
 	if err := c.ShouldBindJSON(&tenantConfig); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -161,7 +225,7 @@ func (s *Server) createTenant(c *gin.Context) {
 		tenantConfig.Mode = "fast"
 	}
 	if tenantConfig.Limits == nil {
-		tenantConfig.Limits = map[string]Limit{
+		tenantConfig.Limits = map[string]policy.Limit{
 			"default": {
 				Limit:  100,
 				Window: time.Minute,
@@ -170,8 +234,13 @@ func (s *Server) createTenant(c *gin.Context) {
 		}
 	}
 
+	if err := tenantConfig.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Store in etcd
-	key := fmt.Sprintf("/helios/tenants/%s", tenantConfig.TenantID)
+	key := policy.TenantKey(tenantConfig.TenantID)
 	data, err := json.Marshal(tenantConfig)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal config"})
@@ -194,7 +263,7 @@ func (s *Server) createTenant(c *gin.Context) {
 func (s *Server) getTenant(c *gin.Context) {
 	tenantID := c.Param("tenant_id")
 
-	key := fmt.Sprintf("/helios/tenants/%s", tenantID)
+	key := policy.TenantKey(tenantID)
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
@@ -210,7 +279,7 @@ func (s *Server) getTenant(c *gin.Context) {
 		return
 	}
 
-	var tenantConfig TenantConfig
+	var tenantConfig policy.TenantConfig
 	if err := json.Unmarshal(resp.Kvs[0].Value, &tenantConfig); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse config"})
 		return
@@ -222,14 +291,14 @@ func (s *Server) getTenant(c *gin.Context) {
 func (s *Server) updateTenant(c *gin.Context) {
 	tenantID := c.Param("tenant_id")
 
-	var updates TenantConfig
+	var updates policy.TenantConfig
 	if err := c.ShouldBindJSON(&updates); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Get existing config
-	key := fmt.Sprintf("/helios/tenants/%s", tenantID)
+	key := policy.TenantKey(tenantID)
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
@@ -245,7 +314,7 @@ func (s *Server) updateTenant(c *gin.Context) {
 		return
 	}
 
-	var tenantConfig TenantConfig
+	var tenantConfig policy.TenantConfig
 	if err := json.Unmarshal(resp.Kvs[0].Value, &tenantConfig); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse config"})
 		return
@@ -266,6 +335,11 @@ func (s *Server) updateTenant(c *gin.Context) {
 	}
 	tenantConfig.Updated = time.Now().UTC()
 
+	if err := tenantConfig.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Store updated config
 	data, err := json.Marshal(tenantConfig)
 	if err != nil {
@@ -286,7 +360,7 @@ func (s *Server) updateTenant(c *gin.Context) {
 func (s *Server) deleteTenant(c *gin.Context) {
 	tenantID := c.Param("tenant_id")
 
-	key := fmt.Sprintf("/helios/tenants/%s", tenantID)
+	key := policy.TenantKey(tenantID)
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
@@ -301,7 +375,7 @@ func (s *Server) deleteTenant(c *gin.Context) {
 }
 
 func (s *Server) listTenants(c *gin.Context) {
-	prefix := "/helios/tenants/"
+	prefix := policy.TenantPrefix
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
@@ -312,9 +386,9 @@ func (s *Server) listTenants(c *gin.Context) {
 		return
 	}
 
-	tenants := make([]TenantConfig, 0, len(resp.Kvs))
+	tenants := make([]policy.TenantConfig, 0, len(resp.Kvs))
 	for _, kv := range resp.Kvs {
-		var tenantConfig TenantConfig
+		var tenantConfig policy.TenantConfig
 		if err := json.Unmarshal(kv.Value, &tenantConfig); err != nil {
 			s.logger.Warn("Failed to parse tenant config", "key", string(kv.Key), "error", err)
 			continue
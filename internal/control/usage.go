@@ -0,0 +1,131 @@
+package control
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xizzxy/helios/internal/usage"
+)
+
+// maxUsageBuckets bounds one usage report; coarser granularities cover
+// longer ranges.
+const maxUsageBuckets = 10000
+
+// usageTotals sums a report.
+type usageTotals struct {
+	Consumed int64 `json:"consumed"`
+	Denied   int64 `json:"denied"`
+	Allowed  int64 `json:"allowed_requests"`
+	Rejected int64 `json:"denied_requests"`
+}
+
+// getUsage reports a tenant's metered usage. from and to accept RFC 3339 or
+// unix seconds and default to the last 24 hours; granularity is minute,
+// hour (the default) or day. format=csv, or an Accept header asking for
+// text/csv, returns CSV instead of JSON.
+func (s *Server) getUsage(c *gin.Context) {
+	tenantID := c.Param("tenant_id")
+
+	g, err := usage.ParseGranularity(c.DefaultQuery("granularity", string(usage.Hour)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to := time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		if to, err = parseTime(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to parameter"})
+			return
+		}
+	}
+	from := to.Add(-24 * time.Hour)
+	if v := c.Query("from"); v != "" {
+		if from, err = parseTime(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from parameter"})
+			return
+		}
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	if to.Sub(from)/g.Duration() > maxUsageBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("range spans more than %d %s buckets; use a coarser granularity", maxUsageBuckets, g)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	buckets, err := s.usage.Query(ctx, tenantID, g, from, to)
+	if err != nil {
+		s.logger.Error("Failed to query usage", "tenant_id", tenantID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query usage"})
+		return
+	}
+
+	if c.Query("format") == "csv" || (c.Query("format") == "" && strings.Contains(c.GetHeader("Accept"), "text/csv")) {
+		writeUsageCSV(c, tenantID, g, buckets)
+		return
+	}
+
+	var totals usageTotals
+	for _, b := range buckets {
+		for _, r := range b.Rows {
+			totals.Consumed += r.Consumed
+			totals.Denied += r.Denied
+			totals.Allowed += r.Allowed
+			totals.Rejected += r.Rejected
+		}
+	}
+	if buckets == nil {
+		buckets = []usage.Bucket{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tenant_id":   tenantID,
+		"granularity": g,
+		"from":        from,
+		"to":          to,
+		"buckets":     buckets,
+		"totals":      totals,
+	})
+}
+
+func writeUsageCSV(c *gin.Context, tenantID string, g usage.Granularity, buckets []usage.Bucket) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "usage-"+tenantID+"-"+string(g)+".csv"))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"bucket_start", "bucket_end", "tenant_id", "resource", "key", "consumed", "denied", "allowed_requests", "denied_requests"})
+	for _, b := range buckets {
+		start := b.Start.Format(time.RFC3339)
+		end := b.Start.Add(g.Duration()).Format(time.RFC3339)
+		for _, r := range b.Rows {
+			w.Write([]string{
+				start, end, tenantID, r.Resource, r.Key,
+				strconv.FormatInt(r.Consumed, 10),
+				strconv.FormatInt(r.Denied, 10),
+				strconv.FormatInt(r.Allowed, 10),
+				strconv.FormatInt(r.Rejected, 10),
+			})
+		}
+	}
+	w.Flush()
+}
+
+// parseTime accepts RFC 3339 or unix seconds.
+func parseTime(v string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t.UTC(), err
+}
@@ -0,0 +1,200 @@
+// Package decisionlog records every rate limit decision for audit and
+// billing. Events are queued without blocking the caller and written to
+// sinks in batches by a background goroutine; when the queue is full they
+// are dropped and counted instead.
+package decisionlog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is one decision.
+type Event struct {
+	Time      time.Time `json:"ts"`
+	Tenant    string    `json:"tenant"`
+	Resource  string    `json:"resource"`
+	KeyPrefix string    `json:"key_prefix"`
+	Cost      int64     `json:"cost"`
+	Result    string    `json:"result"` // "allowed" or "denied"
+	Remaining int64     `json:"remaining"`
+	PolicyID  string    `json:"policy_id"`
+	Mode      string    `json:"mode"` // "enforce", or "shadow" for decisions that were not applied
+	Degraded  bool      `json:"degraded,omitempty"`
+	Instance  string    `json:"instance"`
+}
+
+// Sink persists batches of events. Write is only ever called from the
+// pipeline goroutine.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// Options size the pipeline.
+type Options struct {
+	BufferSize    int           // queued events before new ones are dropped
+	BatchSize     int           // events per sink write
+	FlushInterval time.Duration // longest an event waits for a full batch
+	WriteTimeout  time.Duration // deadline for one sink write
+}
+
+// Stats counts events since the pipeline started.
+type Stats struct {
+	Written uint64 `json:"written"` // delivered to every sink
+	Dropped uint64 `json:"dropped"` // rejected because the queue was full
+	Failed  uint64 `json:"failed"`  // lost by at least one sink
+}
+
+// Pipeline batches events to its sinks.
+type Pipeline struct {
+	opts   Options
+	sinks  []Sink
+	logger *slog.Logger
+	queue  chan Event
+	done   chan struct{} // closed once the queue is drained and the sinks closed
+
+	closeErr error // from closing the sinks, set before done is closed
+
+	mu      sync.RWMutex // guards closed against Log racing Close
+	closed  bool
+	written atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// New starts a pipeline writing to sinks.
+func New(opts Options, logger *slog.Logger, sinks ...Sink) *Pipeline {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 10000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 5 * time.Second
+	}
+	p := &Pipeline{
+		opts:   opts,
+		sinks:  sinks,
+		logger: logger,
+		queue:  make(chan Event, opts.BufferSize),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Log queues e and never blocks; it reports false when e was dropped,
+// including after Close.
+func (p *Pipeline) Log(e Event) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.dropped.Add(1)
+		return false
+	}
+	select {
+	case p.queue <- e:
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Written: p.written.Load(),
+		Dropped: p.dropped.Load(),
+		Failed:  p.failed.Load(),
+	}
+}
+
+func (p *Pipeline) run() {
+	defer close(p.done)
+	// The sinks are closed here, after their last write, so that they are
+	// closed even if every Close call gave up waiting.
+	defer func() { p.closeErr = p.closeSinks() }()
+
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, p.opts.BatchSize)
+	for {
+		select {
+		case e, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= p.opts.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func (p *Pipeline) flush(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	failed := false
+	for _, sink := range p.sinks {
+		ctx, cancel := context.WithTimeout(context.Background(), p.opts.WriteTimeout)
+		err := sink.Write(ctx, batch)
+		cancel()
+		if err != nil {
+			failed = true
+			p.logger.Error("Decision log write failed", "sink", sink.Name(), "events", len(batch), "error", err)
+		}
+	}
+	if failed {
+		p.failed.Add(uint64(len(batch)))
+		return
+	}
+	p.written.Add(uint64(len(batch)))
+}
+
+// Close stops accepting events, writes what is queued and closes the sinks.
+// If ctx ends first it returns ctx.Err(); the sinks are still closed once
+// the queue drains, and a later Close waits for that.
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	select {
+	case <-p.done:
+		return p.closeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pipeline) closeSinks() error {
+	var errs []error
+	for _, sink := range p.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
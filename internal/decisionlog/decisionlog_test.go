@@ -0,0 +1,246 @@
+package decisionlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/config"
+	"github.com/xizzxy/helios/internal/resilience"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// blockingSink holds every write until release is closed.
+type blockingSink struct {
+	release chan struct{}
+	mu      sync.Mutex
+	events  []Event
+	closed  bool
+}
+
+func (s *blockingSink) Name() string { return "blocking" }
+
+func (s *blockingSink) Write(ctx context.Context, events []Event) error {
+	<-s.release
+	s.mu.Lock()
+	s.events = append(s.events, events...)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *blockingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestLogDropsWhenFull(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	p := New(Options{BufferSize: 4, BatchSize: 1, FlushInterval: time.Hour}, discard, sink)
+
+	// The first event is taken by the writer, which then blocks; the
+	// buffer holds four more and the rest must be dropped, not wait.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			p.Log(Event{Tenant: "acme", Cost: int64(i)})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Log blocked on a slow sink")
+	}
+
+	close(sink.release)
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	st := p.Stats()
+	if st.Written+st.Dropped != 100 {
+		t.Errorf("stats = %+v, want written+dropped = 100", st)
+	}
+	if st.Dropped < 90 {
+		t.Errorf("dropped %d events, want at least 90", st.Dropped)
+	}
+	if len(sink.events) != int(st.Written) {
+		t.Errorf("sink got %d events, stats say %d written", len(sink.events), st.Written)
+	}
+	if p.Log(Event{}) {
+		t.Error("Log accepted an event after Close")
+	}
+}
+
+func TestCloseAfterTimeoutClosesSinks(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	p := New(Options{BatchSize: 1, FlushInterval: time.Hour}, discard, sink)
+	p.Log(Event{Tenant: "acme"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Close with a stuck sink = %v, want DeadlineExceeded", err)
+	}
+
+	close(sink.release)
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if !sink.closed || len(sink.events) != 1 {
+		t.Errorf("sink closed = %v with %d events, want closed after the queued event", sink.closed, len(sink.events))
+	}
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	sink, err := NewFileSink(path, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		err := sink.Write(context.Background(), []Event{{Tenant: "acme", Resource: "search", Cost: int64(i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 300 {
+			t.Errorf("%s is %d bytes, want at most 300", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept more than 2 backups: %v", err)
+	}
+
+	// The live file holds the newest events as whole JSON lines.
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var last Event
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		if err := json.Unmarshal(sc.Bytes(), &last); err != nil {
+			t.Fatalf("bad line %q: %v", sc.Text(), err)
+		}
+	}
+	if last.Cost != 19 {
+		t.Errorf("last event cost = %d, want 19", last.Cost)
+	}
+}
+
+func TestFileSinkRecoversFromFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	sink, err := NewFileSink(path, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	write := func(cost int64) error {
+		return sink.Write(context.Background(), []Event{{Tenant: "acme", Resource: "search", Cost: cost}})
+	}
+	if err := write(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A non-empty directory where the backup goes makes the rename fail.
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(1); err == nil {
+		t.Fatal("rotation into a blocked backup succeeded")
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(2); err != nil {
+		t.Fatalf("write after the failed rotation: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last Event
+	if err := json.Unmarshal(data, &last); err != nil || last.Cost != 2 {
+		t.Errorf("live file = %q, want only the newest event", data)
+	}
+}
+
+func TestWebhookSinkRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		statuses []int // responses in order; 200 once they run out
+		wantErr  bool
+		requests int
+	}{
+		{"transient failures", []int{503, 429}, false, 3},
+		{"rejected", []int{400}, true, 1},
+		{"out of retries", []int{500, 500, 500, 500}, true, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests < len(tc.statuses) {
+					w.WriteHeader(tc.statuses[requests])
+				}
+				requests++
+			}))
+			defer srv.Close()
+
+			retry := resilience.NewRetryPolicy(config.RetryConfig{Enabled: true, MaxRetries: 3, InitialInterval: time.Millisecond})
+			err := NewWebhookSink(srv.URL, "", retry).Write(context.Background(), []Event{{Tenant: "acme"}})
+			if (err != nil) != tc.wantErr {
+				t.Errorf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if requests != tc.requests {
+				t.Errorf("%d requests, want %d", requests, tc.requests)
+			}
+		})
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	batch := []Event{{Tenant: "acme", Result: "denied"}, {Tenant: "globex", Result: "allowed"}}
+	if err := NewWebhookSink(srv.URL, "secret", nil).Write(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Result != "denied" {
+		t.Errorf("webhook received %+v", got)
+	}
+	if err := NewWebhookSink(srv.URL, "wrong", nil).Write(context.Background(), batch); err == nil {
+		t.Error("expected an error for a non-2xx response")
+	}
+}
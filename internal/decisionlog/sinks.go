@@ -0,0 +1,225 @@
+package decisionlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/xizzxy/helios/internal/resilience"
+)
+
+// WriterSink writes events as JSON lines to w, typically os.Stdout.
+type WriterSink struct {
+	name string
+	w    io.Writer
+}
+
+func NewWriterSink(name string, w io.Writer) *WriterSink {
+	return &WriterSink{name: name, w: w}
+}
+
+func (s *WriterSink) Name() string { return s.name }
+
+func (s *WriterSink) Write(ctx context.Context, events []Event) error {
+	bw := bufio.NewWriter(s.w)
+	enc := json.NewEncoder(bw)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (s *WriterSink) Close() error { return nil }
+
+// FileSink appends JSON lines to a file and rotates it once it grows past
+// maxBytes, keeping maxBackups older files as path.1 (newest) to path.N.
+type FileSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	f    *os.File // nil when reopening after a rotation failed
+	size int64
+}
+
+func NewFileSink(path string, maxBytes int64, maxBackups int) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("decision log directory: %w", err)
+	}
+	s := &FileSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) Name() string { return "file" }
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open decision log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat decision log: %w", err)
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(ctx context.Context, events []Event) error {
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range events {
+		buf.Reset()
+		if err := enc.Encode(&events[i]); err != nil {
+			return err
+		}
+		if s.maxBytes > 0 && s.size > 0 && s.size+int64(buf.Len()) > s.maxBytes {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+		n, err := s.f.Write(buf.Bytes())
+		s.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	// Audit and billing records should survive a crash once written.
+	return s.f.Sync()
+}
+
+// rotate moves the file aside and opens a new one. If the backups cannot
+// be shifted it reopens the current file instead, so later writes still
+// land and try again to rotate.
+func (s *FileSink) rotate() error {
+	err := s.f.Close()
+	s.f = nil
+	if err == nil {
+		err = s.shift()
+	}
+	if openErr := s.open(); err == nil {
+		err = openErr
+	}
+	return err
+}
+
+func (s *FileSink) shift() error {
+	if s.maxBackups <= 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		err := os.Rename(backupName(s.path, i), backupName(s.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(s.path, backupName(s.path, 1))
+}
+
+func backupName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func (s *FileSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	if err := s.f.Sync(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// WebhookSink POSTs each batch as a JSON array. A batch that fails with a
+// network error, 429 or a 5xx is sent again with backoff until the sink
+// write times out, so a receiver may see a batch twice.
+type WebhookSink struct {
+	url    string
+	token  string
+	retry  *resilience.RetryPolicy
+	client *http.Client
+}
+
+// NewWebhookSink posts to url, sending token as a bearer token when set,
+// and retries failed posts with retry, which may be nil.
+func NewWebhookSink(url, token string, retry *resilience.RetryPolicy) *WebhookSink {
+	return &WebhookSink{url: url, token: token, retry: retry, client: &http.Client{}}
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) Write(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return s.retry.Do(ctx, retryablePost, nil, func() error {
+		return s.post(ctx, body)
+	})
+}
+
+func (s *WebhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+	return nil
+}
+
+// statusError is a non-2xx webhook response.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string { return "webhook returned " + e.status }
+
+// retryablePost retries failed requests and responses that ask for a
+// later attempt, but not other rejections, which would fail again.
+func retryablePost(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code == http.StatusTooManyRequests || se.code >= 500
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
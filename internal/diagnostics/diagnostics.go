@@ -0,0 +1,135 @@
+// Package diagnostics serves runtime diagnostics on a listener of their
+// own: net/http/pprof, expvar, a goroutine dump and a JSON view of the
+// service's internals. It is meant for operators, so it can require a
+// bearer token.
+package diagnostics
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"sync"
+	"time"
+)
+
+// Section reports one part of the service's internals. It is called on
+// every request to /debug/internals and must be safe for concurrent use.
+type Section func() any
+
+// Server is the diagnostics listener.
+type Server struct {
+	token   string
+	started time.Time
+	srv     *http.Server
+
+	mu       sync.RWMutex
+	sections map[string]Section
+}
+
+// New returns diagnostics that require token as a bearer token, unless it
+// is empty.
+func New(token string) *Server {
+	return &Server{token: token, started: time.Now(), sections: make(map[string]Section)}
+}
+
+// Add reports f under name in /debug/internals.
+func (s *Server) Add(name string, f Section) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sections[name] = f
+}
+
+// Start listens on addr in the background.
+func (s *Server) Start(addr string, logger *slog.Logger) {
+	if s.token == "" {
+		logger.Warn("Diagnostics server is unauthenticated; set HELIOS_PROFILING_TOKEN", "address", addr)
+	}
+	s.srv = &http.Server{Addr: addr, Handler: s.Handler()}
+	go func() {
+		logger.Info("Starting diagnostics server", "address", addr)
+		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Diagnostics server error", "error", err)
+		}
+	}()
+}
+
+// Shutdown stops the listener, if it was started.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Shutdown(ctx)
+}
+
+// Handler serves:
+//
+//	/debug/pprof/     profiles (net/http/pprof)
+//	/debug/vars       expvar
+//	/debug/goroutines full goroutine dump
+//	/debug/internals  JSON from every section
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", goroutines)
+	mux.HandleFunc("/debug/internals", s.internals)
+	if s.token == "" {
+		return mux
+	}
+	return s.authenticate(mux)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	want := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="helios-diagnostics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func (s *Server) internals(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	sections := make(map[string]Section, len(s.sections))
+	for name, f := range s.sections {
+		sections[name] = f
+	}
+	s.mu.RUnlock()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	out := map[string]any{
+		"timestamp":  time.Now().UTC(),
+		"uptime":     time.Since(s.started).Round(time.Second).String(),
+		"goroutines": runtime.NumGoroutine(),
+		"heap_bytes": mem.HeapAlloc,
+		"go_version": runtime.Version(),
+	}
+	for name, f := range sections {
+		out[name] = f()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
@@ -0,0 +1,40 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenRequired(t *testing.T) {
+	d := New("s3cret")
+	d.Add("limiter", func() any { return map[string]int{"tracked_keys": 7} })
+	h := d.Handler()
+
+	for _, path := range []string{"/debug/internals", "/debug/pprof/", "/debug/vars", "/debug/goroutines"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s without token: status %d, want 401", path, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/internals", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	var body struct {
+		Goroutines int            `json:"goroutines"`
+		Limiter    map[string]int `json:"limiter"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Goroutines == 0 || body.Limiter["tracked_keys"] != 7 {
+		t.Errorf("internals = %s", rec.Body)
+	}
+}
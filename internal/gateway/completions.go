@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/xizzxy/helios/internal/limiter"
+)
+
+// pendingCalls holds the completions of calls admitted by adaptive
+// policies until the caller reports back through /api/v1/complete. A call
+// not reported within the timeout counts as dropped: it most likely hung
+// upstream.
+type pendingCalls struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*pendingCall
+
+	completed [3]atomic.Uint64 // by limiter.Outcome
+	expired   atomic.Uint64
+}
+
+type pendingCall struct {
+	complete limiter.Completion
+	timer    *time.Timer
+}
+
+func newPendingCalls(timeout time.Duration) *pendingCalls {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &pendingCalls{timeout: timeout, calls: make(map[string]*pendingCall)}
+}
+
+// add registers complete and returns the token the caller reports with.
+func (p *pendingCalls) add(complete limiter.Completion) string {
+	var b [16]byte
+	rand.Read(b[:])
+	token := hex.EncodeToString(b[:])
+
+	call := &pendingCall{complete: complete}
+	p.mu.Lock()
+	p.calls[token] = call
+	call.timer = time.AfterFunc(p.timeout, func() {
+		if p.take(token) != nil {
+			p.expired.Add(1)
+			complete(limiter.OutcomeDropped, 0)
+		}
+	})
+	p.mu.Unlock()
+	return token
+}
+
+// take removes and returns the call for token, or nil if it is unknown,
+// already reported or expired.
+func (p *pendingCalls) take(token string) *pendingCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	call, ok := p.calls[token]
+	if !ok {
+		return nil
+	}
+	delete(p.calls, token)
+	return call
+}
+
+// complete reports the outcome of the call registered under token.
+func (p *pendingCalls) complete(token string, outcome limiter.Outcome, rtt time.Duration) bool {
+	call := p.take(token)
+	if call == nil {
+		return false
+	}
+	call.timer.Stop()
+	p.completed[outcome].Add(1)
+	call.complete(outcome, rtt)
+	return true
+}
+
+func (p *pendingCalls) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.calls)
+}
+
+var outcomes = map[string]limiter.Outcome{
+	"success": limiter.OutcomeSuccess,
+	"dropped": limiter.OutcomeDropped,
+	"ignored": limiter.OutcomeIgnored,
+}
+
+// handleComplete reports how a call admitted by an adaptive policy went:
+//
+//	POST /api/v1/complete {"token": "...", "outcome": "success", "latency_ms": 42}
+//
+// outcome is "success", "dropped" (a timeout or overload error from the
+// upstream) or "ignored" (a failure unrelated to load, or the call was not
+// made). Without latency_ms the time since the decision is used.
+func (s *Server) handleComplete(c *gin.Context) {
+	var req struct {
+		Token     string  `json:"token"`
+		Outcome   string  `json:"outcome"`
+		LatencyMS float64 `json:"latency_ms"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+	if req.Outcome == "" {
+		req.Outcome = "success"
+	}
+	outcome, ok := outcomes[req.Outcome]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "outcome must be success, dropped or ignored"})
+		return
+	}
+	if req.LatencyMS < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "latency_ms must not be negative"})
+		return
+	}
+
+	rtt := time.Duration(req.LatencyMS * float64(time.Millisecond))
+	if !s.pending.complete(req.Token, outcome, rtt) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown or expired token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"completed": true})
+}
@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/xizzxy/helios/internal/config"
+	"github.com/xizzxy/helios/internal/decisionlog"
+	"github.com/xizzxy/helios/internal/limiter"
+	"github.com/xizzxy/helios/internal/resilience"
+)
+
+// newDecisionLog builds the configured sinks and starts the pipeline.
+func newDecisionLog(cfg config.DecisionLogConfig, logger *slog.Logger) (*decisionlog.Pipeline, error) {
+	var sinks []decisionlog.Sink
+	for _, name := range cfg.Sinks {
+		switch name {
+		case "stdout":
+			sinks = append(sinks, decisionlog.NewWriterSink("stdout", os.Stdout))
+		case "file":
+			sink, err := decisionlog.NewFileSink(cfg.FilePath, int64(cfg.MaxFileSizeMB)<<20, cfg.MaxBackups)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case "webhook":
+			if cfg.WebhookURL == "" {
+				return nil, fmt.Errorf("decision log webhook sink needs a webhook URL")
+			}
+			// Retries back off from 100ms and stop at the write timeout.
+			retry := resilience.NewRetryPolicy(config.RetryConfig{
+				Enabled:         true,
+				MaxRetries:      cfg.WebhookRetries,
+				InitialInterval: 100 * time.Millisecond,
+				MaxInterval:     time.Second,
+				Multiplier:      2,
+			})
+			sinks = append(sinks, decisionlog.NewWebhookSink(cfg.WebhookURL, cfg.WebhookToken, retry))
+		default:
+			return nil, fmt.Errorf("unknown decision log sink %q (want stdout, file or webhook)", name)
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("decision log is enabled without sinks")
+	}
+
+	return decisionlog.New(decisionlog.Options{
+		BufferSize:    cfg.BufferSize,
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: cfg.FlushInterval,
+		WriteTimeout:  cfg.WriteTimeout,
+	}, logger, sinks...), nil
+}
+
+// logDecision queues one decision event when the decision log is enabled.
+func (s *Server) logDecision(tenant, resource, apiKey string, cost int64, policyID, mode string, res *limiter.Result) {
+	if s.decisions == nil {
+		return
+	}
+	s.decisions.Log(decisionlog.Event{
+		Time:      time.Now().UTC(),
+		Tenant:    tenant,
+		Resource:  resource,
+		KeyPrefix: keyPrefix(apiKey),
+		Cost:      cost,
+		Result:    outcome(res.Allowed),
+		Remaining: res.Remaining,
+		PolicyID:  policyID,
+		Mode:      mode,
+		Degraded:  res.Degraded,
+		Instance:  s.config.Gateway.DecisionLog.Instance,
+	})
+}
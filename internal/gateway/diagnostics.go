@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"github.com/xizzxy/helios/internal/diagnostics"
+	"github.com/xizzxy/helios/internal/limiter"
+)
+
+// policyKeys is the in-memory state of one policy limiter.
+type policyKeys struct {
+	Tenant   string            `json:"tenant"`
+	PolicyID string            `json:"policy_id"`
+	Keys     *limiter.KeyStats `json:"keys"`
+}
+
+// registerDiagnostics exposes the gateway's internals on the diagnostics
+// server.
+func (s *Server) registerDiagnostics() {
+	s.diag = diagnostics.New(s.config.Observability.ProfilingToken)
+
+	s.diag.Add("limiter", func() any {
+		out := map[string]any{
+			"consistency_mode": s.config.Gateway.ConsistencyMode,
+			"algorithm":        s.algorithm,
+			"tracked_keys":     s.localState.KeyStats(),
+			"pending_calls":    s.pending.len(),
+		}
+		if s.policies != nil {
+			var policies []policyKeys
+			for _, st := range s.policies.Stats() {
+				if st.Keys != nil {
+					policies = append(policies, policyKeys{st.Tenant, st.PolicyID, st.Keys})
+				}
+			}
+			out["policies"] = policies
+		}
+		return out
+	})
+	s.diag.Add("config", func() any {
+		out := map[string]any{
+			"fingerprint":     s.config.Fingerprint(),
+			"service_version": s.config.Observability.ServiceVersion,
+		}
+		if s.policies != nil {
+			out["policy_revision"] = s.policies.Revision()
+		}
+		return out
+	})
+	if s.redisStore != nil {
+		s.diag.Add("redis", func() any { return s.redisStore.Stats() })
+	}
+	if s.breaker != nil {
+		s.diag.Add("circuit_breaker", func() any {
+			return map[string]any{"state": s.breaker.State().String(), "transitions": s.breaker.Transitions()}
+		})
+	}
+	if s.shedder != nil {
+		s.diag.Add("load_shedding", func() any {
+			return map[string]any{"level": s.shedder.Level(), "signals": s.shedder.Signals()}
+		})
+	}
+	if s.bulkhead != nil {
+		s.diag.Add("bulkhead", func() any { return s.bulkhead.Stats() })
+	}
+	if s.node != nil {
+		s.diag.Add("cluster", func() any { return map[string]any{"members": s.node.Members()} })
+	}
+	if s.decisions != nil {
+		s.diag.Add("decision_log", func() any { return s.decisions.Stats() })
+	}
+}
@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	gatewaypb "github.com/xizzxy/helios/api/proto/gateway"
+	"github.com/xizzxy/helios/internal/policy"
+	"github.com/xizzxy/helios/internal/resilience"
+)
+
+// grpcGateway serves helios.gateway.v1.GatewayService, generated from
+// api/proto/gateway.proto, with the same checks as the REST API.
+type grpcGateway struct {
+	gatewaypb.UnimplementedGatewayServiceServer
+	s *Server
+}
+
+func (g grpcGateway) Allow(ctx context.Context, req *gatewaypb.AllowRequest) (*gatewaypb.AllowResponse, error) {
+	if req.Tenant == "" {
+		return nil, status.Error(codes.InvalidArgument, "tenant is required")
+	}
+	if !validAPIKey(req.ApiKey) {
+		return nil, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+	resource := req.Resource
+	if resource == "" {
+		resource = "default"
+	}
+	cost := req.Cost
+	if cost == 0 {
+		cost = 1
+	} else if cost < 0 {
+		return nil, status.Error(codes.InvalidArgument, "cost must be positive")
+	}
+	priority := resilience.PriorityNormal
+	if req.Priority != "" {
+		var err error
+		if priority, err = resilience.ParsePriority(req.Priority); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "priority must be low, normal or critical")
+		}
+	}
+
+	res, token, err := g.s.allow(ctx, req.Tenant, resource, req.ApiKey, int64(cost), priority)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "rate limit check failed")
+	}
+	return &gatewaypb.AllowResponse{
+		Allowed:           res.Allowed,
+		Remaining:         res.Remaining,
+		Limit:             res.Limit,
+		ResetTime:         timestamppb.New(res.ResetTime),
+		RetryAfterSeconds: res.RetryAfterSeconds,
+		RateLimitKey:      fmt.Sprintf("%s:%s", req.Tenant, resource),
+		CompletionToken:   token,
+		Degraded:          res.Degraded,
+	}, nil
+}
+
+func (g grpcGateway) GetQuota(ctx context.Context, req *gatewaypb.QuotaRequest) (*gatewaypb.QuotaResponse, error) {
+	if req.Tenant == "" {
+		return nil, status.Error(codes.InvalidArgument, "tenant is required")
+	}
+	if !validAPIKey(req.ApiKey) {
+		return nil, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+	resource := req.Resource
+	if resource == "" {
+		resource = "default"
+	}
+
+	res, decisions, err := g.s.quota(ctx, req.Tenant, resource, req.ApiKey)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "quota lookup failed")
+	}
+	resp := &gatewaypb.QuotaResponse{
+		Remaining:    res.Remaining,
+		Limit:        res.Limit,
+		ResetTime:    timestamppb.New(res.ResetTime),
+		RateLimitKey: fmt.Sprintf("%s:%s", req.Tenant, resource),
+	}
+	for _, d := range decisions {
+		pq := &gatewaypb.PolicyQuota{
+			PolicyId:   d.PolicyID,
+			Mode:       d.Mode,
+			Algorithm:  string(d.Algorithm),
+			Remaining:  d.Result.Remaining,
+			Limit:      d.Result.Limit,
+			ResetTime:  timestamppb.New(d.Result.ResetTime),
+			Priorities: make(map[string]*gatewaypb.PriorityQuota, len(d.Priorities)),
+			Profile:    d.Profile,
+			Override:   overrideProto(d.Override),
+		}
+		for _, q := range d.Priorities {
+			pq.Priorities[q.Priority.String()] = &gatewaypb.PriorityQuota{Remaining: q.Remaining, Allowed: q.Allowed, Denied: q.Denied}
+		}
+		resp.Policies = append(resp.Policies, pq)
+	}
+	return resp, nil
+}
+
+func overrideProto(o *policy.Override) *gatewaypb.Override {
+	if o == nil {
+		return nil
+	}
+	out := &gatewaypb.Override{
+		Id:        o.ID,
+		TenantId:  o.TenantID,
+		Resource:  o.Resource,
+		Limit:     o.Limit,
+		Burst:     o.Burst,
+		Start:     timestamppb.New(o.Start),
+		End:       timestamppb.New(o.End),
+		Reason:    o.Reason,
+		GrantedBy: o.GrantedBy,
+		Created:   timestamppb.New(o.Created),
+	}
+	if o.Window > 0 {
+		out.Window = durationpb.New(o.Window)
+	}
+	return out
+}
+
+func (g grpcGateway) Health(ctx context.Context, req *gatewaypb.HealthRequest) (*gatewaypb.HealthResponse, error) {
+	st, checks := g.s.health()
+	return &gatewaypb.HealthResponse{Status: st, Version: g.s.config.Observability.ServiceVersion, Checks: checks}, nil
+}
+
+// GetMetrics reports counter and gauge values by name, summed across
+// labels.
+func (g grpcGateway) GetMetrics(ctx context.Context, req *gatewaypb.MetricsRequest) (*gatewaypb.MetricsResponse, error) {
+	families, err := g.s.metrics.Registry.Gather()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	wanted := make(map[string]bool, len(req.MetricNames))
+	for _, name := range req.MetricNames {
+		wanted[name] = true
+	}
+	resp := &gatewaypb.MetricsResponse{Metrics: make(map[string]float64), Timestamp: timestamppb.New(time.Now())}
+	for _, f := range families {
+		if len(wanted) > 0 && !wanted[f.GetName()] {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			switch {
+			case m.GetCounter() != nil:
+				resp.Metrics[f.GetName()] += m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				resp.Metrics[f.GetName()] += m.GetGauge().GetValue()
+			}
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/xizzxy/helios/internal/limiter"
+	"github.com/xizzxy/helios/internal/metrics"
+	"github.com/xizzxy/helios/internal/policy"
+	"github.com/xizzxy/helios/internal/resilience"
+)
+
+// registerMetrics adds the gateway's own series to the registry. Values
+// that components already track are read at scrape time.
+func (s *Server) registerMetrics() {
+	reg := s.metrics.Registry
+	counter := func(name, help string, labels prometheus.Labels, v func() float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help, ConstLabels: labels}, v)
+	}
+	gauge := func(name, help string, labels prometheus.Labels, v func() float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help, ConstLabels: labels}, v)
+	}
+	load := func(n *uint64) func() float64 {
+		return func() float64 { return float64(atomic.LoadUint64(n)) }
+	}
+
+	reg.MustRegister(
+		gauge("helios_up", "Whether the service is up", nil, func() float64 { return 1 }),
+		counter("helios_requests_total", "Total number of requests",
+			prometheus.Labels{"method": "GET", "path": "/allow"}, load(&reqTotal)),
+		counter("helios_rate_limits_total", "Total number of rate limit checks",
+			prometheus.Labels{"result": "allowed"}, load(&reqAllowed)),
+		counter("helios_rate_limits_total", "Total number of rate limit checks",
+			prometheus.Labels{"result": "denied"}, load(&reqDenied)),
+		counter("helios_rate_limit_fallbacks_total", "Decisions made by a fallback policy", nil, load(&reqDegraded)),
+		gauge("helios_limiter_tracked_keys", "Keys with in-memory limiter state", nil, func() float64 {
+			return float64(s.localState.KeyStats().Keys)
+		}),
+		counter("helios_limiter_evictions_total", "Keys dropped from in-memory limiter state",
+			prometheus.Labels{"reason": "idle"}, func() float64 {
+				return float64(s.localState.KeyStats().IdleEvictions)
+			}),
+		counter("helios_limiter_evictions_total", "Keys dropped from in-memory limiter state",
+			prometheus.Labels{"reason": "capacity"}, func() float64 {
+				return float64(s.localState.KeyStats().CapacityEvictions)
+			}),
+	)
+
+	if s.breaker != nil {
+		labels := prometheus.Labels{"name": "redis"}
+		reg.MustRegister(
+			gauge("helios_circuit_breaker_state", "Breaker state (0=closed, 1=half_open, 2=open)", labels, func() float64 {
+				return float64(s.breaker.State())
+			}),
+			counter("helios_circuit_breaker_transitions_total", "Breaker state changes", labels, func() float64 {
+				return float64(s.breaker.Transitions())
+			}),
+		)
+	}
+	if s.shedder != nil {
+		signal := func(name string, v func(resilience.LoadSignals) float64) prometheus.Collector {
+			return gauge("helios_load_signal", "Latest overload signal sample", prometheus.Labels{"signal": name}, func() float64 {
+				return v(s.shedder.Signals())
+			})
+		}
+		shed := func(p resilience.Priority) prometheus.Collector {
+			return counter("helios_load_shed_total", "Requests rejected by load shedding", prometheus.Labels{"priority": p.String()}, func() float64 {
+				return float64(s.shedder.Shed(p))
+			})
+		}
+		reg.MustRegister(
+			gauge("helios_load_shedding_level", "Load shedding level (0=none, 1=low priority, 2=all but critical)", nil, func() float64 {
+				return float64(s.shedder.Level())
+			}),
+			counter("helios_load_shedding_transitions_total", "Load shedding level changes", nil, func() float64 {
+				return float64(s.shedder.Transitions())
+			}),
+			shed(resilience.PriorityLow),
+			shed(resilience.PriorityNormal),
+			signal("cpu", func(sig resilience.LoadSignals) float64 { return sig.CPU }),
+			signal("memory", func(sig resilience.LoadSignals) float64 { return sig.Memory }),
+			signal("in_flight", func(sig resilience.LoadSignals) float64 { return float64(sig.InFlight) }),
+			signal("p99_latency_seconds", func(sig resilience.LoadSignals) float64 { return sig.P99.Seconds() }),
+			signal("pressure", func(sig resilience.LoadSignals) float64 { return sig.Pressure }),
+		)
+	}
+	if s.bulkhead != nil {
+		reg.MustRegister(
+			gauge("helios_bulkhead_in_use", "Requests holding a bulkhead slot", nil, func() float64 {
+				return float64(s.bulkhead.Stats().InUse)
+			}),
+			gauge("helios_bulkhead_queued", "Requests waiting for a bulkhead slot", nil, func() float64 {
+				return float64(s.bulkhead.Stats().Queued)
+			}),
+			counter("helios_bulkhead_rejected_total", "Requests refused a bulkhead slot",
+				prometheus.Labels{"reason": "queue_full"}, func() float64 {
+					return float64(s.bulkhead.Stats().Rejected)
+				}),
+			counter("helios_bulkhead_rejected_total", "Requests refused a bulkhead slot",
+				prometheus.Labels{"reason": "timeout"}, func() float64 {
+					return float64(s.bulkhead.Stats().TimedOut)
+				}),
+		)
+	}
+	if s.node != nil {
+		reg.MustRegister(
+			gauge("helios_cluster_members", "Gateways in the consistent-hash ring", nil, func() float64 {
+				return float64(len(s.node.Members()))
+			}),
+			counter("helios_cluster_forward_errors_total", "Forwarded calls decided locally after the owner failed", nil, func() float64 {
+				return float64(s.node.ForwardErrors())
+			}),
+		)
+	}
+	if s.hybrid != nil {
+		reg.MustRegister(
+			counter("helios_fast_sync_errors_total", "Failed FAST mode syncs with Redis", nil, func() float64 {
+				return float64(s.hybrid.SyncErrors())
+			}),
+		)
+	}
+	if s.policies != nil {
+		reg.MustRegister(newPolicyCollector(s.policies, s.tenants))
+
+		completions := func(outcome string, n *atomic.Uint64) prometheus.Collector {
+			return counter("helios_adaptive_completions_total", "Outcomes reported for calls admitted by adaptive policies",
+				prometheus.Labels{"outcome": outcome}, func() float64 { return float64(n.Load()) })
+		}
+		reg.MustRegister(
+			gauge("helios_adaptive_pending_calls", "Admitted adaptive calls whose outcome is not yet reported", nil, func() float64 {
+				return float64(s.pending.len())
+			}),
+			completions("success", &s.pending.completed[limiter.OutcomeSuccess]),
+			completions("dropped", &s.pending.completed[limiter.OutcomeDropped]),
+			completions("ignored", &s.pending.completed[limiter.OutcomeIgnored]),
+			completions("expired", &s.pending.expired),
+		)
+	}
+	if s.decisions != nil {
+		const help = "Decision log events by outcome"
+		reg.MustRegister(
+			counter("helios_decision_log_events_total", help, prometheus.Labels{"outcome": "written"}, func() float64 {
+				return float64(s.decisions.Stats().Written)
+			}),
+			counter("helios_decision_log_events_total", help, prometheus.Labels{"outcome": "dropped"}, func() float64 {
+				return float64(s.decisions.Stats().Dropped)
+			}),
+			counter("helios_decision_log_events_total", help, prometheus.Labels{"outcome": "failed"}, func() float64 {
+				return float64(s.decisions.Stats().Failed)
+			}),
+		)
+	}
+}
+
+var policyDecisionsDesc = prometheus.NewDesc(
+	"helios_policy_decisions_total",
+	"Decisions per tenant policy; shadow policies never deny requests",
+	[]string{"tenant", "resource", "policy", "mode", "result"}, nil,
+)
+
+// policyCollector exports the engine's per-policy counters, which come and
+// go as tenants are reconfigured. Tenants without their own label are
+// folded into tenant="other", which keeps a running total so it never goes
+// down when a tenant is promoted or its policies are removed.
+type policyCollector struct {
+	engine  *policy.Engine
+	tenants *metrics.TenantLabels
+
+	mu    sync.Mutex
+	seen  map[policySeries]uint64 // each tenant's counts at the last scrape
+	other map[policySeries]uint64 // running totals with tenant "other"
+}
+
+type policySeries struct{ tenant, resource, policy, mode, result string }
+
+func newPolicyCollector(engine *policy.Engine, tenants *metrics.TenantLabels) *policyCollector {
+	return &policyCollector{
+		engine:  engine,
+		tenants: tenants,
+		seen:    make(map[policySeries]uint64),
+		other:   make(map[policySeries]uint64),
+	}
+}
+
+func (c *policyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- policyDecisionsDesc
+}
+
+func (c *policyCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	emit := func(k policySeries, v uint64) {
+		ch <- prometheus.MustNewConstMetric(policyDecisionsDesc, prometheus.CounterValue, float64(v),
+			k.tenant, k.resource, k.policy, k.mode, k.result)
+	}
+	seen := make(map[policySeries]uint64, len(c.seen))
+	for _, st := range c.engine.Stats() {
+		labelled := c.tenants.Lookup(st.Tenant) != metrics.OtherTenant
+		for result, v := range map[string]uint64{"allowed": st.Allowed, "denied": st.Denied} {
+			k := policySeries{st.Tenant, st.Resource, st.PolicyID, st.Mode, result}
+			seen[k] = v
+			if labelled {
+				emit(k, v)
+				continue
+			}
+			// Only what the tenant decided while unlabelled counts as
+			// other. A count below the last one means the policy was
+			// rebuilt and started again from zero.
+			delta := v
+			if last, ok := c.seen[k]; ok && last <= v {
+				delta = v - last
+			}
+			k.tenant = metrics.OtherTenant
+			c.other[k] += delta
+		}
+	}
+	c.seen = seen
+	for k, v := range c.other {
+		emit(k, v)
+	}
+}
@@ -2,9 +2,14 @@ package gateway
 
 import (
 	"log/slog"
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/xizzxy/helios/internal/metrics"
+	"github.com/xizzxy/helios/internal/resilience"
 )
 
 func LoggerMiddleware(logger *slog.Logger) gin.HandlerFunc {
@@ -92,21 +97,81 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-func MetricsMiddleware() gin.HandlerFunc {
+// MetricsMiddleware records request latency by matched route and status.
+func MetricsMiddleware(m *metrics.Metrics) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 
 		c.Next()
 
-		duration := time.Since(start)
-		method := c.Request.Method
-		route := c.FullPath()
-		status := c.Writer.Status()
-
-		// TODO: Record metrics with Prometheus
-		_ = duration
-		_ = method
-		_ = route
-		_ = status
+		m.ObserveHTTP(c.FullPath(), c.Request.Method, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// LoadSheddingMiddleware rejects requests with 503 while the shedder is
+// overloaded, lowest priority first.
+func LoadSheddingMiddleware(ls *resilience.LoadShedder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		done, ok := ls.Admit(requestPriority(c))
+		if !ok {
+			retryAfter := ls.RetryAfter()
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":               "server overloaded",
+				"retry_after_seconds": retryAfter,
+			})
+			return
+		}
+		start := time.Now()
+		c.Next()
+		done(time.Since(start))
+	}
+}
+
+// requestPriority treats health checks and metrics scrapes as critical, so
+// an overloaded gateway stays observable, and requests sent with
+// "X-Helios-Priority: low" as low priority.
+func requestPriority(c *gin.Context) resilience.Priority {
+	switch c.FullPath() {
+	case "/health", "/metrics", "/api/v1/metrics", "/api/v1/metrics/top":
+		return resilience.PriorityCritical
+	}
+	if c.GetHeader("X-Helios-Priority") == "low" {
+		return resilience.PriorityLow
+	}
+	return resilience.PriorityNormal
+}
+
+// BulkheadMiddleware caps concurrent requests, queueing the excess per
+// tenant. Requests that cannot get a slot receive 503. Critical requests
+// bypass it.
+func BulkheadMiddleware(b *resilience.Bulkhead) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if requestPriority(c) == resilience.PriorityCritical {
+			c.Next()
+			return
+		}
+		release, err := b.Acquire(c.Request.Context(), requestTenant(c))
+		if err != nil {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":               "too many concurrent requests",
+				"retry_after_seconds": 1,
+			})
+			return
+		}
+		defer release()
+		c.Next()
+	}
+}
+
+// requestTenant finds the tenant a request is made for.
+func requestTenant(c *gin.Context) string {
+	if tenant := c.Param("tenant"); tenant != "" {
+		return tenant
+	}
+	if tenant := c.Query("tenant"); tenant != "" {
+		return tenant
 	}
+	return c.GetHeader("X-Tenant-ID")
 }
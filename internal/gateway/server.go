@@ -4,76 +4,355 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	
+
 	"net"
 	"net/http"
 	"strconv"
-	"time"
 	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 
+	gatewaypb "github.com/xizzxy/helios/api/proto/gateway"
+	"github.com/xizzxy/helios/internal/cluster"
 	"github.com/xizzxy/helios/internal/config"
+	"github.com/xizzxy/helios/internal/decisionlog"
+	"github.com/xizzxy/helios/internal/diagnostics"
 	"github.com/xizzxy/helios/internal/limiter"
+	"github.com/xizzxy/helios/internal/metrics"
+	"github.com/xizzxy/helios/internal/policy"
+	"github.com/xizzxy/helios/internal/resilience"
 	"github.com/xizzxy/helios/internal/store"
+	"github.com/xizzxy/helios/internal/tracing"
+	"github.com/xizzxy/helios/internal/usage"
 )
 
+var tracer = tracing.Tracer("github.com/xizzxy/helios/internal/gateway")
+
 type Server struct {
 	config     *config.Config
 	httpServer *http.Server
 	grpcServer *grpc.Server
-	limiterMgr *limiter.LocalManager
+	peerServer *grpc.Server // internal peer and gossip APIs, nil unless clustered
+	metricsSrv *http.Server
+	diag       *diagnostics.Server
+	metrics    *metrics.Metrics
+	tenants    *metrics.TenantLabels // bounds the tenant label on metrics
+	hitters    *metrics.HeavyHitters // top consumers and rejected keys per resource
+	limiterMgr limiter.Manager
+	algorithm  limiter.Algorithm     // algorithm of the default limiter
+	localState *limiter.LocalManager // in-memory limiter whose key stats are exported
+	policies   *policy.Engine        // tenant policies from etcd, nil unless enabled
+	decisions  *decisionlog.Pipeline // audit and billing events, nil unless enabled
+	usage      *usage.Aggregator     // consumption metering, nil unless enabled
+	pending    *pendingCalls         // calls admitted by adaptive policies awaiting an outcome
+	timeout    time.Duration         // deadline for each decision, 0 for none
 	redisStore *store.Client
+	breaker    *resilience.CircuitBreaker
+	shedder    *resilience.LoadShedder // nil unless load shedding is enabled
+	bulkhead   *resilience.Bulkhead    // nil unless the bulkhead is enabled
+	hybrid     *limiter.HybridLimiter
+	lease      *limiter.LeaseLimiter
+	node       *cluster.Node
+	gossip     *cluster.Gossiper
+	discovery  cluster.Discovery
+	etcd       *clientv3.Client
 	logger     *slog.Logger
 }
+
 // --- simple in-process counters for demo metrics ---
 var (
-    reqTotal   uint64
-    reqAllowed uint64
-    reqDenied  uint64
+	reqTotal    uint64
+	reqAllowed  uint64
+	reqDenied   uint64
+	reqDegraded uint64
 )
 
-
 func NewServer(cfg *config.Config, logger *slog.Logger) (*Server, error) {
-	var redisStore *store.Client
+	// Demo default policy. Your LocalManager takes a single tenant key.
+	defaultCfg := limiter.Config{
+		Limit:         100,
+		Burst:         100,
+		Window:        time.Minute,
+		Algorithm:     limiter.AlgoTokenBucket,
+		MaxKeys:       cfg.Gateway.LocalState.MaxKeys,
+		SweepInterval: cfg.Gateway.LocalState.SweepInterval,
+		Shards:        cfg.Gateway.LocalState.Shards,
+		Adaptive: limiter.AdaptiveConfig{
+			Strategy:     cfg.Gateway.Adaptive.Strategy,
+			MinLimit:     cfg.Gateway.Adaptive.MinLimit,
+			MaxLimit:     cfg.Gateway.Adaptive.MaxLimit,
+			Timeout:      cfg.Gateway.Adaptive.Timeout,
+			BackoffRatio: cfg.Gateway.Adaptive.BackoffRatio,
+		},
+	}
+	switch cfg.Gateway.Adaptive.Strategy {
+	case "", limiter.StrategyAIMD, limiter.StrategyVegas, limiter.StrategyGradient2:
+	default:
+		return nil, fmt.Errorf("unknown adaptive strategy %q", cfg.Gateway.Adaptive.Strategy)
+	}
+	localMgr := limiter.NewLocalManager(defaultCfg)
+	localState := localMgr
+	m := metrics.New()
+
+	var (
+		limiterMgr limiter.Manager = localMgr
+		redisStore *store.Client
+		breaker    *resilience.CircuitBreaker
+		hybrid     *limiter.HybridLimiter
+		lease      *limiter.LeaseLimiter
+		node       *cluster.Node
+		gossip     *cluster.Gossiper
+		discovery  cluster.Discovery
+		peerAuth   cluster.PeerAuth
+		etcdClient *clientv3.Client
+		policies   *policy.Engine
+	)
+
+	// Policy limiters keep their state in memory unless strong mode
+	// points them at Redis below.
+	policyBase := defaultCfg
+	policyLimiter := func(c limiter.Config) limiter.Limiter {
+		return limiter.NewLocalManager(c).ForTenant("")
+	}
 
-	// Strong mode would use Redis. In FAST mode we keep redisStore nil (nop).
+	// Strong mode uses Redis. In FAST mode we keep redisStore nil (nop).
 	if cfg.Gateway.ConsistencyMode == "strong" {
-		c, err := store.NewClientFromEnv()
+		c, err := newRedisStore(cfg, m)
+		if err != nil {
+			return nil, err
+		}
+		redisStore = c
+
+		fallback, tenantFallbacks, err := fallbackPolicies(cfg.Resilience.CircuitBreaker)
+		if err != nil {
+			return nil, err
+		}
+		var guard limiter.Breaker
+		if cfg.Resilience.CircuitBreaker.Enabled {
+			breaker = resilience.NewCircuitBreaker(cfg.Resilience.CircuitBreaker)
+			guard = breaker
+		}
+		var primary limiter.Manager = limiter.NewRedisManager(redisStore, defaultCfg)
+		if cfg.Gateway.Lease.Enabled {
+			lease = limiter.NewLeaseLimiter(defaultCfg, redisStore, limiter.LeaseOptions{
+				TTL:         cfg.Gateway.Lease.TTL,
+				MaxFraction: cfg.Gateway.Lease.MaxFraction,
+			})
+			primary = limiter.NewSingleManager(defaultCfg, lease)
+		}
+		limiterMgr = limiter.NewFailoverManager(
+			primary,
+			localMgr,
+			guard,
+			fallback,
+			tenantFallbacks,
+			defaultCfg,
+		)
+		policyLimiter = func(c limiter.Config) limiter.Limiter {
+			return limiter.NewFailoverManager(
+				limiter.NewRedisManager(redisStore, c),
+				limiter.NewLocalManager(c),
+				guard,
+				fallback,
+				tenantFallbacks,
+				c,
+			).ForTenant("")
+		}
+		logger.Info("Using Redis-based rate limiting (strong mode)",
+			"fallback", fallback,
+			"leasing", cfg.Gateway.Lease.Enabled,
+		)
+	} else if cfg.Gateway.ConsistencyMode == "cluster" {
+		cc := cfg.Gateway.Cluster
+		var err error
+		if peerAuth, err = newPeerAuth(cfg); err != nil {
+			return nil, err
+		}
+		discovery, etcdClient, err = newDiscovery(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		node = cluster.NewNode(localMgr, cluster.Options{
+			Self:           cc.AdvertiseAddress,
+			VirtualNodes:   cc.VirtualNodes,
+			BatchSize:      cc.BatchSize,
+			BatchDelay:     cc.BatchDelay,
+			ForwardTimeout: cc.ForwardTimeout,
+			Auth:           peerAuth,
+		})
+		limiterMgr = node
+		logger.Info("Using peer-to-peer rate limiting (cluster mode)",
+			"listen_address", cc.ListenAddress,
+			"advertise_address", cc.AdvertiseAddress,
+			"discovery", cc.Discovery,
+		)
+	} else if cfg.Gateway.FastSync.Enabled {
+		c, err := newRedisStore(cfg, m)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create Redis client: %w", err)
+			return nil, err
 		}
 		redisStore = c
-		logger.Info("Using Redis-based rate limiting (strong mode)")
+
+		hybrid = limiter.NewHybridLimiter(defaultCfg, redisStore, limiter.HybridOptions{
+			SyncInterval: cfg.Gateway.FastSync.Interval,
+			ErrorBudget:  cfg.Gateway.FastSync.ErrorBudget,
+			InstanceID:   cfg.Gateway.FastSync.InstanceID,
+		})
+		limiterMgr = limiter.NewSingleManager(defaultCfg, hybrid)
+		logger.Info("Using in-memory rate limiting with Redis sync (fast mode)",
+			"sync_interval", cfg.Gateway.FastSync.Interval,
+			"error_budget", cfg.Gateway.FastSync.ErrorBudget,
+		)
+	} else if cfg.Gateway.Gossip.Enabled {
+		var err error
+		if peerAuth, err = newPeerAuth(cfg); err != nil {
+			return nil, err
+		}
+		discovery, etcdClient, err = newDiscovery(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		gossip = cluster.NewGossiper(cluster.GossipOptions{
+			Self:     cfg.Gateway.Cluster.AdvertiseAddress,
+			Interval: cfg.Gateway.Gossip.Interval,
+			Fanout:   cfg.Gateway.Gossip.Fanout,
+			KeyTTL:   cfg.Gateway.Gossip.KeyTTL,
+			MaxKeys:  cfg.Gateway.Gossip.MaxKeys,
+			Auth:     peerAuth,
+		})
+		gossipCfg := defaultCfg
+		gossipCfg.Cluster = gossip
+		localState = limiter.NewLocalManager(gossipCfg)
+		limiterMgr = localState
+		policyBase = gossipCfg
+		logger.Info("Using in-memory rate limiting with gossip (fast mode)",
+			"listen_address", cfg.Gateway.Cluster.ListenAddress,
+			"advertise_address", cfg.Gateway.Cluster.AdvertiseAddress,
+			"interval", cfg.Gateway.Gossip.Interval,
+		)
 	} else {
 		logger.Info("Using in-memory rate limiting (fast mode)")
 	}
 
-	// Demo default policy. Your LocalManager takes a single tenant key.
-	limiterMgr := limiter.NewLocalManager(limiter.Config{
-		Limit:     100,
-		Burst:     100,
-		Window:    time.Minute,
-		Algorithm: limiter.AlgoTokenBucket,
-	})
+	if cfg.Gateway.Policies.Enabled {
+		if etcdClient == nil {
+			c, err := newEtcdClient(cfg)
+			if err != nil {
+				return nil, err
+			}
+			etcdClient = c
+		}
+		// In-flight calls are only known to the gateway that admitted
+		// them, so adaptive policies always keep their state in memory.
+		factory := func(c limiter.Config) limiter.Limiter {
+			if c.Algorithm == limiter.AlgoAdaptive {
+				return limiter.NewAdaptiveLimiter(c)
+			}
+			return policyLimiter(c)
+		}
+		policies = policy.NewEngine(policyBase, factory)
+		logger.Info("Loading tenant policies from etcd", "prefix", policy.TenantPrefix)
+	}
+
+	var decisions *decisionlog.Pipeline
+	if dl := cfg.Gateway.DecisionLog; dl.Enabled {
+		p, err := newDecisionLog(dl, logger)
+		if err != nil {
+			return nil, err
+		}
+		decisions = p
+		logger.Info("Decision log enabled", "sinks", dl.Sinks, "instance", dl.Instance)
+	}
+
+	var meter *usage.Aggregator
+	if uc := cfg.Gateway.Usage; uc.Enabled {
+		if etcdClient == nil {
+			c, err := newEtcdClient(cfg)
+			if err != nil {
+				return nil, err
+			}
+			etcdClient = c
+		}
+		store := usage.NewEtcdStore(etcdClient, usage.Retention{
+			usage.Minute: uc.MinuteRetention,
+			usage.Hour:   uc.HourRetention,
+			usage.Day:    uc.DayRetention,
+		})
+		// Each process writes its own totals, so a restart starts afresh
+		// instead of overwriting what the previous run recorded.
+		writer := cfg.Gateway.FastSync.InstanceID + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+		meter = usage.NewAggregator(store, writer, uc.FlushInterval, nil, logger)
+		logger.Info("Metering usage to etcd", "prefix", usage.Prefix, "writer", writer)
+	}
 
 	// Gin router
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 	router.Use(gin.Recovery())
+	router.Use(tracing.Middleware())
 	router.Use(LoggerMiddleware(logger))
+	router.Use(MetricsMiddleware(m))
+	var shedder *resilience.LoadShedder
+	if ls := cfg.Resilience.LoadShedding; ls.Enabled {
+		shedder = resilience.NewLoadShedder(ls)
+		router.Use(LoadSheddingMiddleware(shedder))
+	}
+	var bulkhead *resilience.Bulkhead
+	if bc := cfg.Resilience.Bulkhead; bc.Enabled {
+		bulkhead = resilience.NewBulkhead(bc)
+		router.Use(BulkheadMiddleware(bulkhead))
+	}
 	router.Use(CORSMiddleware())
 
+	// The resource comes straight from the request, so only the default
+	// and those named by a policy get their own decision series.
+	m.SetKnownResources(func(resource string) bool {
+		return resource == "default" || policies != nil && policies.HasResource(resource)
+	})
+
+	tl := cfg.Observability.TenantLabels
 	s := &Server{
 		config:     cfg,
+		metrics:    m,
+		tenants:    metrics.NewTenantLabels(tl.AllowList, tl.TopN, tl.SketchSize, tl.RefreshInterval),
+		hitters:    metrics.NewHeavyHitters(tl.SketchSize, tl.MaxResources),
 		limiterMgr: limiterMgr,
+		algorithm:  defaultCfg.Algorithm,
+		localState: localState,
+		policies:   policies,
+		decisions:  decisions,
+		usage:      meter,
+		pending:    newPendingCalls(cfg.Gateway.Adaptive.CompletionTimeout),
+		timeout:    cfg.Gateway.DecisionTimeout,
 		redisStore: redisStore,
+		breaker:    breaker,
+		shedder:    shedder,
+		bulkhead:   bulkhead,
+		hybrid:     hybrid,
+		lease:      lease,
+		node:       node,
+		gossip:     gossip,
+		discovery:  discovery,
+		etcd:       etcdClient,
 		logger:     logger,
 	}
 
+	// A tenant that loses its label now counts as other; drop its series.
+	s.tenants.OnDemote(m.DeleteTenant)
+
 	s.setupRoutes(router)
+	s.registerMetrics()
+	s.registerDiagnostics()
 
 	// HTTP server
 	s.httpServer = &http.Server{
@@ -83,16 +362,62 @@ func NewServer(cfg *config.Config, logger *slog.Logger) (*Server, error) {
 		WriteTimeout: cfg.Gateway.WriteTimeout,
 	}
 
-	// gRPC server (reflection only for now)
+	// gRPC server (the gateway API and reflection)
 	s.grpcServer = grpc.NewServer(
-		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor(), s.unaryInterceptor),
 	)
+	gatewaypb.RegisterGatewayServiceServer(s.grpcServer, grpcGateway{s: s})
 	reflection.Register(s.grpcServer)
 
+	// Internal gRPC server for the peer and gossip APIs, apart from the
+	// public one so that only authenticated gateways reach them
+	if node != nil || gossip != nil {
+		s.peerServer = peerAuth.NewServer(grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor()))
+	}
+	if node != nil {
+		node.Register(s.peerServer)
+	}
+	if gossip != nil {
+		gossip.Register(s.peerServer)
+	}
+
 	return s, nil
 }
 
 func (s *Server) Start(ctx context.Context) error {
+	if s.node != nil {
+		if err := s.node.Start(ctx, s.discovery); err != nil {
+			return fmt.Errorf("failed to start cluster discovery: %w", err)
+		}
+	}
+	if s.gossip != nil {
+		if err := s.gossip.Start(ctx, s.discovery); err != nil {
+			return fmt.Errorf("failed to start gossip: %w", err)
+		}
+	}
+	if s.policies != nil {
+		if err := s.policies.Sync(ctx, s.etcd, s.logger); err != nil {
+			return fmt.Errorf("failed to load tenant policies: %w", err)
+		}
+	}
+
+	if s.config.Observability.MetricsEnabled {
+		s.metricsSrv = &http.Server{
+			Addr:    s.config.Observability.MetricsAddress,
+			Handler: s.metrics.Handler(),
+		}
+		go func() {
+			s.logger.Info("Starting metrics server", "address", s.metricsSrv.Addr)
+			if err := s.metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.logger.Error("Metrics server error", "error", err)
+			}
+		}()
+	}
+
+	if s.config.Observability.EnableProfiling {
+		s.diag.Start(s.config.Observability.ProfilingAddress, s.logger)
+	}
+
 	// HTTP
 	go func() {
 		s.logger.Info("Starting HTTP server", "address", s.config.Gateway.Address)
@@ -114,6 +439,21 @@ func (s *Server) Start(ctx context.Context) error {
 		}
 	}()
 
+	// Peer gRPC
+	if s.peerServer != nil {
+		go func() {
+			lis, err := net.Listen("tcp", s.config.Gateway.Cluster.ListenAddress)
+			if err != nil {
+				s.logger.Error("Failed to listen for peers", "error", err)
+				return
+			}
+			s.logger.Info("Starting peer gRPC server", "address", s.config.Gateway.Cluster.ListenAddress)
+			if err := s.peerServer.Serve(lis); err != nil {
+				s.logger.Error("Peer gRPC server error", "error", err)
+			}
+		}()
+	}
+
 	return nil
 }
 
@@ -127,6 +467,57 @@ func (s *Server) Stop(ctx context.Context) error {
 
 	// Stop gRPC
 	s.grpcServer.GracefulStop()
+	if s.peerServer != nil {
+		s.peerServer.GracefulStop()
+	}
+
+	if s.metricsSrv != nil {
+		if err := s.metricsSrv.Shutdown(ctx); err != nil {
+			s.logger.Error("Metrics server shutdown error", "error", err)
+		}
+	}
+	if err := s.diag.Shutdown(ctx); err != nil {
+		s.logger.Error("Diagnostics server shutdown error", "error", err)
+	}
+
+	if s.shedder != nil {
+		s.shedder.Close()
+	}
+
+	// Leave the cluster; the etcd registration expires with its lease
+	if s.node != nil {
+		s.node.Close()
+	}
+	if s.gossip != nil {
+		s.gossip.Close()
+	}
+	// Write the last usage totals while etcd is still reachable
+	if s.usage != nil {
+		if err := s.usage.Close(ctx); err != nil {
+			s.logger.Error("Failed to flush usage", "error", err)
+		}
+	}
+	if s.etcd != nil {
+		if err := s.etcd.Close(); err != nil {
+			s.logger.Error("Failed to close etcd client", "error", err)
+		}
+	}
+
+	// Write out queued decision events now that no more requests arrive
+	if s.decisions != nil {
+		if err := s.decisions.Close(ctx); err != nil {
+			s.logger.Error("Failed to flush decision log", "error", err)
+		}
+	}
+
+	// Flush pending FAST mode consumption before the store goes away
+	if s.hybrid != nil {
+		s.hybrid.Close()
+	}
+	// Hand unspent leased tokens back to Redis
+	if s.lease != nil {
+		s.lease.Close()
+	}
 
 	// Close Redis store (if any)
 	if s.redisStore != nil {
@@ -146,18 +537,30 @@ func (s *Server) setupRoutes(router *gin.Engine) {
 	api := router.Group("/api/v1")
 	{
 		api.GET("/allow", s.handleAllow)
+		api.POST("/complete", s.handleComplete)
 		api.GET("/quota/:tenant", s.handleQuota)
 		api.GET("/metrics", s.handleMetrics)
+		api.GET("/metrics/top", s.handleTopConsumers)
 	}
 
 	// Back-compat
 	router.GET("/allow", s.handleAllow)
 
-	// Very basic Prometheus text endpoint (placeholder)
-	router.GET("/metrics", s.handlePrometheusMetrics)
+	// The same registry is served on the metrics address
+	router.GET("/metrics", gin.WrapH(s.metrics.Handler()))
 }
 
 func (s *Server) handleHealth(c *gin.Context) {
+	status, checks := s.health()
+	c.JSON(http.StatusOK, gin.H{
+		"status":  status,
+		"version": s.config.Observability.ServiceVersion,
+		"checks":  checks,
+	})
+}
+
+// health reports the gateway's overall status and that of each component.
+func (s *Server) health() (string, map[string]string) {
 	status := "healthy"
 	checks := make(map[string]string)
 
@@ -171,13 +574,31 @@ func (s *Server) handleHealth(c *gin.Context) {
 		}
 	}
 
+	if s.breaker != nil {
+		state := s.breaker.State()
+		checks["circuit_breaker"] = state.String()
+		if state != resilience.StateClosed && status == "healthy" {
+			status = "degraded"
+		}
+	}
+
+	if s.node != nil {
+		checks["cluster"] = fmt.Sprintf("%d members", len(s.node.Members()))
+	}
+
 	checks["limiter"] = "healthy"
+	return status, checks
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":  status,
-		"version": s.config.Observability.ServiceVersion,
-		"checks":  checks,
-	})
+// validAPIKey accepts the demo keys.
+// TODO: validate against the tenant's keys in etcd.
+func validAPIKey(apiKey string) bool {
+	switch apiKey {
+	case "test-key", "demo-key", "admin-key":
+		return true
+	default:
+		return false
+	}
 }
 
 func (s *Server) handleAllow(c *gin.Context) {
@@ -196,10 +617,7 @@ func (s *Server) handleAllow(c *gin.Context) {
         return
     }
 
-    // demo keys — replace with etcd/config validation later
-    switch apiKey {
-    case "test-key", "demo-key", "admin-key":
-    default:
+	if !validAPIKey(apiKey) {
         c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
         return
     }
@@ -220,27 +638,31 @@ func (s *Server) handleAllow(c *gin.Context) {
         }
     }
 
-    // get limiter for tenant (your LocalManager takes only tenant)
-    rl := s.limiterMgr.ForTenant(tenant)
-
-    // key used by the limiter
-    key := fmt.Sprintf("%s:%s:%s", tenant, resource, apiKey)
-	// count request
-    atomic.AddUint64(&reqTotal, 1)
+	// Priority only decides access to reserved policy capacity; load
+	// shedding reads the header separately and never trusts "critical".
+	priority := resilience.PriorityNormal
+	p := c.Query("priority")
+	if p == "" {
+		p = c.GetHeader("X-Helios-Priority")
+	}
+	if p != "" {
+		var err error
+		if priority, err = resilience.ParsePriority(p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "priority must be low, normal or critical"})
+			return
+		}
+	}
 
-    // ✅ NEW: two-value return and int64 cost
-    res, err := rl.Allow(c.Request.Context(), key, int64(cost))
+	ctx, span := tracer.Start(c.Request.Context(), "handleAllow")
+	defer span.End()
 
-	if res.Allowed {
-		atomic.AddUint64(&reqAllowed, 1)
-	} else {
-		atomic.AddUint64(&reqDenied, 1)
+	res, completionToken, err := s.allow(ctx, tenant, resource, apiKey, int64(cost), priority)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
 	}
-	
-    if err != nil {
-        s.logger.Error("Rate limit check failed", "tenant", tenant, "resource", resource, "error", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
-        return
+	if res.Degraded {
+		c.Header("X-Helios-Degraded", "true")
     }
 
     // headers
@@ -255,6 +677,10 @@ func (s *Server) handleAllow(c *gin.Context) {
 		if retryAfter < 0 {
 			retryAfter = 0
 		}
+		span.AddEvent("rate_limited", trace.WithAttributes(
+			attribute.Int("helios.retry_after_seconds", retryAfter),
+			attribute.Int64("helios.limit", res.Limit),
+		))
 		c.Header("Retry-After", strconv.Itoa(retryAfter))
 		c.JSON(http.StatusTooManyRequests, gin.H{
 			"allowed":             false,
@@ -264,15 +690,173 @@ func (s *Server) handleAllow(c *gin.Context) {
 		return
 	}
 	
-
-    c.JSON(http.StatusOK, gin.H{
+	body := gin.H{
         "allowed":    true,
         "remaining":  res.Remaining,
         "limit":      res.Limit,
         "reset_time": res.ResetTime.Unix(),
-    })
+	}
+	if completionToken != "" {
+		body["completion_token"] = completionToken
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// allow decides and records one request for handleAllow and the gRPC
+// Allow, annotating the span in ctx. The completion token is set when
+// adaptive policies admitted the call and await its outcome.
+func (s *Server) allow(ctx context.Context, tenant, resource, apiKey string, cost int64, priority resilience.Priority) (*limiter.Result, string, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("helios.tenant", tenant),
+		attribute.String("helios.resource", resource),
+		attribute.Int64("helios.cost", cost),
+		attribute.String("helios.priority", priority.String()),
+	)
+
+	// get limiter for tenant (your LocalManager takes only tenant)
+	rl := s.limiterMgr.ForTenant(tenant)
+
+	// count request
+	atomic.AddUint64(&reqTotal, 1)
+
+	start := time.Now()
+	decideCtx, cancel := s.withDecisionTimeout(ctx)
+	res, algorithm, policyID, err := s.decide(decideCtx, rl, tenant, resource, apiKey, cost, priority)
+	cancel()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "rate limit check failed")
+		span.SetAttributes(attribute.String("helios.outcome", "error"))
+		s.logger.Error("Rate limit check failed", "tenant", tenant, "resource", resource, "error", err)
+		return nil, "", err
+	}
+	s.metrics.ObserveDecision(s.tenants.Label(tenant), resource, string(algorithm), res.Allowed, time.Since(start))
+	s.hitters.Observe(resource, tenant+":"+keyPrefix(apiKey), cost, res.Allowed)
+	s.logDecision(tenant, resource, apiKey, cost, policyID, policy.ModeEnforce, res)
+	if s.usage != nil {
+		s.usage.Record(tenant, resource, usage.Fingerprint(apiKey), cost, res.Allowed)
+	}
+	span.SetAttributes(
+		attribute.String("helios.outcome", outcome(res.Allowed)),
+		attribute.String("helios.algorithm", string(algorithm)),
+		attribute.Int64("helios.remaining", res.Remaining),
+		attribute.Bool("helios.degraded", res.Degraded),
+	)
+
+	var completionToken string
+	if res.Complete != nil {
+		if res.Allowed {
+			completionToken = s.pending.add(res.Complete)
+		} else {
+			// Another policy denied the request; release the
+			// adaptive policies that admitted it.
+			res.Complete(limiter.OutcomeIgnored, 0)
+		}
+	}
+
+	if res.Allowed {
+		atomic.AddUint64(&reqAllowed, 1)
+	} else {
+		atomic.AddUint64(&reqDenied, 1)
+	}
+	if res.Degraded {
+		atomic.AddUint64(&reqDegraded, 1)
+	}
+	return res, completionToken, nil
+}
+
+// withDecisionTimeout bounds a decision. HTTP requests carry no deadline
+// of their own, and without one retries would only stop at their count.
+func (s *Server) withDecisionTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// decide applies the tenant's enforced policies for the resource, or rl when
+// there are none, and reports the algorithm and policy that decided. Shadow
+// policies are evaluated alongside and only logged. priority decides how
+// much of the policies' reserved capacity the request may use.
+func (s *Server) decide(ctx context.Context, rl limiter.Limiter, tenant, resource, apiKey string, cost int64, priority resilience.Priority) (*limiter.Result, limiter.Algorithm, string, error) {
+	ctx, span := tracer.Start(ctx, "limiter.decide")
+	defer span.End()
+
+	res, algorithm, enforcedBy, err := s.evaluate(ctx, rl, tenant, resource, apiKey, cost, priority)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, "", "", err
+	}
+	span.SetAttributes(
+		attribute.String("helios.algorithm", string(algorithm)),
+		attribute.String("helios.policy", enforcedBy),
+		attribute.String("helios.outcome", outcome(res.Allowed)),
+	)
+	if !res.Allowed {
+		span.AddEvent("denied", trace.WithAttributes(attribute.String("helios.policy", enforcedBy)))
+	}
+	return res, algorithm, enforcedBy, nil
 }
 
+// evaluate runs the policies and the default limiter for decide, and names
+// the policy whose result applies.
+func (s *Server) evaluate(ctx context.Context, rl limiter.Limiter, tenant, resource, apiKey string, cost int64, priority resilience.Priority) (*limiter.Result, limiter.Algorithm, string, error) {
+	// key used by the limiter
+	key := fmt.Sprintf("%s:%s:%s", tenant, resource, apiKey)
+	if s.policies == nil {
+		res, err := rl.Allow(ctx, key, cost)
+		return res, s.algorithm, "default", err
+	}
+	ev, err := s.policies.Evaluate(ctx, tenant, resource, key, cost, priority)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	var res *limiter.Result
+	algorithm := s.algorithm
+	enforcedBy := "default"
+	if ev.Enforced != nil {
+		res = ev.Enforced.Result
+		algorithm = ev.Enforced.Algorithm
+		enforcedBy = ev.Enforced.PolicyID
+		// ev.Complete already includes the enforced policy's.
+		res.Complete = ev.Complete
+	} else if res, err = rl.Allow(ctx, key, cost); err != nil {
+		if ev.Complete != nil {
+			ev.Complete(limiter.OutcomeIgnored, 0)
+		}
+		return nil, "", "", err
+	} else {
+		res.Complete = limiter.JoinCompletions(res.Complete, ev.Complete)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	for _, d := range ev.Shadow {
+		if !d.Result.Allowed {
+			span.AddEvent("shadow_denied", trace.WithAttributes(attribute.String("helios.policy", d.PolicyID)))
+		}
+		s.logger.Debug("Shadow policy decision",
+			"tenant", tenant,
+			"resource", resource,
+			"policy", d.PolicyID,
+			"allowed", d.Result.Allowed,
+			"remaining", d.Result.Remaining,
+			"enforced_by", enforcedBy,
+			"enforced_allowed", res.Allowed,
+		)
+		s.logDecision(tenant, resource, apiKey, cost, d.PolicyID, policy.ModeShadow, d.Result)
+	}
+	return res, algorithm, enforcedBy, nil
+}
+
+func outcome(allowed bool) string {
+	if allowed {
+		return "allowed"
+	}
+	return "denied"
+}
 
 func (s *Server) handleQuota(c *gin.Context) {
     tenant := c.Param("tenant")
@@ -290,9 +874,7 @@ func (s *Server) handleQuota(c *gin.Context) {
         return
     }
 
-    // Demo keys
-    valid := map[string]struct{}{"test-key": {}, "demo-key": {}, "admin-key": {}}
-    if _, ok := valid[apiKey]; !ok {
+	if !validAPIKey(apiKey) {
         c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
         return
     }
@@ -302,22 +884,81 @@ func (s *Server) handleQuota(c *gin.Context) {
         resource = "default"
     }
 
-    // Get limiter and read current state (cost=0)
-    rl := s.limiterMgr.ForTenant(tenant)
-    id := fmt.Sprintf("%s:%s:%s", tenant, resource, apiKey)
-
-    res, err := rl.Allow(c.Request.Context(), id, int64(0))
+	res, decisions, err := s.quota(c.Request.Context(), tenant, resource, apiKey)
     if err != nil {
-        s.logger.Error("Get quota failed", "id", id, "error", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{
+	body := gin.H{
         "remaining":  res.Remaining,
         "limit":      res.Limit,
         "reset_time": res.ResetTime.Unix(),
-    })
+	}
+	if s.policies != nil {
+		policies := make([]gin.H, 0, len(decisions))
+		for _, d := range decisions {
+			priorities := make(gin.H, len(d.Priorities))
+			for _, q := range d.Priorities {
+				priorities[q.Priority.String()] = gin.H{
+					"remaining": q.Remaining,
+					"allowed":   q.Allowed,
+					"denied":    q.Denied,
+				}
+			}
+			entry := gin.H{
+				"policy_id":  d.PolicyID,
+				"mode":       d.Mode,
+				"algorithm":  d.Algorithm,
+				"remaining":  d.Result.Remaining,
+				"limit":      d.Result.Limit,
+				"reset_time": d.Result.ResetTime.Unix(),
+				"priorities": priorities,
+			}
+			if d.Profile != "" {
+				entry["profile"] = d.Profile
+			}
+			if o := d.Override; o != nil {
+				entry["override"] = gin.H{
+					"id":         o.ID,
+					"reason":     o.Reason,
+					"granted_by": o.GrantedBy,
+					"end":        o.End.Unix(),
+				}
+			}
+			policies = append(policies, entry)
+		}
+		body["policies"] = policies
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// quota reads, without charging, the default limiter's state for the key
+// and that of the tenant's policies for resource.
+func (s *Server) quota(ctx context.Context, tenant, resource, apiKey string) (*limiter.Result, []policy.Decision, error) {
+	// Get limiter and read current state (cost=0)
+	rl := s.limiterMgr.ForTenant(tenant)
+	id := fmt.Sprintf("%s:%s:%s", tenant, resource, apiKey)
+
+	ctx, cancel := s.withDecisionTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	res, err := rl.Allow(ctx, id, int64(0))
+	s.metrics.ObserveQuota(string(s.algorithm), time.Since(start))
+	if err != nil {
+		s.logger.Error("Get quota failed", "id", id, "error", err)
+		return nil, nil, err
+	}
+	if s.policies == nil {
+		return res, nil, nil
+	}
+	decisions, err := s.policies.Quota(ctx, tenant, resource, id)
+	if err != nil {
+		s.logger.Error("Get policy quota failed", "id", id, "error", err)
+		return nil, nil, err
+	}
+	return res, decisions, nil
 }
 
 func (s *Server) handleMetrics(c *gin.Context) {
@@ -326,39 +967,138 @@ func (s *Server) handleMetrics(c *gin.Context) {
 
 	// Redis metrics (if any)
 	if s.redisStore != nil {
-		stats := s.redisStore.GetStats()
+		stats := s.redisStore.Stats()
 		metrics["redis"] = stats
 	}
 
 	c.JSON(http.StatusOK, metrics)
 }
 
-func (s *Server) handlePrometheusMetrics(c *gin.Context) {
-	metrics := fmt.Sprintf(`# HELP helios_requests_total Total number of requests
-# TYPE helios_requests_total counter
-helios_requests_total{method="GET",path="/allow"} %d
-
-# HELP helios_rate_limits_total Total number of rate limit checks
-# TYPE helios_rate_limits_total counter
-helios_rate_limits_total{result="allowed"} %d
-helios_rate_limits_total{result="denied"} %d
-
-# HELP helios_up Whether the service is up
-# TYPE helios_up gauge
-helios_up 1
-`,
-        atomic.LoadUint64(&reqTotal),
-        atomic.LoadUint64(&reqAllowed),
-        atomic.LoadUint64(&reqDenied),
-    )
-	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
-	c.String(http.StatusOK, metrics)
+// handleTopConsumers lists the heaviest keys per resource from the top-K
+// sketches. Counts are estimates that may overcount by up to "error".
+func (s *Server) handleTopConsumers(c *gin.Context) {
+	n := 10
+	if v := c.Query("n"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid n parameter"})
+			return
+		}
+		n = parsed
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp":        time.Now().Unix(),
+		"resources":        s.hitters.Top(n),
+		"labelled_tenants": s.tenants.Labelled(),
+	})
+}
+
+// keyPrefix shortens an API key so it can be shown without disclosing it.
+func keyPrefix(apiKey string) string {
+	n := len(apiKey) / 2
+	if n > 4 {
+		n = 4
+	}
+	return apiKey[:n] + "…"
+}
+
+// newPeerAuth builds the credentials gateways present to each other. The
+// peer APIs move quota for any tenant, so they need the shared secret,
+// mutual TLS, or both.
+func newPeerAuth(cfg *config.Config) (cluster.PeerAuth, error) {
+	cc := cfg.Gateway.Cluster
+	if cc.Secret == "" && !cc.TLS.MutualTLS() {
+		return cluster.PeerAuth{}, fmt.Errorf("peer APIs need HELIOS_CLUSTER_SECRET or mutual TLS (HELIOS_CLUSTER_TLS_*)")
+	}
+	clientTLS, err := cc.TLS.ClientTLS()
+	if err != nil {
+		return cluster.PeerAuth{}, fmt.Errorf("cluster tls: %w", err)
+	}
+	serverTLS, err := cc.TLS.ServerTLS()
+	if err != nil {
+		return cluster.PeerAuth{}, fmt.Errorf("cluster tls: %w", err)
+	}
+	return cluster.PeerAuth{Secret: cc.Secret, ClientTLS: clientTLS, ServerTLS: serverTLS}, nil
+}
+
+// newDiscovery builds peer discovery from the cluster settings, connecting
+// to etcd when registrations are used.
+func newDiscovery(cfg *config.Config) (cluster.Discovery, *clientv3.Client, error) {
+	cc := cfg.Gateway.Cluster
+	switch cc.Discovery {
+	case "etcd":
+		etcdClient, err := newEtcdClient(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cluster.EtcdDiscovery{Client: etcdClient, Self: cc.AdvertiseAddress}, etcdClient, nil
+	case "static", "":
+		return cluster.StaticDiscovery{Peers: cc.Peers}, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown cluster discovery %q", cc.Discovery)
+	}
+}
+
+func newEtcdClient(cfg *config.Config) (*clientv3.Client, error) {
+	tlsCfg, err := cfg.Etcd.TLS.ClientTLS()
+	if err != nil {
+		return nil, fmt.Errorf("etcd tls: %w", err)
+	}
+	etcdClient, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Etcd.Endpoints,
+		DialTimeout: cfg.Etcd.DialTimeout,
+		Username:    cfg.Etcd.Username,
+		Password:    cfg.Etcd.Password,
+		TLS:         tlsCfg,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to etcd: %w", err)
+	}
+	return etcdClient, nil
+}
+
+// newRedisStore connects to Redis, reporting script latency, errors and
+// retries to m.
+func newRedisStore(cfg *config.Config, m *metrics.Metrics) (*store.Client, error) {
+	redisCfg := cfg.Redis
+	retry := resilience.NewRetryPolicy(cfg.Resilience.Retry)
+	if retry != nil {
+		// The store decides which scripts are safe to resend; go-redis
+		// would resend any of them after a dropped connection.
+		redisCfg.MaxRetries = -1
+	}
+	c, err := store.NewClient(redisCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Redis client: %w", err)
+	}
+	c.SetObserver(m.ObserveRedis)
+	c.SetRetryPolicy(retry, m.ObserveRedisRetry)
+	return c, nil
+}
+
+// fallbackPolicies validates the configured default and per-tenant policies.
+func fallbackPolicies(cfg config.CircuitBreakerConfig) (limiter.FallbackPolicy, map[string]limiter.FallbackPolicy, error) {
+	fallback, err := limiter.ParseFallbackPolicy(cfg.Fallback)
+	if err != nil {
+		return "", nil, fmt.Errorf("circuit breaker fallback: %w", err)
+	}
+	tenants := make(map[string]limiter.FallbackPolicy, len(cfg.TenantFallbacks))
+	for tenant, name := range cfg.TenantFallbacks {
+		p, err := limiter.ParseFallbackPolicy(name)
+		if err != nil {
+			return "", nil, fmt.Errorf("circuit breaker fallback for tenant %s: %w", tenant, err)
+		}
+		tenants[tenant] = p
+	}
+	return fallback, tenants, nil
 }
 
 func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	start := time.Now()
 	resp, err := handler(ctx, req)
 	duration := time.Since(start)
+	s.metrics.ObserveGRPC(info.FullMethod, status.Code(err).String(), duration)
 
 	s.logger.Info("gRPC request completed",
 		"method", info.FullMethod,
@@ -367,7 +1107,3 @@ func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *gr
 	)
 	return resp, err
 }
-
-
-
-
@@ -0,0 +1,69 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/config"
+	"github.com/xizzxy/helios/internal/limiter"
+	"github.com/xizzxy/helios/internal/resilience"
+)
+
+var errFlaky = errors.New("connection reset")
+
+// flakyLimiter fails every attempt, retrying as the Redis limiters do.
+type flakyLimiter struct {
+	retry    *resilience.RetryPolicy
+	attempts int
+	deadline bool
+}
+
+func (f *flakyLimiter) Allow(ctx context.Context, key string, cost int64) (*limiter.Result, error) {
+	_, f.deadline = ctx.Deadline()
+	return nil, f.retry.Do(ctx, func(error) bool { return true }, nil, func() error {
+		f.attempts++
+		return errFlaky
+	})
+}
+
+func (f *flakyLimiter) GetQuota(ctx context.Context, key string) (*limiter.Result, error) {
+	return f.Allow(ctx, key, 0)
+}
+
+type flakyManager struct{ l *flakyLimiter }
+
+func (m flakyManager) ForTenant(string) limiter.Limiter { return m.l }
+
+func TestDecisionTimeoutBoundsRetries(t *testing.T) {
+	// Unbounded, these retries would take about five seconds.
+	l := &flakyLimiter{retry: resilience.NewRetryPolicy(config.RetryConfig{
+		Enabled:         true,
+		MaxRetries:      1000,
+		InitialInterval: 10 * time.Millisecond,
+		MaxInterval:     10 * time.Millisecond,
+	})}
+	s := &Server{
+		limiterMgr: flakyManager{l},
+		timeout:    100 * time.Millisecond,
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	start := time.Now()
+	_, _, err := s.allow(context.Background(), "acme", "api", "key", 1, resilience.PriorityNormal)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("allow took %v, want about the 100ms decision timeout", elapsed)
+	}
+	if !errors.Is(err, errFlaky) {
+		t.Errorf("err = %v, want the last attempt's error", err)
+	}
+	if !l.deadline {
+		t.Error("the limiter saw no deadline")
+	}
+	if l.attempts >= 1000 {
+		t.Errorf("%d attempts, want the deadline to stop retries early", l.attempts)
+	}
+}
@@ -0,0 +1,360 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AlgoAdaptive limits concurrent calls rather than calls per window, and
+// learns the limit from how the admitted calls fare.
+const AlgoAdaptive Algorithm = "adaptive"
+
+// Adaptive strategies, after Netflix's concurrency-limits.
+const (
+	StrategyAIMD      = "aimd"
+	StrategyVegas     = "vegas"
+	StrategyGradient2 = "gradient2"
+)
+
+// AdaptiveConfig tunes AlgoAdaptive limiters. Config.Limit is the initial
+// limit and Config.Burst, when set, the maximum.
+type AdaptiveConfig struct {
+	// Strategy is StrategyAIMD (the default), StrategyVegas or
+	// StrategyGradient2.
+	Strategy string
+	MinLimit int64 // defaults to 1
+	MaxLimit int64 // defaults to 1000; Config.Burst overrides it
+	// Timeout is the latency above which AIMD counts a call as dropped.
+	// Defaults to 5s.
+	Timeout time.Duration
+	// BackoffRatio is what AIMD multiplies the limit by on a drop.
+	// Defaults to 0.9.
+	BackoffRatio float64
+}
+
+// Outcome is how an admitted call fared.
+type Outcome int
+
+const (
+	// OutcomeSuccess means the call completed; its latency is a sample.
+	OutcomeSuccess Outcome = iota
+	// OutcomeDropped means the call failed in a way that signals overload:
+	// a timeout, a 503, a rejected connection.
+	OutcomeDropped
+	// OutcomeIgnored releases the call without a sample, e.g. when it
+	// failed for reasons unrelated to load or never ran.
+	OutcomeIgnored
+)
+
+// Completion reports how an admitted call went. rtt is the call's latency;
+// zero means the time since it was admitted. Only the first call has any
+// effect.
+type Completion func(outcome Outcome, rtt time.Duration)
+
+// JoinCompletions returns a completion that reports to each non-nil one
+// in cs, or nil if there are none.
+func JoinCompletions(cs ...Completion) Completion {
+	var out []Completion
+	for _, c := range cs {
+		if c != nil {
+			out = append(out, c)
+		}
+	}
+	switch len(out) {
+	case 0:
+		return nil
+	case 1:
+		return out[0]
+	}
+	return func(outcome Outcome, rtt time.Duration) {
+		for _, c := range out {
+			c(outcome, rtt)
+		}
+	}
+}
+
+// AdaptiveLimiter admits a call while the key's in-flight calls stay under
+// its current limit, and moves the limit as calls complete: up while
+// latency holds, down as it rises or calls drop. Admitted calls hold their
+// cost until Result.Complete is called, so every admitted call must report
+// back.
+type AdaptiveLimiter struct {
+	cfg   Config
+	state *shardedKeys[*adaptiveKey]
+}
+
+type adaptiveKey struct {
+	mu       sync.Mutex
+	inFlight int64
+	limit    float64
+	lastUsed time.Time
+	strategy limitStrategy
+}
+
+// limitStrategy computes the next limit from one completed call. Callers
+// hold the key's lock.
+type limitStrategy interface {
+	update(limit float64, inFlight int64, rtt time.Duration, dropped bool) float64
+}
+
+func NewAdaptiveLimiter(cfg Config) Limiter {
+	return &AdaptiveLimiter{
+		cfg:   cfg,
+		state: newShardedKeys[*adaptiveKey](cfg),
+	}
+}
+
+// WithConfig keeps every key's limit and in-flight calls. New bounds apply
+// from the next sample.
+func (a *AdaptiveLimiter) WithConfig(cfg Config) Limiter {
+	return &AdaptiveLimiter{cfg: cfg, state: a.state}
+}
+
+// Allow admits the call if cost more in-flight units fit under the
+// current limit. A cost of zero only reads the state.
+func (a *AdaptiveLimiter) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
+	return a.AllowReserved(ctx, key, cost, 0)
+}
+
+// AllowReserved admits the call only if reserve of the current limit is
+// still free after it.
+func (a *AdaptiveLimiter) AllowReserved(ctx context.Context, key string, cost int64, reserve float64) (*Result, error) {
+	now := a.cfg.now()
+	k := a.key(key, now)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.lastUsed = now
+	limit := int64(k.limit)
+	held := reserveUnits(limit, reserve)
+	if cost <= 0 {
+		return a.result(k, now, true, held), nil
+	}
+	if k.inFlight+cost+held > limit {
+		res := a.result(k, now, false, held)
+		// Slots free as calls complete, not on a schedule.
+		res.ResetTime = now.Add(time.Second)
+		res.RetryAfterSeconds = 1
+		return res, nil
+	}
+	k.inFlight += cost
+	res := a.result(k, now, true, held)
+	res.Complete = a.completion(k, cost, now)
+	return res, nil
+}
+
+// GetQuota reports the key's current limit and free slots.
+func (a *AdaptiveLimiter) GetQuota(ctx context.Context, key string) (*Result, error) {
+	now := a.cfg.now()
+	k := a.key(key, now)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return a.result(k, now, true, 0), nil
+}
+
+func (a *AdaptiveLimiter) KeyStats() KeyStats {
+	return a.state.keyStats()
+}
+
+func (a *AdaptiveLimiter) result(k *adaptiveKey, now time.Time, allowed bool, held int64) *Result {
+	limit := int64(k.limit)
+	return &Result{
+		Allowed:   allowed,
+		Remaining: max(limit-k.inFlight-held, 0),
+		Limit:     limit,
+		ResetTime: now,
+	}
+}
+
+// completion releases cost from k and feeds the outcome to its strategy.
+func (a *AdaptiveLimiter) completion(k *adaptiveKey, cost int64, admitted time.Time) Completion {
+	var done atomic.Bool
+	return func(outcome Outcome, rtt time.Duration) {
+		if !done.CompareAndSwap(false, true) {
+			return
+		}
+		now := a.cfg.now()
+		if rtt <= 0 {
+			rtt = now.Sub(admitted)
+		}
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		// The limit is judged against the load the call saw, so sample
+		// before releasing it.
+		if outcome != OutcomeIgnored {
+			minLimit, maxLimit := a.bounds()
+			next := k.strategy.update(k.limit, k.inFlight, rtt, outcome == OutcomeDropped)
+			k.limit = math.Min(math.Max(next, float64(minLimit)), float64(maxLimit))
+		}
+		k.inFlight -= cost
+		k.lastUsed = now
+	}
+}
+
+// key returns the state for key, creating it at the initial limit, and
+// drops keys in the same shard that have had nothing in flight for a
+// sweep interval.
+func (a *AdaptiveLimiter) key(key string, now time.Time) *adaptiveKey {
+	sh := a.state.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	idleAfter := a.cfg.SweepInterval
+	if idleAfter <= 0 {
+		idleAfter = time.Minute
+	}
+	sh.keys.maybeSweep(now, func(k *adaptiveKey) bool {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		return k.inFlight == 0 && now.Sub(k.lastUsed) >= idleAfter
+	})
+
+	k, ok := sh.keys.get(key)
+	if !ok {
+		minLimit, maxLimit := a.bounds()
+		initial := a.cfg.Limit
+		if initial <= 0 {
+			initial = 20
+		}
+		if initial > maxLimit {
+			initial = maxLimit
+		}
+		initial = max(initial, minLimit)
+		k = &adaptiveKey{
+			limit:    float64(initial),
+			lastUsed: now,
+			strategy: a.newStrategy(),
+		}
+		sh.keys.put(key, k)
+	}
+	return k
+}
+
+func (a *AdaptiveLimiter) bounds() (minLimit, maxLimit int64) {
+	minLimit = max(a.cfg.Adaptive.MinLimit, 1)
+	maxLimit = a.cfg.Adaptive.MaxLimit
+	if a.cfg.Burst > 0 {
+		maxLimit = a.cfg.Burst
+	}
+	if maxLimit <= 0 {
+		maxLimit = 1000
+	}
+	return minLimit, max(maxLimit, minLimit)
+}
+
+func (a *AdaptiveLimiter) newStrategy() limitStrategy {
+	ac := a.cfg.Adaptive
+	switch ac.Strategy {
+	case StrategyVegas:
+		return &vegas{}
+	case StrategyGradient2:
+		return &gradient2{}
+	default:
+		timeout := ac.Timeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		ratio := ac.BackoffRatio
+		if ratio <= 0 || ratio >= 1 {
+			ratio = 0.9
+		}
+		return &aimd{timeout: timeout, backoff: ratio}
+	}
+}
+
+// appLimited reports whether so few calls were in flight that a good
+// sample says nothing about a higher limit.
+func appLimited(limit float64, inFlight int64) bool {
+	return float64(inFlight)*2 < limit
+}
+
+// aimd adds one on each good call made under load and backs off
+// multiplicatively on a drop or a call slower than the timeout.
+type aimd struct {
+	timeout time.Duration
+	backoff float64
+}
+
+func (s *aimd) update(limit float64, inFlight int64, rtt time.Duration, dropped bool) float64 {
+	if dropped || rtt > s.timeout {
+		return math.Floor(limit * s.backoff)
+	}
+	if appLimited(limit, inFlight) {
+		return limit
+	}
+	return limit + 1
+}
+
+// vegas estimates how many calls are queued upstream from the ratio of
+// the lowest latency seen to the current one, and steers the limit to
+// keep that queue between alpha and beta, both scaled by log10(limit).
+type vegas struct {
+	minRTT time.Duration
+}
+
+func (s *vegas) update(limit float64, inFlight int64, rtt time.Duration, dropped bool) float64 {
+	if s.minRTT == 0 || rtt < s.minRTT {
+		s.minRTT = rtt
+	}
+	step := math.Max(1, math.Log10(limit))
+	if dropped {
+		return limit - step
+	}
+	if appLimited(limit, inFlight) {
+		return limit
+	}
+	queue := math.Ceil(limit * (1 - float64(s.minRTT)/float64(rtt)))
+	alpha, beta := 3*step, 6*step
+	switch {
+	case queue <= step:
+		return limit + beta
+	case queue < alpha:
+		return limit + step
+	case queue > beta:
+		return limit - step
+	}
+	return limit
+}
+
+// gradient2 compares the latest latency with a long-term average: the
+// limit follows their ratio, capped to [0.5, 1] with a tolerance of 1.5,
+// plus a queue allowance of sqrt(limit), smoothed over several calls.
+type gradient2 struct {
+	longRTT float64 // exponential average over about 600 calls, in ns
+	samples int
+}
+
+const (
+	gradientWindow    = 600
+	gradientTolerance = 1.5
+	gradientSmoothing = 0.2
+)
+
+func (s *gradient2) update(limit float64, inFlight int64, rtt time.Duration, dropped bool) float64 {
+	short := float64(rtt)
+	if s.samples < gradientWindow {
+		// Plain average until the window fills.
+		s.samples++
+		s.longRTT += (short - s.longRTT) / float64(s.samples)
+	} else {
+		s.longRTT += (short - s.longRTT) * 2 / (gradientWindow + 1)
+	}
+	// Let a long-term average left high by a past incident drift down so
+	// the limit can recover.
+	if s.longRTT/short > 2 {
+		s.longRTT *= 0.95
+	}
+	if appLimited(limit, inFlight) && !dropped {
+		return limit
+	}
+
+	gradient := math.Max(0.5, math.Min(1, gradientTolerance*s.longRTT/short))
+	if dropped {
+		gradient = 0.5
+	}
+	next := limit*gradient + math.Sqrt(limit)
+	return limit*(1-gradientSmoothing) + next*gradientSmoothing
+}
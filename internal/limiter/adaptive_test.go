@@ -0,0 +1,125 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+)
+
+func newAdaptive(t *testing.T, strategy string, initial int64) (*AdaptiveLimiter, *clock.Manual) {
+	t.Helper()
+	clk := clock.NewManual(time.Unix(1700000000, 0))
+	l := NewAdaptiveLimiter(Config{
+		Limit:    initial,
+		Clock:    clk,
+		Adaptive: AdaptiveConfig{Strategy: strategy, MaxLimit: 100, Timeout: time.Second},
+	})
+	return l.(*AdaptiveLimiter), clk
+}
+
+// admit takes n slots and returns their completions.
+func admit(t *testing.T, l *AdaptiveLimiter, n int) []Completion {
+	t.Helper()
+	var done []Completion
+	for i := 0; i < n; i++ {
+		res, err := l.Allow(context.Background(), "k", 1)
+		if err != nil || !res.Allowed || res.Complete == nil {
+			t.Fatalf("call %d: res = %+v, err = %v", i, res, err)
+		}
+		done = append(done, res.Complete)
+	}
+	return done
+}
+
+func limitOf(t *testing.T, l *AdaptiveLimiter) int64 {
+	t.Helper()
+	res, err := l.GetQuota(context.Background(), "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.Limit
+}
+
+func TestAdaptiveCapsInFlight(t *testing.T) {
+	l, _ := newAdaptive(t, StrategyAIMD, 2)
+	done := admit(t, l, 2)
+
+	res, _ := l.Allow(context.Background(), "k", 1)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfterSeconds != 1 {
+		t.Errorf("third call: %+v, want denied", res)
+	}
+
+	// Releasing twice frees only one slot.
+	done[0](OutcomeIgnored, 0)
+	done[0](OutcomeIgnored, 0)
+	if res, _ := l.GetQuota(context.Background(), "k"); res.Remaining != 1 || res.Limit != 2 {
+		t.Errorf("quota = %+v, want one free slot of 2", res)
+	}
+}
+
+func TestAdaptiveAIMD(t *testing.T) {
+	l, _ := newAdaptive(t, StrategyAIMD, 10)
+
+	// Good calls made under load raise the limit by one each.
+	for _, done := range admit(t, l, 10) {
+		done(OutcomeSuccess, 10*time.Millisecond)
+	}
+	if got := limitOf(t, l); got < 14 {
+		t.Errorf("limit = %d after good calls under load, want it raised", got)
+	}
+
+	// A lone call says nothing about a higher limit.
+	before := limitOf(t, l)
+	admit(t, l, 1)[0](OutcomeSuccess, 10*time.Millisecond)
+	if got := limitOf(t, l); got != before {
+		t.Errorf("limit = %d after an app-limited call, want %d", got, before)
+	}
+
+	// Drops and timeouts back off multiplicatively.
+	admit(t, l, 1)[0](OutcomeDropped, 0)
+	admit(t, l, 1)[0](OutcomeSuccess, 2*time.Second)
+	if got, want := limitOf(t, l), int64(float64(before)*0.9*0.9); got > want {
+		t.Errorf("limit = %d after two drops, want at most %d", got, want)
+	}
+}
+
+func TestAdaptiveStrategiesBackOffAsLatencyRises(t *testing.T) {
+	for _, strategy := range []string{StrategyVegas, StrategyGradient2} {
+		t.Run(strategy, func(t *testing.T) {
+			l, _ := newAdaptive(t, strategy, 20)
+
+			// Steady latency under load lets the limit grow.
+			for i := 0; i < 20; i++ {
+				for _, done := range admit(t, l, int(limitOf(t, l))) {
+					done(OutcomeSuccess, 10*time.Millisecond)
+				}
+			}
+			grown := limitOf(t, l)
+			if grown <= 20 {
+				t.Fatalf("limit = %d at steady latency, want above 20", grown)
+			}
+
+			// Latency climbing well past its baseline pulls it back.
+			for i := 0; i < 20; i++ {
+				for _, done := range admit(t, l, int(limitOf(t, l))) {
+					done(OutcomeSuccess, 100*time.Millisecond)
+				}
+			}
+			if got := limitOf(t, l); got >= grown {
+				t.Errorf("limit = %d with 10x latency, want below %d", got, grown)
+			}
+		})
+	}
+}
+
+func TestAdaptiveRTTDefaultsToTimeSinceAdmission(t *testing.T) {
+	l, clk := newAdaptive(t, StrategyAIMD, 10)
+	done := admit(t, l, 10)
+	clk.Advance(2 * time.Second) // past the AIMD timeout
+	done[0](OutcomeSuccess, 0)
+	if got := limitOf(t, l); got != 9 {
+		t.Errorf("limit = %d, want 9 after a slow call", got)
+	}
+}
@@ -2,15 +2,13 @@ package limiter
 
 import (
     "context"
-    "sync"
     "time"
 )
 
-// basicLimiter: simple token-bucket per tenant, in-memory.
+// basicLimiter: simple token-bucket per key, in-memory.
 type basicLimiter struct {
 	cfg   Config
-	mu    sync.Mutex
-	state map[string]*bucket
+	state *shardedKeys[*bucket]
 }
 
 type bucket struct {
@@ -21,19 +19,16 @@ type bucket struct {
 func NewBasicLimiter(cfg Config) Limiter {
 	return &basicLimiter{
 		cfg:   cfg,
-		state: make(map[string]*bucket),
+		state: newShardedKeys[*bucket](cfg),
 	}
 }
 
 func (b *basicLimiter) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
-	tenant := key
-	if tenant == "" {
-		tenant = "default"
-	}
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	sh := b.state.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	now := time.Now()
+	now := b.cfg.now()
 	w := b.cfg.Window
 	if w <= 0 {
 		w = time.Minute
@@ -50,10 +45,13 @@ func (b *basicLimiter) Allow(ctx context.Context, key string, cost int64) (*Resu
 	// refill rate: limit per window
 	refillPerSec := float64(limit) / w.Seconds()
 
-	bkt, ok := b.state[tenant]
+	sh.keys.maybeSweep(now, func(bkt *bucket) bool {
+		return bkt.tokens+now.Sub(bkt.lastRefill).Seconds()*refillPerSec >= float64(burst)
+	})
+	bkt, ok := sh.keys.get(key)
 	if !ok {
 		bkt = &bucket{tokens: float64(burst), lastRefill: now}
-		b.state[tenant] = bkt
+		sh.keys.put(key, bkt)
 	}
 
 	// Refill
@@ -67,7 +65,7 @@ func (b *basicLimiter) Allow(ctx context.Context, key string, cost int64) (*Resu
 		bkt.tokens -= need
 	}
 	remaining := int64(bkt.tokens)
-	reset := now.Add(time.Duration((float64(limit)-bkt.tokens)/refillPerSec) * time.Second)
+	reset := bucketReset(now, bkt.tokens, cost, burst, allowed, refillPerSec)
 
 	result := &Result{
 		Allowed:   allowed,
@@ -77,21 +75,18 @@ func (b *basicLimiter) Allow(ctx context.Context, key string, cost int64) (*Resu
 	}
 
 	if !allowed {
-		result.RetryAfterSeconds = int64(reset.Sub(now).Seconds())
+		result.RetryAfterSeconds = retryAfterSeconds(now, reset)
 	}
 
 	return result, nil
 }
 
 func (b *basicLimiter) GetQuota(ctx context.Context, key string) (*Result, error) {
-	tenant := key
-	if tenant == "" {
-		tenant = "default"
-	}
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	sh := b.state.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	now := time.Now()
+	now := b.cfg.now()
 	w := b.cfg.Window
 	if w <= 0 {
 		w = time.Minute
@@ -108,10 +103,13 @@ func (b *basicLimiter) GetQuota(ctx context.Context, key string) (*Result, error
 	// refill rate: limit per window
 	refillPerSec := float64(limit) / w.Seconds()
 
-	bkt, ok := b.state[tenant]
+	sh.keys.maybeSweep(now, func(bkt *bucket) bool {
+		return bkt.tokens+now.Sub(bkt.lastRefill).Seconds()*refillPerSec >= float64(burst)
+	})
+	bkt, ok := sh.keys.get(key)
 	if !ok {
 		bkt = &bucket{tokens: float64(burst), lastRefill: now}
-		b.state[tenant] = bkt
+		sh.keys.put(key, bkt)
 	}
 
 	// Refill
@@ -120,7 +118,7 @@ func (b *basicLimiter) GetQuota(ctx context.Context, key string) (*Result, error
 	bkt.lastRefill = now
 
 	remaining := int64(bkt.tokens)
-	reset := now.Add(time.Duration((float64(limit)-bkt.tokens)/refillPerSec) * time.Second)
+	reset := bucketReset(now, bkt.tokens, 0, burst, true, refillPerSec)
 
 	return &Result{
 		Allowed:   true,
@@ -130,6 +128,11 @@ func (b *basicLimiter) GetQuota(ctx context.Context, key string) (*Result, error
 	}, nil
 }
 
+// KeyStats reports how many keys the limiter tracks and how many it evicted.
+func (b *basicLimiter) KeyStats() KeyStats {
+	return b.state.keyStats()
+}
+
 func minFloat(a, b float64) float64 {
 	if a < b {
 		return a
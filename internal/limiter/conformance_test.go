@@ -0,0 +1,26 @@
+package limiter_test
+
+import (
+	"testing"
+
+	"github.com/xizzxy/helios/internal/limiter"
+	"github.com/xizzxy/helios/internal/limiter/limitertest"
+)
+
+func TestConformanceTokenBucket(t *testing.T) {
+	limitertest.Run(t, func(t *testing.T, cfg limiter.Config) limiter.Limiter {
+		return limiter.NewTokenBucketLimiter(cfg)
+	})
+}
+
+func TestConformanceSlidingWindow(t *testing.T) {
+	limitertest.Run(t, func(t *testing.T, cfg limiter.Config) limiter.Limiter {
+		return limiter.NewSlidingWindowLimiter(cfg)
+	})
+}
+
+func TestConformanceBasic(t *testing.T) {
+	limitertest.Run(t, func(t *testing.T, cfg limiter.Config) limiter.Limiter {
+		return limiter.NewBasicLimiter(cfg)
+	})
+}
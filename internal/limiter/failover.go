@@ -0,0 +1,181 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FallbackPolicy decides what a tenant gets when its backend is unavailable.
+type FallbackPolicy string
+
+const (
+	FallbackOpen   FallbackPolicy = "open"   // allow every request
+	FallbackClosed FallbackPolicy = "closed" // deny every request
+	FallbackLocal  FallbackPolicy = "local"  // degrade to the in-memory limiter
+)
+
+func ParseFallbackPolicy(s string) (FallbackPolicy, error) {
+	switch p := FallbackPolicy(s); p {
+	case FallbackOpen, FallbackClosed, FallbackLocal:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown fallback policy %q", s)
+	}
+}
+
+// Breaker guards calls to a backend. resilience.CircuitBreaker satisfies it.
+type Breaker interface {
+	Execute(fn func() error) error
+}
+
+// FailoverManager routes tenants to a primary manager through a shared
+// breaker and applies each tenant's fallback policy on failure.
+type FailoverManager struct {
+	primary  Manager
+	local    Manager
+	breaker  Breaker
+	fallback FallbackPolicy
+	tenants  map[string]FallbackPolicy
+	cfg      Config
+}
+
+// NewFailoverManager wires primary behind breaker. breaker may be nil, in
+// which case every primary error goes straight to the fallback policy.
+func NewFailoverManager(primary, local Manager, breaker Breaker, fallback FallbackPolicy, tenants map[string]FallbackPolicy, cfg Config) *FailoverManager {
+	return &FailoverManager{
+		primary:  primary,
+		local:    local,
+		breaker:  breaker,
+		fallback: fallback,
+		tenants:  tenants,
+		cfg:      withDefaults(cfg),
+	}
+}
+
+func (m *FailoverManager) ForTenant(tenant string) Limiter {
+	policy, ok := m.tenants[tenant]
+	if !ok {
+		policy = m.fallback
+	}
+	return &failoverLimiter{
+		primary: m.primary.ForTenant(tenant),
+		local:   m.local.ForTenant(tenant),
+		breaker: m.breaker,
+		policy:  policy,
+		cfg:     m.cfg,
+	}
+}
+
+type failoverLimiter struct {
+	primary Limiter
+	local   Limiter
+	breaker Breaker
+	policy  FallbackPolicy
+	cfg     Config
+}
+
+// WithConfig reconfigures both the primary and the local limiter. It
+// returns nil unless both can be.
+func (f *failoverLimiter) WithConfig(cfg Config) Limiter {
+	primary, local := Reconfigure(f.primary, cfg), Reconfigure(f.local, cfg)
+	if primary == nil || local == nil {
+		return nil
+	}
+	return &failoverLimiter{
+		primary: primary,
+		local:   local,
+		breaker: f.breaker,
+		policy:  f.policy,
+		cfg:     withDefaults(cfg),
+	}
+}
+
+func (f *failoverLimiter) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
+	return f.AllowReserved(ctx, key, cost, 0)
+}
+
+// AllowReserved passes the reserve to the primary and, when degrading to
+// it, the local limiter.
+func (f *failoverLimiter) AllowReserved(ctx context.Context, key string, cost int64, reserve float64) (*Result, error) {
+	var res *Result
+	err := f.call(func() error {
+		var err error
+		res, err = AllowReserved(ctx, f.primary, key, cost, reserve)
+		return err
+	})
+	if err == nil {
+		return res, nil
+	}
+	return f.fallbackResult(ctx, key, cost, reserve, err)
+}
+
+// Refund goes to the primary or, if it cannot be reached and the policy
+// is local, to the local limiter that would have decided instead.
+func (f *failoverLimiter) Refund(ctx context.Context, key string, cost int64) error {
+	err := f.call(func() error { return Refund(ctx, f.primary, key, cost) })
+	if err != nil && f.policy == FallbackLocal {
+		return Refund(ctx, f.local, key, cost)
+	}
+	return err
+}
+
+func (f *failoverLimiter) GetQuota(ctx context.Context, key string) (*Result, error) {
+	var res *Result
+	err := f.call(func() error {
+		var err error
+		res, err = f.primary.GetQuota(ctx, key)
+		return err
+	})
+	if err == nil {
+		return res, nil
+	}
+	if f.policy == FallbackLocal {
+		res, err := f.local.GetQuota(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		res.Degraded = true
+		return res, nil
+	}
+	return f.fallbackResult(ctx, key, 0, 0, err)
+}
+
+func (f *failoverLimiter) call(fn func() error) error {
+	if f.breaker == nil {
+		return fn()
+	}
+	return f.breaker.Execute(fn)
+}
+
+func (f *failoverLimiter) fallbackResult(ctx context.Context, key string, cost int64, reserve float64, cause error) (*Result, error) {
+	now := f.cfg.now()
+	switch f.policy {
+	case FallbackOpen:
+		return &Result{
+			Allowed:   true,
+			Remaining: f.cfg.Limit,
+			Limit:     f.cfg.Limit,
+			ResetTime: now,
+			Degraded:  true,
+		}, nil
+	case FallbackClosed:
+		return &Result{
+			Allowed:           false,
+			Remaining:         0,
+			Limit:             f.cfg.Limit,
+			ResetTime:         now.Add(time.Second),
+			RetryAfterSeconds: 1,
+			Degraded:          true,
+		}, nil
+	case FallbackLocal:
+		res, err := AllowReserved(ctx, f.local, key, cost, reserve)
+		if err != nil {
+			return nil, err
+		}
+		res.Degraded = true
+		return res, nil
+	default:
+		return nil, cause
+	}
+}
@@ -0,0 +1,92 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+)
+
+var errBackend = errors.New("backend down")
+
+// brokenLimiter fails every call.
+type brokenLimiter struct{ calls int }
+
+func (b *brokenLimiter) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
+	b.calls++
+	return nil, errBackend
+}
+
+func (b *brokenLimiter) GetQuota(ctx context.Context, key string) (*Result, error) {
+	b.calls++
+	return nil, errBackend
+}
+
+type oneLimiter struct{ l Limiter }
+
+func (m oneLimiter) ForTenant(string) Limiter { return m.l }
+
+// openBreaker rejects every call without running it.
+type openBreaker struct{}
+
+func (openBreaker) Execute(func() error) error { return errors.New("circuit breaker is open") }
+
+func TestFailoverPolicies(t *testing.T) {
+	cfg := Config{Limit: 2, Burst: 2, Window: time.Minute, Clock: clock.NewManual(time.Unix(1700000000, 0))}
+	for _, tc := range []struct {
+		policy   FallbackPolicy
+		breaker  Breaker
+		allowed  []bool
+		wantErr  bool
+		degraded bool
+	}{
+		{policy: FallbackOpen, allowed: []bool{true, true, true}, degraded: true},
+		{policy: FallbackClosed, allowed: []bool{false, false, false}, degraded: true},
+		{policy: FallbackLocal, allowed: []bool{true, true, false}, degraded: true},
+		{policy: FallbackLocal, breaker: openBreaker{}, allowed: []bool{true, true, false}, degraded: true},
+		{policy: "", wantErr: true, allowed: []bool{false}},
+	} {
+		name := string(tc.policy)
+		if tc.breaker != nil {
+			name += " behind an open breaker"
+		}
+		t.Run(name, func(t *testing.T) {
+			primary := &brokenLimiter{}
+			m := NewFailoverManager(oneLimiter{primary}, NewLocalManager(cfg), tc.breaker, FallbackClosed,
+				map[string]FallbackPolicy{"acme": tc.policy}, cfg)
+			l := m.ForTenant("acme")
+			for i, want := range tc.allowed {
+				res, err := l.Allow(context.Background(), "acme:api:k", 1)
+				if tc.wantErr {
+					if !errors.Is(err, errBackend) {
+						t.Fatalf("call %d: err = %v, want the backend error", i, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("call %d: %v", i, err)
+				}
+				if res.Allowed != want || res.Degraded != tc.degraded {
+					t.Errorf("call %d: allowed = %v, degraded = %v, want %v, %v", i, res.Allowed, res.Degraded, want, tc.degraded)
+				}
+			}
+			if _, ok := tc.breaker.(openBreaker); ok && primary.calls != 0 {
+				t.Errorf("open breaker let %d calls through to the primary", primary.calls)
+			}
+		})
+	}
+}
+
+func TestFailoverUsesTenantDefault(t *testing.T) {
+	cfg := Config{Limit: 2, Burst: 2, Window: time.Minute}
+	m := NewFailoverManager(oneLimiter{&brokenLimiter{}}, NewLocalManager(cfg), nil, FallbackOpen,
+		map[string]FallbackPolicy{"acme": FallbackClosed}, cfg)
+	if res, err := m.ForTenant("other").Allow(context.Background(), "k", 1); err != nil || !res.Allowed {
+		t.Errorf("other tenant: %+v, %v, want the default open fallback", res, err)
+	}
+	if res, err := m.ForTenant("acme").Allow(context.Background(), "k", 1); err != nil || res.Allowed {
+		t.Errorf("acme: %+v, %v, want its closed fallback", res, err)
+	}
+}
@@ -0,0 +1,256 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xizzxy/helios/internal/store"
+)
+
+// hybridSyncBatch caps how many keys one sync round trip carries.
+const hybridSyncBatch = 500
+
+// HybridOptions tune how a HybridLimiter reconciles with Redis.
+type HybridOptions struct {
+	// SyncInterval is how often pending consumption is flushed.
+	SyncInterval time.Duration
+	// ErrorBudget is the fraction of the limit the whole cluster may
+	// over-admit between syncs. It is split evenly across live instances.
+	ErrorBudget float64
+	// InstanceID identifies this gateway in the shared instance registry.
+	InstanceID string
+}
+
+// HybridLimiter admits requests from local state and asynchronously
+// reconciles per-key consumption with a fixed-window counter in Redis.
+// Config.Algorithm is ignored; every key is counted per aligned window.
+type HybridLimiter struct {
+	cfg   Config
+	opts  HybridOptions
+	store windowSyncer
+
+	mu        sync.Mutex
+	state     map[string]*hybridWindow
+	instances int64
+
+	syncErrors uint64
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// windowSyncer is the part of the store a HybridLimiter syncs through.
+type windowSyncer interface {
+	SyncWindowCounters(ctx context.Context, keys []string, deltas []int64, ttl time.Duration, instance string, staleAfter time.Duration) ([]int64, int64, error)
+}
+
+type hybridWindow struct {
+	window   int64 // index of the aligned window
+	global   int64 // cluster-wide count at the last sync
+	inflight int64 // sent to Redis but not yet reflected in global
+	pending  int64 // admitted locally but not yet flushed
+}
+
+func NewHybridLimiter(cfg Config, st *store.Client, opts HybridOptions) *HybridLimiter {
+	return newHybridLimiter(cfg, st, opts)
+}
+
+func newHybridLimiter(cfg Config, st windowSyncer, opts HybridOptions) *HybridLimiter {
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = 10 * time.Millisecond
+	}
+	if opts.ErrorBudget < 0 {
+		opts.ErrorBudget = 0
+	}
+
+	h := &HybridLimiter{
+		cfg:       withDefaults(cfg),
+		opts:      opts,
+		store:     st,
+		state:     make(map[string]*hybridWindow),
+		instances: 1,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go h.syncLoop()
+	return h
+}
+
+func (h *HybridLimiter) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.cfg.now()
+	w := h.current(key, now)
+	resetTime := h.windowEnd(w.window)
+	used := w.global + w.inflight + w.pending
+
+	// Consumption stays unsynced until a reply folds it into global, so a
+	// flush in flight does not free up local budget.
+	unsynced := w.inflight + w.pending
+	allowed := used+cost <= h.cfg.Limit
+	if allowed && unsynced > 0 && unsynced+cost > h.allowance() {
+		// Out of local budget until the next sync tells us where the
+		// cluster stands.
+		allowed = false
+		resetTime = now.Add(h.opts.SyncInterval)
+	}
+	if allowed {
+		w.pending += cost
+		used += cost
+	}
+
+	result := &Result{
+		Allowed:   allowed,
+		Remaining: maxInt64(0, h.cfg.Limit-used),
+		Limit:     h.cfg.Limit,
+		ResetTime: resetTime,
+	}
+	if !allowed {
+		result.RetryAfterSeconds = int64(math.Ceil(resetTime.Sub(now).Seconds()))
+	}
+	return result, nil
+}
+
+func (h *HybridLimiter) GetQuota(ctx context.Context, key string) (*Result, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.cfg.now()
+	w := h.current(key, now)
+	resetTime := h.windowEnd(w.window)
+	used := w.global + w.inflight + w.pending
+	if used == 0 {
+		// Nothing used in this window: already at full capacity.
+		resetTime = now
+	}
+	return &Result{
+		Allowed:   true,
+		Remaining: maxInt64(0, h.cfg.Limit-used),
+		Limit:     h.cfg.Limit,
+		ResetTime: resetTime,
+	}, nil
+}
+
+// SyncErrors returns how many flushes to Redis have failed.
+func (h *HybridLimiter) SyncErrors() uint64 {
+	return atomic.LoadUint64(&h.syncErrors)
+}
+
+// Close stops the background sync loop after a final flush.
+func (h *HybridLimiter) Close() error {
+	close(h.stop)
+	<-h.done
+	return nil
+}
+
+// allowance is how much one instance may admit between syncs.
+func (h *HybridLimiter) allowance() int64 {
+	budget := h.opts.ErrorBudget * float64(h.cfg.Limit) / float64(h.instances)
+	return int64(math.Max(1, math.Floor(budget)))
+}
+
+func (h *HybridLimiter) current(key string, now time.Time) *hybridWindow {
+	idx := now.UnixNano() / int64(h.cfg.Window)
+	w, ok := h.state[key]
+	if !ok || w.window != idx {
+		// Unflushed consumption from a finished window no longer matters.
+		w = &hybridWindow{window: idx}
+		h.state[key] = w
+	}
+	return w
+}
+
+func (h *HybridLimiter) windowEnd(idx int64) time.Time {
+	return time.Unix(0, (idx+1)*int64(h.cfg.Window))
+}
+
+func (h *HybridLimiter) syncLoop() {
+	defer close(h.done)
+	ticker := time.NewTicker(h.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.flush()
+		case <-h.stop:
+			h.flush()
+			return
+		}
+	}
+}
+
+type hybridDelta struct {
+	key    string
+	window int64
+	delta  int64
+}
+
+func (h *HybridLimiter) flush() {
+	now := h.cfg.now()
+	idx := now.UnixNano() / int64(h.cfg.Window)
+
+	// Move pending deltas in flight; keys with nothing pending are still
+	// synced so their view of the other instances stays fresh.
+	h.mu.Lock()
+	batch := make([]hybridDelta, 0, len(h.state))
+	for key, w := range h.state {
+		if w.window != idx {
+			delete(h.state, key)
+			continue
+		}
+		batch = append(batch, hybridDelta{key: key, window: w.window, delta: w.pending})
+		w.inflight += w.pending
+		w.pending = 0
+	}
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Window)
+	defer cancel()
+
+	for len(batch) > 0 {
+		n := len(batch)
+		if n > hybridSyncBatch {
+			n = hybridSyncBatch
+		}
+		h.sync(ctx, batch[:n])
+		batch = batch[n:]
+	}
+}
+
+// sync sends one batch of deltas to Redis and settles them: on success
+// global takes the cluster-wide total, which now includes the delta; on
+// failure the delta goes back to pending to be retried on the next tick.
+func (h *HybridLimiter) sync(ctx context.Context, batch []hybridDelta) {
+	keys := make([]string, len(batch))
+	deltas := make([]int64, len(batch))
+	for i, d := range batch {
+		keys[i] = fmt.Sprintf("helios:sync:%s:%d", d.key, d.window)
+		deltas[i] = d.delta
+	}
+	totals, instances, err := h.store.SyncWindowCounters(ctx, keys, deltas, 2*h.cfg.Window, h.opts.InstanceID, 10*h.opts.SyncInterval+time.Second)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		atomic.AddUint64(&h.syncErrors, 1)
+	} else if instances > 0 {
+		h.instances = instances
+	}
+	for i, d := range batch {
+		w, ok := h.state[d.key]
+		if !ok || w.window != d.window {
+			continue
+		}
+		w.inflight -= d.delta
+		if err != nil {
+			w.pending += d.delta
+		} else {
+			w.global = totals[i]
+		}
+	}
+}
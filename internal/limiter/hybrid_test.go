@@ -0,0 +1,205 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+)
+
+// sharedCounter stands in for Redis: one counter per key, shared by every
+// limiter that syncs through it, with a fixed number of live instances.
+type sharedCounter struct {
+	mu        sync.Mutex
+	totals    map[string]int64
+	instances int64
+	calls     int
+	fail      bool
+
+	// When hold is set, syncs signal entered and wait for hold to close.
+	hold    chan struct{}
+	entered chan struct{}
+}
+
+func newSharedCounter(instances int64) *sharedCounter {
+	return &sharedCounter{totals: make(map[string]int64), instances: instances}
+}
+
+func (c *sharedCounter) SyncWindowCounters(ctx context.Context, keys []string, deltas []int64, ttl time.Duration, instance string, staleAfter time.Duration) ([]int64, int64, error) {
+	c.mu.Lock()
+	hold, entered := c.hold, c.entered
+	c.mu.Unlock()
+	if hold != nil {
+		entered <- struct{}{}
+		<-hold
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if c.fail {
+		return nil, 0, errBackend
+	}
+	totals := make([]int64, len(keys))
+	for i, key := range keys {
+		c.totals[key] += deltas[i]
+		totals[i] = c.totals[key]
+	}
+	return totals, c.instances, nil
+}
+
+// holdSyncs makes syncs block until the returned function is called.
+func (c *sharedCounter) holdSyncs(n int) (entered <-chan struct{}, release func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hold = make(chan struct{})
+	c.entered = make(chan struct{}, n)
+	hold := c.hold
+	return c.entered, func() {
+		c.mu.Lock()
+		c.hold = nil
+		c.mu.Unlock()
+		close(hold)
+	}
+}
+
+func newTestHybrid(t *testing.T, counter *sharedCounter, clk clock.Clock, budget float64) *HybridLimiter {
+	t.Helper()
+	cfg := Config{Limit: 100, Window: time.Minute, Clock: clk}
+	// The loop never ticks; tests flush by hand.
+	h := newHybridLimiter(cfg, counter, HybridOptions{SyncInterval: time.Hour, ErrorBudget: budget, InstanceID: t.Name()})
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// drain calls Allow until it denies and returns how many it admitted.
+func drain(t *testing.T, h *HybridLimiter) int64 {
+	t.Helper()
+	var n int64
+	for {
+		res, err := h.Allow(context.Background(), "k", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed {
+			return n
+		}
+		n++
+	}
+}
+
+func TestHybridCountsInflightSyncs(t *testing.T) {
+	counter := newSharedCounter(1)
+	h := newTestHybrid(t, counter, clock.NewManual(time.Unix(1700000000, 0)), 0.1)
+
+	if n := drain(t, h); n != 10 {
+		t.Fatalf("admitted %d before the first sync, want the allowance of 10", n)
+	}
+
+	entered, release := counter.holdSyncs(1)
+	flushed := make(chan struct{})
+	go func() {
+		h.flush()
+		close(flushed)
+	}()
+	<-entered
+	if n := drain(t, h); n != 0 {
+		t.Errorf("admitted %d while the sync was in flight, want 0", n)
+	}
+	if res, _ := h.GetQuota(context.Background(), "k"); res.Remaining != 90 {
+		t.Errorf("remaining = %d while the sync was in flight, want 90", res.Remaining)
+	}
+	release()
+	<-flushed
+
+	if n := drain(t, h); n != 10 {
+		t.Errorf("admitted %d after the sync, want another 10", n)
+	}
+}
+
+func TestHybridRetriesFailedSyncs(t *testing.T) {
+	counter := newSharedCounter(1)
+	h := newTestHybrid(t, counter, clock.NewManual(time.Unix(1700000000, 0)), 0.1)
+	drain(t, h)
+
+	counter.fail = true
+	h.flush()
+	if h.SyncErrors() != 1 {
+		t.Errorf("sync errors = %d, want 1", h.SyncErrors())
+	}
+	if n := drain(t, h); n != 0 {
+		t.Errorf("admitted %d after a failed sync, want 0", n)
+	}
+
+	counter.fail = false
+	h.flush()
+	for key, total := range counter.totals {
+		if total != 10 {
+			t.Errorf("%s = %d after the retry, want 10", key, total)
+		}
+	}
+}
+
+// Instances that sync concurrently must not over-admit by more than the
+// error budget, however the syncs interleave with admissions.
+func TestHybridOverAdmissionBound(t *testing.T) {
+	const instances = 3
+	counter := newSharedCounter(instances)
+	clk := clock.NewManual(time.Unix(1700000000, 0))
+	var hs []*HybridLimiter
+	for i := 0; i < instances; i++ {
+		hs = append(hs, newTestHybrid(t, counter, clk, 0.3))
+	}
+
+	var admitted int64
+	for round := 0; ; round++ {
+		var n int64
+		for _, h := range hs {
+			n += drain(t, h)
+		}
+		if n == 0 {
+			break
+		}
+		admitted += n
+
+		// Every instance flushes at once; none may admit until its reply.
+		entered, release := counter.holdSyncs(instances)
+		var wg sync.WaitGroup
+		for _, h := range hs {
+			wg.Add(1)
+			go func(h *HybridLimiter) {
+				defer wg.Done()
+				h.flush()
+			}(h)
+		}
+		for range hs {
+			<-entered
+		}
+		for i, h := range hs {
+			if n := drain(t, h); n != 0 {
+				t.Fatalf("round %d: instance %d admitted %d with a sync in flight", round, i, n)
+			}
+		}
+		release()
+		wg.Wait()
+	}
+
+	if admitted < 100 || admitted > 130 {
+		t.Errorf("admitted %d across the cluster, want between the limit of 100 and 130", admitted)
+	}
+}
+
+func TestHybridBatchesKeys(t *testing.T) {
+	counter := newSharedCounter(1)
+	h := newTestHybrid(t, counter, clock.NewManual(time.Unix(1700000000, 0)), 0.1)
+	for i := 0; i < 2*hybridSyncBatch+1; i++ {
+		h.Allow(context.Background(), fmt.Sprintf("k%d", i), 1)
+	}
+	h.flush()
+	if counter.calls != 3 {
+		t.Errorf("%d keys took %d round trips, want 3", 2*hybridSyncBatch+1, counter.calls)
+	}
+}
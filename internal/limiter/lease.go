@@ -0,0 +1,265 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xizzxy/helios/internal/store"
+)
+
+// LeaseOptions tune how much quota a LeaseLimiter borrows at a time.
+type LeaseOptions struct {
+	// TTL is how long a lease may be spent before leftovers are returned.
+	TTL time.Duration
+	// MaxFraction caps a lease at this share of the tokens left in Redis.
+	MaxFraction float64
+}
+
+// LeaseLimiter borrows blocks of a key's token bucket from Redis and spends
+// them locally. Lease size follows the key's observed consumption rate, so
+// hot keys renew rarely while idle keys hold little quota hostage.
+type LeaseLimiter struct {
+	cfg   Config
+	opts  LeaseOptions
+	store *store.Client
+
+	mu     sync.Mutex
+	leases map[string]*lease
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type lease struct {
+	mu        sync.Mutex
+	tokens    int64     // unspent tokens held locally
+	expires   time.Time // when leftovers go back to Redis
+	started   time.Time
+	consumed  int64     // spent from the current lease
+	rate      float64   // EWMA of tokens per second
+	remaining int64     // tokens left in Redis after the last grant
+	resetTime time.Time // when the Redis bucket is full again
+	dead      bool      // dropped by the reaper; look the key up again
+}
+
+func NewLeaseLimiter(cfg Config, st *store.Client, opts LeaseOptions) *LeaseLimiter {
+	if opts.TTL <= 0 {
+		opts.TTL = time.Second
+	}
+	if opts.MaxFraction <= 0 || opts.MaxFraction > 1 {
+		opts.MaxFraction = 0.1
+	}
+
+	l := &LeaseLimiter{
+		cfg:    withDefaults(cfg),
+		opts:   opts,
+		store:  st,
+		leases: make(map[string]*lease),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go l.reapLoop()
+	return l
+}
+
+func (l *LeaseLimiter) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
+	ls := l.lockedLease(key)
+	defer ls.mu.Unlock()
+
+	now := l.cfg.now()
+	if cost <= 0 {
+		// A read reports the lease as it stands rather than borrowing a
+		// new block; only a key never leased asks Redis, without borrowing.
+		if ls.resetTime.IsZero() {
+			if err := l.read(ctx, key, ls); err != nil {
+				return nil, err
+			}
+		}
+	} else if ls.tokens < cost || !now.Before(ls.expires) {
+		if err := l.renew(ctx, key, ls, cost, now); err != nil {
+			return nil, err
+		}
+	}
+
+	allowed := ls.tokens >= cost
+	if allowed {
+		ls.tokens -= cost
+		ls.consumed += cost
+	}
+
+	result := &Result{
+		Allowed:   allowed,
+		Remaining: ls.tokens + ls.remaining,
+		Limit:     l.cfg.Limit,
+		ResetTime: ls.resetTime,
+	}
+	if !allowed {
+		// Time until Redis has refilled enough for this cost.
+		refillPerSec := float64(l.cfg.Limit) / l.cfg.Window.Seconds()
+		wait := float64(cost-ls.tokens-ls.remaining) / refillPerSec
+		result.ResetTime = now.Add(time.Duration(wait * float64(time.Second)))
+		result.RetryAfterSeconds = int64(math.Ceil(wait))
+	}
+	return result, nil
+}
+
+func (l *LeaseLimiter) GetQuota(ctx context.Context, key string) (*Result, error) {
+	ls := l.lockedLease(key)
+	defer ls.mu.Unlock()
+
+	// Read the bucket so refills since the last lease show up.
+	if err := l.read(ctx, key, ls); err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Allowed:   true,
+		Remaining: ls.tokens + ls.remaining,
+		Limit:     l.cfg.Limit,
+		ResetTime: ls.resetTime,
+	}, nil
+}
+
+// Close stops the reaper and returns every outstanding lease.
+func (l *LeaseLimiter) Close() error {
+	close(l.stop)
+	<-l.done
+	return nil
+}
+
+// lockedLease returns the live lease for key with its mutex held.
+func (l *LeaseLimiter) lockedLease(key string) *lease {
+	for {
+		l.mu.Lock()
+		ls, ok := l.leases[key]
+		if !ok {
+			ls = &lease{}
+			l.leases[key] = ls
+		}
+		l.mu.Unlock()
+
+		ls.mu.Lock()
+		if !ls.dead {
+			return ls
+		}
+		ls.mu.Unlock()
+	}
+}
+
+// read refreshes what Redis has left for key without borrowing. Callers
+// hold ls.mu.
+func (l *LeaseLimiter) read(ctx context.Context, key string, ls *lease) error {
+	_, remaining, resetTime, err := l.store.LeaseTokens(ctx, key,
+		l.cfg.Limit, windowSeconds(l.cfg.Window), l.cfg.Burst, 0, 0, l.opts.MaxFraction)
+	if err != nil {
+		return err
+	}
+	ls.remaining = remaining
+	ls.resetTime = resetTime
+	return nil
+}
+
+// renew returns leftovers and borrows a new block sized from the observed
+// rate. Callers hold ls.mu.
+func (l *LeaseLimiter) renew(ctx context.Context, key string, ls *lease, cost int64, now time.Time) error {
+	if !ls.started.IsZero() {
+		if elapsed := now.Sub(ls.started).Seconds(); elapsed > 0 {
+			observed := float64(ls.consumed) / elapsed
+			if ls.rate == 0 {
+				ls.rate = observed
+			} else {
+				ls.rate = 0.5*ls.rate + 0.5*observed
+			}
+		}
+	}
+
+	// Expired leftovers go back first; fresh ones are kept and topped up.
+	if ls.tokens > 0 && !now.Before(ls.expires) {
+		if err := l.store.ReturnTokens(ctx, key, ls.tokens, l.cfg.Burst); err != nil {
+			return err
+		}
+		ls.tokens = 0
+	}
+
+	want := int64(math.Ceil(ls.rate * l.opts.TTL.Seconds()))
+	if want < cost {
+		want = cost
+	}
+	minGrant := cost - ls.tokens
+	if minGrant < 0 {
+		minGrant = 0
+	}
+
+	granted, remaining, resetTime, err := l.store.LeaseTokens(ctx, key,
+		l.cfg.Limit, windowSeconds(l.cfg.Window), l.cfg.Burst, want, minGrant, l.opts.MaxFraction)
+	if err != nil {
+		return err
+	}
+
+	ls.tokens += granted
+	ls.remaining = remaining
+	ls.resetTime = resetTime
+	if granted > 0 {
+		ls.started = now
+		ls.consumed = 0
+		ls.expires = now.Add(l.opts.TTL)
+	}
+	return nil
+}
+
+func (l *LeaseLimiter) reapLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.opts.TTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.reap(l.cfg.now(), false)
+		case <-l.stop:
+			l.reap(l.cfg.now(), true)
+			return
+		}
+	}
+}
+
+// reap returns expired leases (or all of them when closing) and forgets
+// keys that have been idle for a full lease period.
+func (l *LeaseLimiter) reap(now time.Time, all bool) {
+	l.mu.Lock()
+	keys := make([]string, 0, len(l.leases))
+	for key := range l.leases {
+		keys = append(keys, key)
+	}
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.TTL)
+	defer cancel()
+
+	for _, key := range keys {
+		l.mu.Lock()
+		ls := l.leases[key]
+		l.mu.Unlock()
+		if ls == nil {
+			continue
+		}
+
+		ls.mu.Lock()
+		if all || !now.Before(ls.expires) {
+			if ls.tokens > 0 {
+				if err := l.store.ReturnTokens(ctx, key, ls.tokens, l.cfg.Burst); err == nil {
+					ls.tokens = 0
+				}
+			}
+			if ls.tokens == 0 && now.Sub(ls.expires) > l.opts.TTL {
+				ls.dead = true
+				l.mu.Lock()
+				delete(l.leases, key)
+				l.mu.Unlock()
+			}
+		}
+		ls.mu.Unlock()
+	}
+}
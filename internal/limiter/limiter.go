@@ -2,7 +2,10 @@ package limiter
 
 import (
 	"context"
+	"math"
 	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
 )
 
 type Algorithm string
@@ -18,6 +21,38 @@ type Config struct {
 	Window time.Duration
 	// Algorithm is ignored in the demo limiter but kept for compatibility
 	Algorithm Algorithm
+	// Cluster, when set, lets in-memory limiters account for consumption
+	// on other gateways. nil means only local traffic counts.
+	Cluster ClusterUsage
+	// MaxKeys caps how many keys an in-memory limiter tracks. The cap is
+	// split evenly across shards and each shard drops its least recently
+	// used key beyond its share. 0 means no cap.
+	MaxKeys int
+	// SweepInterval is how often idle keys (a full bucket, an empty
+	// window) are dropped. Defaults to one minute.
+	SweepInterval time.Duration
+	// Shards is how many independently locked partitions in-memory state
+	// is hashed across. Defaults to 4×GOMAXPROCS, rounded up to a power
+	// of two.
+	Shards int
+	// Clock supplies the current time; nil means the wall clock. Tests
+	// and simulations pass a clock.Manual.
+	Clock clock.Clock
+	// Adaptive tunes AlgoAdaptive limiters.
+	Adaptive AdaptiveConfig
+}
+
+func (c Config) now() time.Time {
+	return clock.Or(c.Clock).Now()
+}
+
+// ClusterUsage shares per-key consumption between gateways.
+// cluster.Gossiper implements it.
+type ClusterUsage interface {
+	// Add records cost consumed locally for key.
+	Add(key string, cost int64)
+	// Remote returns the running total other gateways consumed for key.
+	Remote(key string) int64
 }
 
 type Limiter interface {
@@ -25,11 +60,100 @@ type Limiter interface {
 	GetQuota(ctx context.Context, key string) (*Result, error)
 }
 
+// Reserver is implemented by limiters that can hold part of a key's
+// capacity back for higher priority calls.
+type Reserver interface {
+	// AllowReserved is Allow, except that the call is admitted only if
+	// reserve, a fraction of the key's capacity, is still left after it.
+	// Remaining excludes the reserve.
+	AllowReserved(ctx context.Context, key string, cost int64, reserve float64) (*Result, error)
+}
+
+// AllowReserved calls l.AllowReserved if l is a Reserver and l.Allow,
+// ignoring the reserve, otherwise.
+func AllowReserved(ctx context.Context, l Limiter, key string, cost int64, reserve float64) (*Result, error) {
+	if r, ok := l.(Reserver); ok && reserve > 0 {
+		return r.AllowReserved(ctx, key, cost, reserve)
+	}
+	return l.Allow(ctx, key, cost)
+}
+
+// Reconfigurer is implemented by limiters that can take new settings
+// without losing the state of any key.
+type Reconfigurer interface {
+	// WithConfig returns a limiter with cfg that shares this one's state.
+	// cfg must keep the algorithm; the receiver should no longer be used.
+	WithConfig(cfg Config) Limiter
+}
+
+// Reconfigure returns a limiter with cfg that keeps l's state, or nil if l
+// cannot be reconfigured.
+func Reconfigure(l Limiter, cfg Config) Limiter {
+	if r, ok := l.(Reconfigurer); ok {
+		return r.WithConfig(cfg)
+	}
+	return nil
+}
+
+// Refunder is implemented by limiters that can give back what an admitted
+// call was charged, for when the call is turned away after all.
+type Refunder interface {
+	// Refund returns cost to key's capacity, never beyond its maximum.
+	Refund(ctx context.Context, key string, cost int64) error
+}
+
+// Refund calls l.Refund if l is a Refunder and does nothing otherwise.
+func Refund(ctx context.Context, l Limiter, key string, cost int64) error {
+	if r, ok := l.(Refunder); ok && cost > 0 {
+		return r.Refund(ctx, key, cost)
+	}
+	return nil
+}
+
+// reserveUnits is the whole number of units a reserve fraction holds back
+// from capacity, rounded up.
+func reserveUnits(capacity int64, reserve float64) int64 {
+	if reserve <= 0 {
+		return 0
+	}
+	// Round away float noise so 0.2 of 10 holds back 2, not 3.
+	return int64(math.Ceil(math.Round(reserve*float64(capacity)*1e6) / 1e6))
+}
+
 // Result represents the outcome of a rate limit check
 type Result struct {
-	Allowed           bool      `json:"allowed"`
-	Remaining         int64     `json:"remaining"`
-	Limit             int64     `json:"limit"`
-	ResetTime         time.Time `json:"reset_time"`
-	RetryAfterSeconds int64     `json:"retry_after_seconds,omitempty"`
+	Allowed   bool  `json:"allowed"`
+	Remaining int64 `json:"remaining"`
+	Limit     int64 `json:"limit"`
+	// ResetTime is when the key is back at full capacity or, for a denial,
+	// the earliest time the same request could be admitted.
+	ResetTime time.Time `json:"reset_time"`
+	// RetryAfterSeconds is the wait until ResetTime, rounded up.
+	RetryAfterSeconds int64 `json:"retry_after_seconds,omitempty"`
+	// Degraded is set when the decision came from a fallback policy
+	// instead of the configured backend.
+	Degraded bool `json:"degraded,omitempty"`
+	// Complete is set when the limiter needs to hear how an admitted call
+	// went (AlgoAdaptive). The caller must call it once the call finishes.
+	Complete Completion `json:"-"`
+}
+
+// refillAt returns when a bucket holding tokens, refilling at refillPerSec,
+// will hold want tokens.
+func refillAt(now time.Time, tokens, want, refillPerSec float64) time.Time {
+	if tokens >= want {
+		return now
+	}
+	// Round away float noise so exact waits stay exact.
+	wait := math.Round((want - tokens) / refillPerSec * float64(time.Second))
+	return now.Add(time.Duration(wait))
+}
+
+// retryAfterSeconds rounds the wait until at up to whole seconds, so a
+// client that honours it never retries early.
+func retryAfterSeconds(now, at time.Time) int64 {
+	if !at.After(now) {
+		return 0
+	}
+	return int64(math.Ceil(at.Sub(now).Seconds()))
 }
@@ -0,0 +1,233 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+)
+
+// step advances the clock, then calls Allow (or GetQuota) and checks the
+// result. resetIn is ResetTime relative to the clock after advancing.
+type step struct {
+	advance    time.Duration
+	cost       int64
+	quota      bool
+	allowed    bool
+	remaining  int64
+	resetIn    time.Duration
+	retryAfter int64
+}
+
+type limiterCase struct {
+	name  string
+	cfg   Config
+	steps []step
+}
+
+func runCases(t *testing.T, newLimiter func(Config) Limiter, cases []limiterCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clk := clock.NewManual(time.Unix(1700000000, 0))
+			cfg := tc.cfg
+			cfg.Clock = clk
+			l := newLimiter(cfg)
+
+			for i, s := range tc.steps {
+				clk.Advance(s.advance)
+
+				var res *Result
+				var err error
+				if s.quota {
+					res, err = l.GetQuota(context.Background(), "acme:api:key")
+				} else {
+					res, err = l.Allow(context.Background(), "acme:api:key", s.cost)
+				}
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+
+				if res.Allowed != s.allowed {
+					t.Errorf("step %d: Allowed = %v, want %v", i, res.Allowed, s.allowed)
+				}
+				if res.Remaining != s.remaining {
+					t.Errorf("step %d: Remaining = %d, want %d", i, res.Remaining, s.remaining)
+				}
+				if got := res.ResetTime.Sub(clk.Now()); got != s.resetIn {
+					t.Errorf("step %d: ResetTime in %v, want %v", i, got, s.resetIn)
+				}
+				if res.RetryAfterSeconds != s.retryAfter {
+					t.Errorf("step %d: RetryAfterSeconds = %d, want %d", i, res.RetryAfterSeconds, s.retryAfter)
+				}
+				if res.Limit != tc.cfg.Limit {
+					t.Errorf("step %d: Limit = %d, want %d", i, res.Limit, tc.cfg.Limit)
+				}
+			}
+		})
+	}
+}
+
+// One token per second unless a case says otherwise.
+var tokenBucketCases = []limiterCase{
+	{
+		name: "burst then deny",
+		cfg:  Config{Limit: 10, Burst: 10, Window: 10 * time.Second},
+		steps: []step{
+			{cost: 4, allowed: true, remaining: 6, resetIn: 4 * time.Second},
+			{cost: 6, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+			{cost: 1, allowed: false, remaining: 0, resetIn: time.Second, retryAfter: 1},
+		},
+	},
+	{
+		name: "refill",
+		cfg:  Config{Limit: 10, Burst: 10, Window: 10 * time.Second},
+		steps: []step{
+			{cost: 10, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+			{advance: 3 * time.Second, cost: 3, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+			{advance: 500 * time.Millisecond, cost: 1, allowed: false, remaining: 0, resetIn: 500 * time.Millisecond, retryAfter: 1},
+			{advance: 500 * time.Millisecond, cost: 1, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+		},
+	},
+	{
+		name: "refill never exceeds burst",
+		cfg:  Config{Limit: 10, Burst: 5, Window: 10 * time.Second},
+		steps: []step{
+			{cost: 5, allowed: true, remaining: 0, resetIn: 5 * time.Second},
+			{advance: time.Hour, quota: true, allowed: true, remaining: 5},
+			{cost: 1, allowed: true, remaining: 4, resetIn: time.Second},
+		},
+	},
+	{
+		name: "burst above limit",
+		cfg:  Config{Limit: 10, Burst: 20, Window: 10 * time.Second},
+		steps: []step{
+			{cost: 20, allowed: true, remaining: 0, resetIn: 20 * time.Second},
+			{cost: 3, allowed: false, remaining: 0, resetIn: 3 * time.Second, retryAfter: 3},
+		},
+	},
+	{
+		name: "cost greater than burst",
+		cfg:  Config{Limit: 10, Burst: 5, Window: 10 * time.Second},
+		steps: []step{
+			{cost: 6, allowed: false, remaining: 5},
+			{cost: 2, allowed: true, remaining: 3, resetIn: 2 * time.Second},
+			{cost: 6, allowed: false, remaining: 3, resetIn: 2 * time.Second, retryAfter: 2},
+		},
+	},
+	{
+		name: "retry after rounds up",
+		cfg:  Config{Limit: 4, Burst: 4, Window: 10 * time.Second},
+		steps: []step{
+			{cost: 4, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+			{cost: 1, allowed: false, remaining: 0, resetIn: 2500 * time.Millisecond, retryAfter: 3},
+			{advance: 2 * time.Second, cost: 1, allowed: false, remaining: 0, resetIn: 500 * time.Millisecond, retryAfter: 1},
+		},
+	},
+	{
+		name: "quota does not consume",
+		cfg:  Config{Limit: 10, Burst: 10, Window: 10 * time.Second},
+		steps: []step{
+			{quota: true, allowed: true, remaining: 10},
+			{cost: 7, allowed: true, remaining: 3, resetIn: 7 * time.Second},
+			{advance: 2 * time.Second, quota: true, allowed: true, remaining: 5, resetIn: 5 * time.Second},
+			{quota: true, allowed: true, remaining: 5, resetIn: 5 * time.Second},
+		},
+	},
+	{
+		name: "zero cost",
+		cfg:  Config{Limit: 10, Burst: 10, Window: 10 * time.Second},
+		steps: []step{
+			{cost: 10, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+			{cost: 0, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+		},
+	},
+}
+
+func TestTokenBucket(t *testing.T) {
+	runCases(t, NewTokenBucketLimiter, tokenBucketCases)
+}
+
+func TestBasicLimiter(t *testing.T) {
+	runCases(t, NewBasicLimiter, tokenBucketCases)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	runCases(t, NewSlidingWindowLimiter, []limiterCase{
+		{
+			name: "burst then deny",
+			cfg:  Config{Limit: 5, Window: 10 * time.Second},
+			steps: []step{
+				{cost: 5, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+				{cost: 1, allowed: false, remaining: 0, resetIn: 10 * time.Second, retryAfter: 10},
+			},
+		},
+		{
+			name: "requests expire one window later",
+			cfg:  Config{Limit: 5, Window: 10 * time.Second},
+			steps: []step{
+				{cost: 2, allowed: true, remaining: 3, resetIn: 10 * time.Second},
+				{advance: 4 * time.Second, cost: 3, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+				// The two oldest requests expire at t=10s...
+				{advance: time.Second, cost: 1, allowed: false, remaining: 0, resetIn: 5 * time.Second, retryAfter: 5},
+				// ...but room for three needs one from t=4s to go too.
+				{cost: 3, allowed: false, remaining: 0, resetIn: 9 * time.Second, retryAfter: 9},
+				{advance: 5 * time.Second, cost: 2, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+			},
+		},
+		{
+			name: "cost greater than limit",
+			cfg:  Config{Limit: 5, Window: 10 * time.Second},
+			steps: []step{
+				{cost: 6, allowed: false, remaining: 5},
+				{cost: 1, allowed: true, remaining: 4, resetIn: 10 * time.Second},
+				{advance: 2 * time.Second, cost: 6, allowed: false, remaining: 4, resetIn: 8 * time.Second, retryAfter: 8},
+			},
+		},
+		{
+			name: "retry after rounds up",
+			cfg:  Config{Limit: 1, Window: 10 * time.Second},
+			steps: []step{
+				{cost: 1, allowed: true, remaining: 0, resetIn: 10 * time.Second},
+				{advance: 2500 * time.Millisecond, cost: 1, allowed: false, remaining: 0, resetIn: 7500 * time.Millisecond, retryAfter: 8},
+			},
+		},
+		{
+			name: "quota does not consume",
+			cfg:  Config{Limit: 5, Window: 10 * time.Second},
+			steps: []step{
+				{quota: true, allowed: true, remaining: 5},
+				{cost: 3, allowed: true, remaining: 2, resetIn: 10 * time.Second},
+				{advance: 4 * time.Second, quota: true, allowed: true, remaining: 2, resetIn: 6 * time.Second},
+				{advance: 6 * time.Second, quota: true, allowed: true, remaining: 5},
+			},
+		},
+	})
+}
+
+func TestManualClockDrivesSweeps(t *testing.T) {
+	clk := clock.NewManual(time.Unix(1700000000, 0))
+	l := NewTokenBucketLimiter(Config{
+		Limit:         10,
+		Window:        10 * time.Second,
+		Shards:        1,
+		SweepInterval: time.Minute,
+		Clock:         clk,
+	})
+
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := l.Allow(context.Background(), key, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clk.Advance(time.Minute)
+	if _, err := l.Allow(context.Background(), "d", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := l.(KeyTracker).KeyStats()
+	if stats.Keys != 1 || stats.IdleEvictions != 3 {
+		t.Fatalf("KeyStats = %+v, want 1 key and 3 idle evictions", stats)
+	}
+}
@@ -0,0 +1,291 @@
+// Package limitertest is a conformance suite for limiter.Limiter. Every
+// implementation, in memory or backed by a store, runs it so that callers
+// see the same semantics whichever one the gateway picks.
+package limitertest
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+	"github.com/xizzxy/helios/internal/limiter"
+)
+
+// Factory builds the limiter under test with no prior state. cfg.Clock is a
+// *clock.Manual that the suite advances; the limiter, and any store behind
+// it, must read time only through it.
+type Factory func(t *testing.T, cfg limiter.Config) limiter.Limiter
+
+const (
+	capacity = 10
+	window   = 10 * time.Second
+)
+
+type harness struct {
+	t   *testing.T
+	l   limiter.Limiter
+	clk *clock.Manual
+}
+
+func newHarness(t *testing.T, factory Factory) *harness {
+	// A whole-millisecond start keeps stores with millisecond timestamps exact.
+	clk := clock.NewManual(time.Unix(1700000000, 0))
+	l := factory(t, limiter.Config{
+		Limit:  capacity,
+		Burst:  capacity,
+		Window: window,
+		Clock:  clk,
+	})
+	return &harness{t: t, l: l, clk: clk}
+}
+
+func (h *harness) allow(key string, cost int64) *limiter.Result {
+	h.t.Helper()
+	res, err := h.l.Allow(context.Background(), key, cost)
+	if err != nil {
+		h.t.Fatalf("Allow(%q, %d): %v", key, cost, err)
+	}
+	h.checkCommon(res)
+	return res
+}
+
+func (h *harness) quota(key string) *limiter.Result {
+	h.t.Helper()
+	res, err := h.l.GetQuota(context.Background(), key)
+	if err != nil {
+		h.t.Fatalf("GetQuota(%q): %v", key, err)
+	}
+	h.checkCommon(res)
+	if !res.Allowed {
+		h.t.Errorf("GetQuota: Allowed = false, want true")
+	}
+	return res
+}
+
+// checkCommon asserts the invariants that hold for every result.
+func (h *harness) checkCommon(res *limiter.Result) {
+	h.t.Helper()
+	now := h.clk.Now()
+	if res.Limit != capacity {
+		h.t.Errorf("Limit = %d, want %d", res.Limit, capacity)
+	}
+	if res.Remaining < 0 || res.Remaining > capacity {
+		h.t.Errorf("Remaining = %d, want within [0, %d]", res.Remaining, capacity)
+	}
+	if res.ResetTime.Before(now) {
+		h.t.Errorf("ResetTime %v is before now %v", res.ResetTime, now)
+	}
+	var wantRetry int64
+	if !res.Allowed {
+		wantRetry = int64(math.Ceil(res.ResetTime.Sub(now).Seconds()))
+	}
+	if res.RetryAfterSeconds != wantRetry {
+		h.t.Errorf("RetryAfterSeconds = %d, want %d (ResetTime in %v, allowed %v)",
+			res.RetryAfterSeconds, wantRetry, res.ResetTime.Sub(now), res.Allowed)
+	}
+}
+
+func (h *harness) exhaust(key string) {
+	h.t.Helper()
+	if res := h.allow(key, capacity); !res.Allowed {
+		h.t.Fatalf("Allow(%q, %d) on a fresh key was denied", key, capacity)
+	}
+}
+
+func expectRemaining(t *testing.T, res *limiter.Result, want int64) {
+	t.Helper()
+	if res.Remaining != want {
+		t.Errorf("Remaining = %d, want %d", res.Remaining, want)
+	}
+}
+
+// Run checks the semantics every limiter.Limiter must share, using a
+// capacity (Limit and Burst) of 10 per 10s window, and those of
+// limiter.Reserver where implemented.
+func Run(t *testing.T, factory Factory) {
+	t.Run("fresh key has full quota", func(t *testing.T) {
+		h := newHarness(t, factory)
+		res := h.quota("k")
+		expectRemaining(t, res, capacity)
+		if !res.ResetTime.Equal(h.clk.Now()) {
+			t.Errorf("ResetTime in %v, want now", res.ResetTime.Sub(h.clk.Now()))
+		}
+	})
+
+	t.Run("allow consumes cost", func(t *testing.T) {
+		h := newHarness(t, factory)
+		res := h.allow("k", 3)
+		if !res.Allowed {
+			t.Fatal("Allow denied within capacity")
+		}
+		expectRemaining(t, res, capacity-3)
+		if !res.ResetTime.After(h.clk.Now()) || res.ResetTime.After(h.clk.Now().Add(window)) {
+			t.Errorf("ResetTime in %v, want within (0, %v]", res.ResetTime.Sub(h.clk.Now()), window)
+		}
+		expectRemaining(t, h.quota("k"), capacity-3)
+	})
+
+	t.Run("quota does not consume", func(t *testing.T) {
+		h := newHarness(t, factory)
+		h.allow("k", 4)
+		for i := 0; i < 3; i++ {
+			expectRemaining(t, h.quota("k"), capacity-4)
+		}
+	})
+
+	t.Run("denial consumes nothing", func(t *testing.T) {
+		h := newHarness(t, factory)
+		h.allow("k", 7)
+		res := h.allow("k", 5)
+		if res.Allowed {
+			t.Fatal("Allow beyond capacity was admitted")
+		}
+		expectRemaining(t, res, capacity-7)
+		if !res.ResetTime.After(h.clk.Now()) {
+			t.Error("denial ResetTime is not in the future")
+		}
+		expectRemaining(t, h.quota("k"), capacity-7)
+		if res := h.allow("k", 3); !res.Allowed {
+			t.Error("remaining capacity was lost to a denial")
+		}
+	})
+
+	t.Run("denial reset time is exact", func(t *testing.T) {
+		h := newHarness(t, factory)
+		h.exhaust("k")
+		res := h.allow("k", 1)
+		if res.Allowed {
+			t.Fatal("Allow on an exhausted key was admitted")
+		}
+		h.clk.Set(res.ResetTime.Add(-time.Millisecond))
+		if h.allow("k", 1).Allowed {
+			t.Error("admitted before the reported ResetTime")
+		}
+		h.clk.Set(res.ResetTime)
+		if !h.allow("k", 1).Allowed {
+			t.Error("denied at the reported ResetTime")
+		}
+	})
+
+	t.Run("allowed reset time is full capacity", func(t *testing.T) {
+		h := newHarness(t, factory)
+		res := h.allow("k", 4)
+		h.clk.Set(res.ResetTime.Add(-time.Millisecond))
+		if got := h.quota("k").Remaining; got == capacity {
+			t.Error("full capacity before the reported ResetTime")
+		}
+		h.clk.Set(res.ResetTime)
+		expectRemaining(t, h.quota("k"), capacity)
+	})
+
+	t.Run("full recovery after one window", func(t *testing.T) {
+		h := newHarness(t, factory)
+		h.exhaust("k")
+		h.clk.Advance(window)
+		expectRemaining(t, h.quota("k"), capacity)
+		if !h.allow("k", capacity).Allowed {
+			t.Error("full cost denied after a window")
+		}
+	})
+
+	t.Run("cost above capacity is denied", func(t *testing.T) {
+		h := newHarness(t, factory)
+		res := h.allow("k", capacity+1)
+		if res.Allowed {
+			t.Fatal("cost above capacity was admitted")
+		}
+		expectRemaining(t, res, capacity)
+		expectRemaining(t, h.quota("k"), capacity)
+	})
+
+	t.Run("zero cost is allowed", func(t *testing.T) {
+		h := newHarness(t, factory)
+		h.exhaust("k")
+		res := h.allow("k", 0)
+		if !res.Allowed {
+			t.Error("zero cost was denied")
+		}
+		expectRemaining(t, res, 0)
+	})
+
+	t.Run("keys are independent", func(t *testing.T) {
+		h := newHarness(t, factory)
+		h.exhaust("a")
+		for _, key := range []string{"b", "", "default"} {
+			res := h.allow(key, 1)
+			if !res.Allowed {
+				t.Errorf("key %q denied after another key was exhausted", key)
+			}
+			expectRemaining(t, res, capacity-1)
+		}
+	})
+
+	t.Run("concurrent callers never overshoot", func(t *testing.T) {
+		h := newHarness(t, factory)
+		var admitted int64
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 5; i++ {
+					res, err := h.l.Allow(context.Background(), "k", 1)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if res.Allowed {
+						atomic.AddInt64(&admitted, 1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if admitted != capacity {
+			t.Errorf("admitted %d, want exactly %d", admitted, capacity)
+		}
+	})
+	t.Run("reserve is held back", func(t *testing.T) {
+		h := newHarness(t, factory)
+		r, ok := h.l.(limiter.Reserver)
+		if !ok {
+			t.Skip("limiter does not support reserves")
+		}
+		allow := func(cost int64) *limiter.Result {
+			t.Helper()
+			res, err := r.AllowReserved(context.Background(), "k", cost, 0.3)
+			if err != nil {
+				t.Fatalf("AllowReserved(%d): %v", cost, err)
+			}
+			h.checkCommon(res)
+			return res
+		}
+		res := allow(7)
+		if !res.Allowed {
+			t.Fatal("denied down to the reserve")
+		}
+		expectRemaining(t, res, 0)
+		res = allow(1)
+		if res.Allowed {
+			t.Fatal("admitted into the reserve")
+		}
+		expectRemaining(t, res, 0)
+		expectRemaining(t, h.quota("k"), capacity-7)
+
+		h.clk.Set(res.ResetTime.Add(-time.Millisecond))
+		if allow(1).Allowed {
+			t.Error("admitted before the reported ResetTime")
+		}
+		h.clk.Set(res.ResetTime)
+		if !allow(1).Allowed {
+			t.Error("denied at the reported ResetTime")
+		}
+		if !h.allow("k", 3).Allowed {
+			t.Error("reserve not available without one")
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package limiter
+
+import (
+	"container/list"
+	"time"
+)
+
+// KeyStats describes the per-key state an in-memory limiter holds.
+type KeyStats struct {
+	Keys              int    `json:"keys"`
+	IdleEvictions     uint64 `json:"idle_evictions"`
+	CapacityEvictions uint64 `json:"capacity_evictions"`
+}
+
+// KeyTracker is implemented by limiters that keep per-key state in memory.
+type KeyTracker interface {
+	KeyStats() KeyStats
+}
+
+// keyLRU holds per-key limiter state in least-recently-used order. Entries
+// beyond max are evicted oldest first, and sweep drops entries whose state
+// carries no information any more (a full bucket, an empty window). It is
+// not safe for concurrent use; shardedKeys guards each one with a lock.
+type keyLRU[V any] struct {
+	max       int
+	interval  time.Duration
+	lastSweep time.Time
+	items     map[string]*list.Element
+	order     *list.List // front is most recently used
+	stats     KeyStats
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newKeyLRU[V any](maxKeys int, sweepInterval time.Duration) *keyLRU[V] {
+	if sweepInterval <= 0 {
+		sweepInterval = time.Minute
+	}
+	return &keyLRU[V]{
+		max:      maxKeys,
+		interval: sweepInterval,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (l *keyLRU[V]) get(key string) (V, bool) {
+	if el, ok := l.items[key]; ok {
+		l.order.MoveToFront(el)
+		return el.Value.(*lruEntry[V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+func (l *keyLRU[V]) put(key string, value V) {
+	if el, ok := l.items[key]; ok {
+		el.Value.(*lruEntry[V]).value = value
+		l.order.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.order.PushFront(&lruEntry[V]{key: key, value: value})
+
+	for l.max > 0 && len(l.items) > l.max {
+		oldest := l.order.Back()
+		l.remove(oldest)
+		l.stats.CapacityEvictions++
+	}
+}
+
+// maybeSweep removes idle entries at most once per sweep interval.
+func (l *keyLRU[V]) maybeSweep(now time.Time, idle func(V) bool) {
+	if now.Sub(l.lastSweep) < l.interval {
+		return
+	}
+	l.lastSweep = now
+
+	for el := l.order.Back(); el != nil; {
+		prev := el.Prev()
+		if idle(el.Value.(*lruEntry[V]).value) {
+			l.remove(el)
+			l.stats.IdleEvictions++
+		}
+		el = prev
+	}
+}
+
+func (l *keyLRU[V]) remove(el *list.Element) {
+	l.order.Remove(el)
+	delete(l.items, el.Value.(*lruEntry[V]).key)
+}
+
+func (l *keyLRU[V]) keyStats() KeyStats {
+	stats := l.stats
+	stats.Keys = len(l.items)
+	return stats
+}
@@ -2,6 +2,11 @@ package limiter
 
 import "sync"
 
+// Manager resolves the limiter that applies to a tenant.
+type Manager interface {
+	ForTenant(tenant string) Limiter
+}
+
 // LocalManager hands out one limiter config for now.
 type LocalManager struct {
 	mu      sync.RWMutex
@@ -14,6 +19,8 @@ func NewLocalManager(defaultCfg Config) *LocalManager {
 	switch defaultCfg.Algorithm {
 	case AlgoSlidingWindow:
 		limiter = NewSlidingWindowLimiter(defaultCfg)
+	case AlgoAdaptive:
+		limiter = NewAdaptiveLimiter(defaultCfg)
 	default:
 		limiter = NewTokenBucketLimiter(defaultCfg)
 	}
@@ -24,6 +31,14 @@ func NewLocalManager(defaultCfg Config) *LocalManager {
 	}
 }
 
+// NewSingleManager hands every tenant the given limiter.
+func NewSingleManager(cfg Config, limiter Limiter) *LocalManager {
+	return &LocalManager{
+		cfg:     cfg,
+		limiter: limiter,
+	}
+}
+
 func (m *LocalManager) ForTenant(tenant string) Limiter {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -37,5 +52,13 @@ func (m *LocalManager) GetLimiter(tenant, resource string) (Limiter, error) {
 	return m.limiter, nil
 }
 
-
-
+// KeyStats reports the per-key state held by the managed limiter, or zero
+// stats when it keeps none in memory.
+func (m *LocalManager) KeyStats() KeyStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if t, ok := m.limiter.(KeyTracker); ok {
+		return t.KeyStats()
+	}
+	return KeyStats{}
+}
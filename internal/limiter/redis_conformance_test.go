@@ -0,0 +1,122 @@
+//go:build full
+// +build full
+
+package limiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/xizzxy/helios/internal/clock"
+	"github.com/xizzxy/helios/internal/config"
+	"github.com/xizzxy/helios/internal/limiter"
+	"github.com/xizzxy/helios/internal/limiter/limitertest"
+	"github.com/xizzxy/helios/internal/store"
+)
+
+// newTestStore connects to an in-process Redis that runs the real Lua
+// scripts, with the store reading time from cfg.Clock.
+func newTestStore(t *testing.T, cfg limiter.Config) *store.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client, err := store.NewClient(config.RedisConfig{Address: mr.Addr(), PoolSize: 16})
+	if err != nil {
+		t.Fatalf("connect to miniredis: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	client.SetClock(cfg.Clock)
+	return client
+}
+
+func TestConformanceRedisTokenBucket(t *testing.T) {
+	limitertest.Run(t, func(t *testing.T, cfg limiter.Config) limiter.Limiter {
+		return limiter.NewRedisTokenBucket(cfg, newTestStore(t, cfg))
+	})
+}
+
+func TestConformanceRedisSlidingWindow(t *testing.T) {
+	limitertest.Run(t, func(t *testing.T, cfg limiter.Config) limiter.Limiter {
+		return limiter.NewRedisSlidingWindow(cfg, newTestStore(t, cfg))
+	})
+}
+
+func TestConformanceLease(t *testing.T) {
+	limitertest.Run(t, func(t *testing.T, cfg limiter.Config) limiter.Limiter {
+		l := limiter.NewLeaseLimiter(cfg, newTestStore(t, cfg), limiter.LeaseOptions{TTL: time.Hour, MaxFraction: 1})
+		t.Cleanup(func() { l.Close() })
+		return l
+	})
+}
+
+// A zero-cost call reads the lease; even once it has expired it must not
+// borrow from Redis, which would take quota from the other gateways.
+func TestLeaseZeroCostDoesNotBorrow(t *testing.T) {
+	clk := clock.NewManual(time.Unix(1700000000, 0))
+	cfg := limiter.Config{Limit: 100, Burst: 100, Window: time.Hour, Clock: clk}
+	st := newTestStore(t, cfg)
+	l := limiter.NewLeaseLimiter(cfg, st, limiter.LeaseOptions{TTL: time.Second, MaxFraction: 1})
+	t.Cleanup(func() { l.Close() })
+	other := limiter.NewLeaseLimiter(cfg, st, limiter.LeaseOptions{TTL: time.Second, MaxFraction: 1})
+	t.Cleanup(func() { other.Close() })
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if _, err := l.Allow(ctx, "k", 1); err != nil {
+			t.Fatalf("allow: %v", err)
+		}
+	}
+	clk.Advance(2 * time.Second)
+
+	before, err := other.GetQuota(ctx, "k")
+	if err != nil {
+		t.Fatalf("quota: %v", err)
+	}
+	if _, err := l.Allow(ctx, "k", 0); err != nil {
+		t.Fatalf("zero-cost allow: %v", err)
+	}
+	after, err := other.GetQuota(ctx, "k")
+	if err != nil {
+		t.Fatalf("quota: %v", err)
+	}
+	if after.Remaining != before.Remaining {
+		t.Errorf("Redis has %d tokens left after a zero-cost call, want %d", after.Remaining, before.Remaining)
+	}
+}
+
+// With a single instance and the whole limit as error budget the hybrid
+// limiter never has to deny while waiting for a sync, so it must be exact.
+func TestConformanceHybrid(t *testing.T) {
+	limitertest.Run(t, func(t *testing.T, cfg limiter.Config) limiter.Limiter {
+		l := limiter.NewHybridLimiter(cfg, newTestStore(t, cfg), limiter.HybridOptions{ErrorBudget: 1, InstanceID: "conformance"})
+		t.Cleanup(func() { l.Close() })
+		return l
+	})
+}
+
+func TestRedisRefund(t *testing.T) {
+	cfg := limiter.Config{Limit: 5, Burst: 5, Window: time.Minute}
+	for name, l := range map[string]limiter.Limiter{
+		"token bucket":   limiter.NewRedisTokenBucket(cfg, newTestStore(t, cfg)),
+		"sliding window": limiter.NewRedisSlidingWindow(cfg, newTestStore(t, cfg)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := l.Allow(ctx, "k", 3); err != nil {
+				t.Fatal(err)
+			}
+			if err := limiter.Refund(ctx, l, "k", 2); err != nil {
+				t.Fatalf("refund: %v", err)
+			}
+			res, err := l.GetQuota(ctx, "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Remaining != 4 {
+				t.Errorf("remaining = %d after refunding 2 of 3, want 4", res.Remaining)
+			}
+		})
+	}
+}
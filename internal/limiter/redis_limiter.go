@@ -1,36 +1,47 @@
-//go:build full
-// +build full
-
 package limiter
 
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/xizzxy/helios/internal/store"
 )
 
 type RedisTokenBucket struct {
-	config *Config
-	store  *store.RedisStore
+	config Config
+	store  *store.Client
 }
 
-func NewRedisTokenBucket(config *Config, store *store.RedisStore) *RedisTokenBucket {
+func NewRedisTokenBucket(config Config, store *store.Client) *RedisTokenBucket {
 	return &RedisTokenBucket{
-		config: config,
+		config: withDefaults(config),
 		store:  store,
 	}
 }
 
+// WithConfig needs no state of its own: buckets live in Redis under the
+// same keys.
+func (rtb *RedisTokenBucket) WithConfig(cfg Config) Limiter {
+	return NewRedisTokenBucket(cfg, rtb.store)
+}
+
 func (rtb *RedisTokenBucket) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
+	return rtb.AllowReserved(ctx, key, cost, 0)
+}
+
+// AllowReserved admits the call only if reserve of the burst is left in
+// the bucket after it.
+func (rtb *RedisTokenBucket) AllowReserved(ctx context.Context, key string, cost int64, reserve float64) (*Result, error) {
 	allowed, remaining, resetTime, err := rtb.store.TokenBucketAllow(
 		ctx,
 		key,
 		rtb.config.Limit,
-		rtb.config.WindowSeconds,
-		cost,
-		rtb.config.BurstLimit,
+		windowSeconds(rtb.config.Window),
+		int(cost),
+		rtb.config.Burst,
+		reserveUnits(rtb.config.Burst, reserve),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("redis token bucket allow: %w", err)
@@ -45,54 +56,62 @@ func (rtb *RedisTokenBucket) Allow(ctx context.Context, key string, cost int64)
 
 	if !allowed {
 		// Calculate retry after from reset time
-		now := time.Now()
-		if resetTime.After(now) {
-			result.RetryAfterSeconds = int64(resetTime.Sub(now).Seconds())
-		}
+		result.RetryAfterSeconds = retryAfterSeconds(rtb.config.now(), resetTime)
 	}
 
 	return result, nil
 }
 
+// Refund puts cost tokens back in the bucket, up to its burst.
+func (rtb *RedisTokenBucket) Refund(ctx context.Context, key string, cost int64) error {
+	if err := rtb.store.ReturnTokens(ctx, key, cost, rtb.config.Burst); err != nil {
+		return fmt.Errorf("redis token bucket refund: %w", err)
+	}
+	return nil
+}
+
+// GetQuota runs the script with zero cost, which refills without consuming.
 func (rtb *RedisTokenBucket) GetQuota(ctx context.Context, key string) (*Result, error) {
-	remaining, resetTime, err := rtb.store.GetTokenBucketQuota(
-		ctx,
-		key,
-		rtb.config.Limit,
-		rtb.config.WindowSeconds,
-		rtb.config.BurstLimit,
-	)
+	res, err := rtb.Allow(ctx, key, 0)
 	if err != nil {
-		return nil, fmt.Errorf("redis token bucket quota: %w", err)
+		return nil, err
 	}
-
-	return &Result{
-		Allowed:   true,
-		Remaining: remaining,
-		Limit:     rtb.config.Limit,
-		ResetTime: resetTime,
-	}, nil
+	res.Allowed = true
+	return res, nil
 }
 
 type RedisSlidingWindow struct {
-	config *Config
-	store  *store.RedisStore
+	config Config
+	store  *store.Client
 }
 
-func NewRedisSlidingWindow(config *Config, store *store.RedisStore) *RedisSlidingWindow {
+func NewRedisSlidingWindow(config Config, store *store.Client) *RedisSlidingWindow {
 	return &RedisSlidingWindow{
-		config: config,
+		config: withDefaults(config),
 		store:  store,
 	}
 }
 
+// WithConfig needs no state of its own: windows live in Redis under the
+// same keys.
+func (rsw *RedisSlidingWindow) WithConfig(cfg Config) Limiter {
+	return NewRedisSlidingWindow(cfg, rsw.store)
+}
+
 func (rsw *RedisSlidingWindow) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
+	return rsw.AllowReserved(ctx, key, cost, 0)
+}
+
+// AllowReserved admits the call only if reserve of the limit is left in
+// the window after it.
+func (rsw *RedisSlidingWindow) AllowReserved(ctx context.Context, key string, cost int64, reserve float64) (*Result, error) {
 	allowed, remaining, resetTime, err := rsw.store.SlidingWindowAllow(
 		ctx,
 		key,
 		rsw.config.Limit,
-		rsw.config.WindowSeconds,
-		cost,
+		windowSeconds(rsw.config.Window),
+		int(cost),
+		reserveUnits(rsw.config.Limit, reserve),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("redis sliding window allow: %w", err)
@@ -107,75 +126,84 @@ func (rsw *RedisSlidingWindow) Allow(ctx context.Context, key string, cost int64
 
 	if !allowed {
 		// Calculate retry after from reset time
-		now := time.Now()
-		if resetTime.After(now) {
-			result.RetryAfterSeconds = int64(resetTime.Sub(now).Seconds())
-		}
+		result.RetryAfterSeconds = retryAfterSeconds(rsw.config.now(), resetTime)
 	}
 
 	return result, nil
 }
 
+// Refund drops the newest cost requests from the window.
+func (rsw *RedisSlidingWindow) Refund(ctx context.Context, key string, cost int64) error {
+	if err := rsw.store.SlidingWindowReturn(ctx, key, cost); err != nil {
+		return fmt.Errorf("redis sliding window refund: %w", err)
+	}
+	return nil
+}
+
+// GetQuota runs the script with zero cost, which trims without recording.
 func (rsw *RedisSlidingWindow) GetQuota(ctx context.Context, key string) (*Result, error) {
-	remaining, resetTime, err := rsw.store.GetSlidingWindowQuota(
-		ctx,
-		key,
-		rsw.config.Limit,
-		rsw.config.WindowSeconds,
-	)
+	res, err := rsw.Allow(ctx, key, 0)
 	if err != nil {
-		return nil, fmt.Errorf("redis sliding window quota: %w", err)
+		return nil, err
 	}
-
-	return &Result{
-		Allowed:   true,
-		Remaining: remaining,
-		Limit:     rsw.config.Limit,
-		ResetTime: resetTime,
-	}, nil
+	res.Allowed = true
+	return res, nil
 }
 
 // RedisManager manages Redis-backed rate limiters
 type RedisManager struct {
-	store    *store.RedisStore
-	limiters map[string]Limiter
-	configs  map[string]*Config
+	store      *store.Client
+	defaultCfg Config
+	mu         sync.RWMutex
+	limiters   map[string]Limiter
+	configs    map[string]Config
 }
 
-func NewRedisManager(store *store.RedisStore) *RedisManager {
+func NewRedisManager(store *store.Client, defaultCfg Config) *RedisManager {
 	return &RedisManager{
-		store:    store,
-		limiters: make(map[string]Limiter),
-		configs:  make(map[string]*Config),
+		store:      store,
+		defaultCfg: defaultCfg,
+		limiters:   make(map[string]Limiter),
+		configs:    make(map[string]Config),
+	}
+}
+
+func (rm *RedisManager) ForTenant(tenant string) Limiter {
+	limiter, err := rm.GetLimiter(tenant, "default")
+	if err != nil {
+		return NewRedisTokenBucket(rm.defaultCfg, rm.store)
 	}
+	return limiter
 }
 
 func (rm *RedisManager) GetLimiter(tenantID, resource string) (Limiter, error) {
 	key := fmt.Sprintf("%s:%s", tenantID, resource)
 
+	rm.mu.RLock()
 	limiter, exists := rm.limiters[key]
+	rm.mu.RUnlock()
 	if exists {
 		return limiter, nil
 	}
 
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if limiter, exists := rm.limiters[key]; exists {
+		return limiter, nil
+	}
+
 	// Get config for this tenant/resource
 	config, exists := rm.configs[key]
 	if !exists {
-		// Default config
-		config = &Config{
-			Algorithm:     TokenBucket,
-			Limit:         100,
-			WindowSeconds: 60,
-			BurstLimit:    120,
-		}
-		rm.configs[key] = config
+		config = rm.defaultCfg
 	}
 
 	// Create Redis-backed limiter
 	switch config.Algorithm {
-	case TokenBucket:
+	case AlgoTokenBucket, "":
 		limiter = NewRedisTokenBucket(config, rm.store)
-	case SlidingWindow:
+	case AlgoSlidingWindow:
 		limiter = NewRedisSlidingWindow(config, rm.store)
 	default:
 		return nil, fmt.Errorf("unsupported algorithm: %s", config.Algorithm)
@@ -185,8 +213,11 @@ func (rm *RedisManager) GetLimiter(tenantID, resource string) (Limiter, error) {
 	return limiter, nil
 }
 
-func (rm *RedisManager) UpdateConfig(tenantID, resource string, config *Config) error {
+func (rm *RedisManager) UpdateConfig(tenantID, resource string, config Config) error {
 	key := fmt.Sprintf("%s:%s", tenantID, resource)
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
 	rm.configs[key] = config
 
 	// Remove existing limiter to force recreation with new config
@@ -198,3 +229,25 @@ func (rm *RedisManager) UpdateConfig(tenantID, resource string, config *Config)
 func (rm *RedisManager) Close() error {
 	return rm.store.Close()
 }
+
+// withDefaults fills the same defaults the in-memory limiters apply.
+func withDefaults(cfg Config) Config {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.Limit <= 0 {
+		cfg.Limit = 100
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = cfg.Limit
+	}
+	return cfg
+}
+
+func windowSeconds(window time.Duration) int64 {
+	secs := int64(window / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
@@ -0,0 +1,68 @@
+package limiter
+
+import (
+	"runtime"
+	"sync"
+)
+
+// shardedKeys spreads per-key state over independently locked shards so
+// that tenants hashing to different shards never contend.
+type shardedKeys[V any] struct {
+	shards []keyShard[V]
+	mask   uint32
+}
+
+type keyShard[V any] struct {
+	mu   sync.Mutex
+	keys *keyLRU[V]
+	_    [40]byte // keep neighbouring shard locks off the same cache line
+}
+
+func newShardedKeys[V any](cfg Config) *shardedKeys[V] {
+	n := cfg.Shards
+	if n <= 0 {
+		n = 4 * runtime.GOMAXPROCS(0)
+	}
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+
+	maxKeys := cfg.MaxKeys
+	if maxKeys > 0 {
+		maxKeys = (maxKeys + size - 1) / size
+	}
+
+	s := &shardedKeys[V]{
+		shards: make([]keyShard[V], size),
+		mask:   uint32(size - 1),
+	}
+	for i := range s.shards {
+		s.shards[i].keys = newKeyLRU[V](maxKeys, cfg.SweepInterval)
+	}
+	return s
+}
+
+// shard returns the shard owning key (FNV-1a, inlined to avoid allocating).
+func (s *shardedKeys[V]) shard(key string) *keyShard[V] {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &s.shards[h&s.mask]
+}
+
+func (s *shardedKeys[V]) keyStats() KeyStats {
+	var total KeyStats
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		stats := sh.keys.keyStats()
+		sh.mu.Unlock()
+		total.Keys += stats.Keys
+		total.IdleEvictions += stats.IdleEvictions
+		total.CapacityEvictions += stats.CapacityEvictions
+	}
+	return total
+}
@@ -0,0 +1,137 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var inMemoryLimiters = []struct {
+	name string
+	new  func(Config) Limiter
+}{
+	{"token_bucket", NewTokenBucketLimiter},
+	{"sliding_window", NewSlidingWindowLimiter},
+	{"basic", NewBasicLimiter},
+}
+
+// Concurrent callers on one key must never admit more than the burst,
+// whichever shard or CAS retry path they take.
+func TestConcurrentAllowSameKey(t *testing.T) {
+	for _, tc := range inMemoryLimiters {
+		t.Run(tc.name, func(t *testing.T) {
+			const limit = 500
+			l := tc.new(Config{Limit: limit, Burst: limit, Window: time.Hour})
+
+			var admitted int64
+			var wg sync.WaitGroup
+			for g := 0; g < 16; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 100; i++ {
+						res, err := l.Allow(context.Background(), "hot", 1)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						if res.Allowed {
+							atomic.AddInt64(&admitted, 1)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			if admitted != limit {
+				t.Fatalf("admitted %d requests, want exactly %d", admitted, limit)
+			}
+		})
+	}
+}
+
+// Keys spread across shards keep independent budgets while being used,
+// evicted and recreated concurrently.
+func TestConcurrentAllowManyKeys(t *testing.T) {
+	for _, tc := range inMemoryLimiters {
+		t.Run(tc.name, func(t *testing.T) {
+			l := tc.new(Config{
+				Limit:         10,
+				Window:        time.Hour,
+				Shards:        8,
+				MaxKeys:       64,
+				SweepInterval: time.Millisecond,
+			})
+
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 500; i++ {
+						key := fmt.Sprintf("tenant-%d-%d", g, i%100)
+						if _, err := l.Allow(context.Background(), key, 1); err != nil {
+							t.Error(err)
+							return
+						}
+						if _, err := l.GetQuota(context.Background(), key); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			stats := l.(KeyTracker).KeyStats()
+			if stats.Keys > 64 {
+				t.Fatalf("tracking %d keys, cap is 64", stats.Keys)
+			}
+			if stats.CapacityEvictions == 0 {
+				t.Fatal("expected capacity evictions")
+			}
+		})
+	}
+}
+
+func BenchmarkAllowParallel(b *testing.B) {
+	procs := []int{1, 2, 4, 8, 16}
+	for _, tc := range inMemoryLimiters {
+		for _, shards := range []int{1, 0} {
+			for _, p := range procs {
+				name := fmt.Sprintf("%s/shards=%s/procs=%d", tc.name, shardsName(shards), p)
+				b.Run(name, func(b *testing.B) {
+					defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(p))
+					// A short window keeps sliding-window request logs small.
+					l := tc.new(Config{Limit: 1 << 30, Window: 10 * time.Millisecond, Shards: shards})
+
+					keys := make([]string, 1024)
+					for i := range keys {
+						keys[i] = fmt.Sprintf("tenant-%d", i)
+					}
+					var next uint32
+					b.ReportAllocs()
+					b.ResetTimer()
+					b.RunParallel(func(pb *testing.PB) {
+						i := atomic.AddUint32(&next, 7919)
+						for pb.Next() {
+							i++
+							l.Allow(context.Background(), keys[i%uint32(len(keys))], 1)
+						}
+					})
+				})
+			}
+		}
+	}
+}
+
+func shardsName(n int) string {
+	if n == 0 {
+		return "default"
+	}
+	return fmt.Sprint(n)
+}
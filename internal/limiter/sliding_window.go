@@ -2,33 +2,46 @@ package limiter
 
 import (
 	"context"
-	"sync"
 	"time"
 )
 
-// SlidingWindowLimiter implements sliding window algorithm in memory
+// SlidingWindowLimiter implements sliding window algorithm in memory. Keys
+// are hashed across shards, each guarded by its own lock.
 type SlidingWindowLimiter struct {
 	cfg     Config
-	mu      sync.Mutex
-	windows map[string]*slidingWindow
+	windows *shardedKeys[*slidingWindow]
 }
 
 type slidingWindow struct {
-	requests []time.Time
+	requests   []time.Time
+	remoteSeen int64 // Config.Cluster total already added to requests
 }
 
 func NewSlidingWindowLimiter(cfg Config) Limiter {
 	return &SlidingWindowLimiter{
 		cfg:     cfg,
-		windows: make(map[string]*slidingWindow),
+		windows: newShardedKeys[*slidingWindow](cfg),
 	}
 }
 
+// WithConfig keeps every window's requests, which count against the new
+// limit.
+func (s *SlidingWindowLimiter) WithConfig(cfg Config) Limiter {
+	return &SlidingWindowLimiter{cfg: cfg, windows: s.windows}
+}
+
 func (s *SlidingWindowLimiter) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.AllowReserved(ctx, key, cost, 0)
+}
+
+// AllowReserved admits the call only if reserve of the limit is left in
+// the window after it.
+func (s *SlidingWindowLimiter) AllowReserved(ctx context.Context, key string, cost int64, reserve float64) (*Result, error) {
+	sh := s.windows.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	now := time.Now()
+	now := s.cfg.now()
 	window := s.cfg.Window
 	if window <= 0 {
 		window = time.Minute
@@ -39,14 +52,14 @@ func (s *SlidingWindowLimiter) Allow(ctx context.Context, key string, cost int64
 	}
 
 	windowStart := now.Add(-window)
+	held := reserveUnits(limit, reserve)
+
+	sweepWindows(sh.keys, now, windowStart)
 
 	// Get or create window for key
-	w, exists := s.windows[key]
+	w, exists := sh.keys.get(key)
 	if !exists {
-		w = &slidingWindow{
-			requests: make([]time.Time, 0),
-		}
-		s.windows[key] = w
+		w = s.newWindow(sh.keys, key)
 	}
 
 	// Remove expired requests
@@ -57,18 +70,24 @@ func (s *SlidingWindowLimiter) Allow(ctx context.Context, key string, cost int64
 		}
 	}
 	w.requests = validRequests
+	s.addRemote(key, w, now, limit)
 
-	// Check if adding cost would exceed limit
+	// Check if adding cost would cut into the reserve or exceed limit
 	currentCount := int64(len(w.requests))
-	if currentCount+cost > limit {
-		// Calculate reset time (when oldest request expires)
-		resetTime := now.Add(window)
-		if len(w.requests) > 0 {
-			resetTime = w.requests[0].Add(window)
+	if need := cost + held; currentCount+need > limit {
+		// Calculate reset time: when enough of the oldest requests have
+		// expired to fit cost, or when the window is empty if cost can
+		// never fit.
+		resetTime := now
+		if need <= limit {
+			excess := currentCount + need - limit
+			resetTime = w.requests[excess-1].Add(window)
+		} else if currentCount > 0 {
+			resetTime = w.requests[currentCount-1].Add(window)
 		}
 
-		remaining := maxInt64(0, limit-currentCount)
-		retryAfter := int64(resetTime.Sub(now).Seconds())
+		remaining := maxInt64(0, limit-currentCount-held)
+		retryAfter := retryAfterSeconds(now, resetTime)
 
 		return &Result{
 			Allowed:           false,
@@ -83,8 +102,11 @@ func (s *SlidingWindowLimiter) Allow(ctx context.Context, key string, cost int64
 	for i := int64(0); i < cost; i++ {
 		w.requests = append(w.requests, now)
 	}
+	if s.cfg.Cluster != nil && cost > 0 {
+		s.cfg.Cluster.Add(key, cost)
+	}
 
-	remaining := limit - currentCount - cost
+	remaining := limit - currentCount - cost - held
 	resetTime := now.Add(window)
 
 	return &Result{
@@ -95,11 +117,29 @@ func (s *SlidingWindowLimiter) Allow(ctx context.Context, key string, cost int64
 	}, nil
 }
 
+// Refund drops the newest cost requests from key's window. Cost already
+// shared through Config.Cluster stays counted on other gateways.
+func (s *SlidingWindowLimiter) Refund(ctx context.Context, key string, cost int64) error {
+	sh := s.windows.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if w, ok := sh.keys.get(key); ok {
+		n := int64(len(w.requests)) - cost
+		if n < 0 {
+			n = 0
+		}
+		w.requests = w.requests[:n]
+	}
+	return nil
+}
+
 func (s *SlidingWindowLimiter) GetQuota(ctx context.Context, key string) (*Result, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.windows.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	now := time.Now()
+	now := s.cfg.now()
 	window := s.cfg.Window
 	if window <= 0 {
 		window = time.Minute
@@ -111,16 +151,21 @@ func (s *SlidingWindowLimiter) GetQuota(ctx context.Context, key string) (*Resul
 
 	windowStart := now.Add(-window)
 
+	sweepWindows(sh.keys, now, windowStart)
+
 	// Get or create window for key
-	w, exists := s.windows[key]
-	if !exists {
+	w, exists := sh.keys.get(key)
+	if !exists && s.cfg.Cluster == nil {
 		return &Result{
 			Allowed:   true,
 			Remaining: limit,
 			Limit:     limit,
-			ResetTime: now.Add(window),
+			ResetTime: now,
 		}, nil
 	}
+	if !exists {
+		w = s.newWindow(sh.keys, key)
+	}
 
 	// Remove expired requests
 	validRequests := make([]time.Time, 0)
@@ -130,10 +175,15 @@ func (s *SlidingWindowLimiter) GetQuota(ctx context.Context, key string) (*Resul
 		}
 	}
 	w.requests = validRequests
+	s.addRemote(key, w, now, limit)
 
 	currentCount := int64(len(w.requests))
-	remaining := limit - currentCount
-	resetTime := now.Add(window)
+	remaining := maxInt64(0, limit-currentCount)
+	resetTime := now
+	if currentCount > 0 {
+		// The window is empty again once the newest request expires.
+		resetTime = w.requests[currentCount-1].Add(window)
+	}
 
 	return &Result{
 		Allowed:   true,
@@ -143,6 +193,45 @@ func (s *SlidingWindowLimiter) GetQuota(ctx context.Context, key string) (*Resul
 	}, nil
 }
 
+func (s *SlidingWindowLimiter) newWindow(windows *keyLRU[*slidingWindow], key string) *slidingWindow {
+	w := &slidingWindow{
+		requests: make([]time.Time, 0),
+	}
+	if s.cfg.Cluster != nil {
+		// Only consumption from here on counts against a new window.
+		w.remoteSeen = s.cfg.Cluster.Remote(key)
+	}
+	windows.put(key, w)
+	return w
+}
+
+// sweep drops windows whose requests have all expired.
+func sweepWindows(windows *keyLRU[*slidingWindow], now, windowStart time.Time) {
+	windows.maybeSweep(now, func(w *slidingWindow) bool {
+		return len(w.requests) == 0 || !w.requests[len(w.requests)-1].After(windowStart)
+	})
+}
+
+// KeyStats reports how many keys the limiter tracks and how many it evicted.
+func (s *SlidingWindowLimiter) KeyStats() KeyStats {
+	return s.windows.keyStats()
+}
+
+// addRemote records consumption seen on other gateways as requests made now,
+// so it ages out of the window like local traffic.
+func (s *SlidingWindowLimiter) addRemote(key string, w *slidingWindow, now time.Time, limit int64) {
+	if s.cfg.Cluster == nil {
+		return
+	}
+	total := s.cfg.Cluster.Remote(key)
+	delta := total - w.remoteSeen
+	w.remoteSeen = total
+	// Anything beyond the limit fills the window anyway.
+	for i := int64(0); i < delta && i < limit; i++ {
+		w.requests = append(w.requests, now)
+	}
+}
+
 func maxInt64(a, b int64) int64 {
 	if a > b {
 		return a
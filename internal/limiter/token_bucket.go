@@ -2,73 +2,64 @@ package limiter
 
 import (
 	"context"
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// TokenBucketLimiter implements token bucket algorithm in memory
+// TokenBucketLimiter implements token bucket algorithm in memory. Keys are
+// hashed across shards, and each bucket is updated lock-free with CAS, so
+// the shard lock is only held to find the bucket.
 type TokenBucketLimiter struct {
 	cfg   Config
-	mu    sync.Mutex
-	state map[string]*tokenBucket
+	state *shardedKeys[*tokenBucket]
 }
 
 type tokenBucket struct {
+	state atomic.Pointer[bucketState]
+}
+
+// bucketState is immutable once published; updates swap in a new copy.
+type bucketState struct {
 	tokens     float64
 	lastRefill time.Time
+	remoteSeen int64 // Config.Cluster total already charged to this bucket
 }
 
 func NewTokenBucketLimiter(cfg Config) Limiter {
 	return &TokenBucketLimiter{
 		cfg:   cfg,
-		state: make(map[string]*tokenBucket),
+		state: newShardedKeys[*tokenBucket](cfg),
 	}
 }
 
-func (t *TokenBucketLimiter) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	now := time.Now()
-	window := t.cfg.Window
-	if window <= 0 {
-		window = time.Minute
-	}
-	limit := t.cfg.Limit
-	if limit <= 0 {
-		limit = 100
-	}
-	burst := t.cfg.Burst
-	if burst <= 0 {
-		burst = limit
-	}
+// WithConfig keeps every bucket. A bucket above a lowered burst is cut
+// down to it on its next use.
+func (t *TokenBucketLimiter) WithConfig(cfg Config) Limiter {
+	return &TokenBucketLimiter{cfg: cfg, state: t.state}
+}
 
-	// Refill rate: limit per window
-	refillPerSec := float64(limit) / window.Seconds()
+func (t *TokenBucketLimiter) Allow(ctx context.Context, key string, cost int64) (*Result, error) {
+	return t.AllowReserved(ctx, key, cost, 0)
+}
 
-	bucket, exists := t.state[key]
-	if !exists {
-		bucket = &tokenBucket{
-			tokens:     float64(burst),
-			lastRefill: now,
-		}
-		t.state[key] = bucket
+// AllowReserved admits the call only if reserve of the burst is left in
+// the bucket after it.
+func (t *TokenBucketLimiter) AllowReserved(ctx context.Context, key string, cost int64, reserve float64) (*Result, error) {
+	now := t.cfg.now()
+	limit, burst, refillPerSec := t.params()
+	held := reserveUnits(burst, reserve)
+
+	bucket := t.bucket(key, now, burst, refillPerSec)
+	st, allowed := t.update(bucket, key, now, burst, refillPerSec, cost, held, true)
+	if allowed && t.cfg.Cluster != nil && cost > 0 {
+		t.cfg.Cluster.Add(key, cost)
 	}
 
-	// Refill tokens based on elapsed time
-	elapsed := now.Sub(bucket.lastRefill).Seconds()
-	bucket.tokens = min(float64(burst), bucket.tokens+elapsed*refillPerSec)
-	bucket.lastRefill = now
-
-	// Check if we can consume the requested tokens
-	costFloat := float64(cost)
-	allowed := bucket.tokens >= costFloat
-	if allowed {
-		bucket.tokens -= costFloat
+	remaining := int64(st.tokens)
+	if held > 0 {
+		remaining = max(remaining-held, 0)
 	}
-
-	remaining := int64(bucket.tokens)
-	resetTime := now.Add(time.Duration((costFloat-bucket.tokens)/refillPerSec) * time.Second)
+	resetTime := bucketReset(now, st.tokens, cost+held, burst, allowed, refillPerSec)
 
 	result := &Result{
 		Allowed:   allowed,
@@ -78,56 +69,153 @@ func (t *TokenBucketLimiter) Allow(ctx context.Context, key string, cost int64)
 	}
 
 	if !allowed {
-		result.RetryAfterSeconds = int64(resetTime.Sub(now).Seconds())
+		result.RetryAfterSeconds = retryAfterSeconds(now, resetTime)
 	}
 
 	return result, nil
 }
 
+// Refund puts cost tokens back in key's bucket, up to its burst. Cost
+// already shared through Config.Cluster stays counted on other gateways.
+func (t *TokenBucketLimiter) Refund(ctx context.Context, key string, cost int64) error {
+	_, burst, refillPerSec := t.params()
+	bucket := t.bucket(key, t.cfg.now(), burst, refillPerSec)
+	for {
+		old := bucket.state.Load()
+		next := *old
+		next.tokens = min(old.tokens+float64(cost), float64(burst))
+		if bucket.state.CompareAndSwap(old, &next) {
+			return nil
+		}
+	}
+}
+
 func (t *TokenBucketLimiter) GetQuota(ctx context.Context, key string) (*Result, error) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
+	now := t.cfg.now()
+	limit, burst, refillPerSec := t.params()
+
+	bucket := t.bucket(key, now, burst, refillPerSec)
+	st, _ := t.update(bucket, key, now, burst, refillPerSec, 0, 0, false)
+
+	remaining := int64(st.tokens)
+	resetTime := bucketReset(now, st.tokens, 0, burst, true, refillPerSec)
+
+	return &Result{
+		Allowed:   true,
+		Remaining: remaining,
+		Limit:     limit,
+		ResetTime: resetTime,
+	}, nil
+}
 
-	now := time.Now()
+// params applies defaults: limit per window, refilled continuously.
+func (t *TokenBucketLimiter) params() (limit, burst int64, refillPerSec float64) {
 	window := t.cfg.Window
 	if window <= 0 {
 		window = time.Minute
 	}
-	limit := t.cfg.Limit
+	limit = t.cfg.Limit
 	if limit <= 0 {
 		limit = 100
 	}
-	burst := t.cfg.Burst
+	burst = t.cfg.Burst
 	if burst <= 0 {
 		burst = limit
 	}
+	return limit, burst, float64(limit) / window.Seconds()
+}
+
+// bucket returns the state for key, creating a full bucket if needed, and
+// drops buckets in the same shard that have refilled completely since they
+// were last used.
+func (t *TokenBucketLimiter) bucket(key string, now time.Time, burst int64, refillPerSec float64) *tokenBucket {
+	sh := t.state.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	// Refill rate: limit per window
-	refillPerSec := float64(limit) / window.Seconds()
+	sh.keys.maybeSweep(now, func(b *tokenBucket) bool {
+		st := b.state.Load()
+		return st.tokens+now.Sub(st.lastRefill).Seconds()*refillPerSec >= float64(burst)
+	})
 
-	bucket, exists := t.state[key]
+	bucket, exists := sh.keys.get(key)
 	if !exists {
-		bucket = &tokenBucket{
+		st := &bucketState{
 			tokens:     float64(burst),
 			lastRefill: now,
 		}
-		t.state[key] = bucket
+		if t.cfg.Cluster != nil {
+			// Only consumption from here on counts against a new bucket.
+			st.remoteSeen = t.cfg.Cluster.Remote(key)
+		}
+		bucket = &tokenBucket{}
+		bucket.state.Store(st)
+		sh.keys.put(key, bucket)
 	}
+	return bucket
+}
 
-	// Refill tokens based on elapsed time
-	elapsed := now.Sub(bucket.lastRefill).Seconds()
-	bucket.tokens = min(float64(burst), bucket.tokens+elapsed*refillPerSec)
-	bucket.lastRefill = now
+// update refills the bucket, charges remote consumption and, when consume
+// is set, takes cost tokens if cost plus reserve are available. It retries
+// until its view of the bucket is the one it replaces.
+func (t *TokenBucketLimiter) update(bucket *tokenBucket, key string, now time.Time, burst int64, refillPerSec float64, cost, reserve int64, consume bool) (bucketState, bool) {
+	var remote int64
+	if t.cfg.Cluster != nil {
+		remote = t.cfg.Cluster.Remote(key)
+	}
 
-	remaining := int64(bucket.tokens)
-	resetTime := now.Add(time.Duration((float64(limit)-bucket.tokens)/refillPerSec) * time.Second)
+	for {
+		old := bucket.state.Load()
+		next := *old
 
-	return &Result{
-		Allowed:   true,
-		Remaining: remaining,
-		Limit:     limit,
-		ResetTime: resetTime,
-	}, nil
+		// Refill tokens based on elapsed time. A concurrent caller may
+		// have stored a later timestamp than ours; never refill backwards.
+		if now.After(next.lastRefill) {
+			elapsed := now.Sub(next.lastRefill).Seconds()
+			next.tokens += elapsed * refillPerSec
+			next.lastRefill = now
+		}
+		next.tokens = min(float64(burst), next.tokens)
+		t.chargeRemote(&next, remote, burst)
+
+		// Check if we can consume the requested tokens
+		allowed := next.tokens >= float64(cost+reserve)
+		if consume && allowed {
+			next.tokens -= float64(cost)
+		}
+		if bucket.state.CompareAndSwap(old, &next) {
+			return next, allowed
+		}
+	}
+}
+
+// KeyStats reports how many keys the limiter tracks and how many it evicted.
+func (t *TokenBucketLimiter) KeyStats() KeyStats {
+	return t.state.keyStats()
+}
+
+// chargeRemote deducts tokens other gateways spent since the last call. The
+// bucket may go into debt, down to -burst, so the cluster pays it back
+// before admitting more.
+func (t *TokenBucketLimiter) chargeRemote(st *bucketState, total, burst int64) {
+	if t.cfg.Cluster == nil {
+		return
+	}
+	if delta := total - st.remoteSeen; delta > 0 {
+		st.tokens = max(-float64(burst), st.tokens-float64(delta))
+		st.remoteSeen = total
+	}
+}
+
+// bucketReset is when the bucket is full again or, for a denial, when cost
+// tokens will be available. A cost above burst can never be admitted, so
+// its denial reports when the bucket is full.
+func bucketReset(now time.Time, tokens float64, cost, burst int64, allowed bool, refillPerSec float64) time.Time {
+	want := float64(burst)
+	if !allowed && cost <= burst {
+		want = float64(cost)
+	}
+	return refillAt(now, tokens, want, refillPerSec)
 }
 
 func min(a, b float64) float64 {
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+)
+
+// OtherTenant is the label value shared by tenants without their own series.
+const OtherTenant = "other"
+
+// TenantLabels bounds the number of distinct tenant label values. Tenants
+// on the allow-list always keep their own label. Every refresh interval the
+// TopN heaviest other tenants in a space-saving sketch get one, provided
+// their guaranteed count is above total/sketchSize, so a handful of early
+// requests never earns a series. Everyone else is reported as OtherTenant,
+// so a scrape never holds more than len(allow)+TopN+1 tenant values.
+// Series of a demoted tenant are the caller's to drop; see OnDemote.
+type TenantLabels struct {
+	clock   clock.Clock
+	allow   map[string]struct{}
+	topN    int
+	size    int
+	refresh time.Duration
+	sketch  *TopK
+	total   atomic.Uint64
+
+	mu       sync.RWMutex
+	promoted map[string]struct{}
+	demoted  map[string]struct{} // lost their label at the last refresh
+	onDemote func(tenant string)
+	next     atomic.Int64 // unix nanos of the next refresh
+}
+
+// NewTenantLabels tracks sketchSize tenants and re-ranks them at most once
+// per refresh interval.
+func NewTenantLabels(allow []string, topN, sketchSize int, refresh time.Duration) *TenantLabels {
+	if refresh <= 0 {
+		refresh = 10 * time.Second
+	}
+	if sketchSize <= 0 {
+		sketchSize = 1000
+	}
+	t := &TenantLabels{
+		allow:    make(map[string]struct{}, len(allow)),
+		topN:     topN,
+		size:     sketchSize,
+		refresh:  refresh,
+		sketch:   NewTopK(sketchSize),
+		promoted: make(map[string]struct{}),
+	}
+	for _, tenant := range allow {
+		t.allow[tenant] = struct{}{}
+	}
+	return t
+}
+
+// OnDemote sets fn to be called for each tenant that loses its own label,
+// so its series can be deleted. The call comes one refresh after the
+// demotion, once requests labelled before it have been counted, and not at
+// all if the tenant is promoted again in between. OnDemote must be called
+// before the first Label.
+func (t *TenantLabels) OnDemote(fn func(tenant string)) {
+	t.onDemote = fn
+}
+
+// Label counts a request from tenant and returns the label value to use.
+func (t *TenantLabels) Label(tenant string) string {
+	if _, ok := t.allow[tenant]; ok {
+		return tenant
+	}
+	if t.topN <= 0 {
+		return OtherTenant
+	}
+	t.sketch.Add(tenant, 1)
+	t.total.Add(1)
+	if now := clock.Or(t.clock).Now().UnixNano(); now >= t.next.Load() {
+		t.rerank(now)
+	}
+	return t.Lookup(tenant)
+}
+
+// Lookup returns tenant's label value without counting it.
+func (t *TenantLabels) Lookup(tenant string) string {
+	if _, ok := t.allow[tenant]; ok {
+		return tenant
+	}
+	t.mu.RLock()
+	_, ok := t.promoted[tenant]
+	t.mu.RUnlock()
+	if ok {
+		return tenant
+	}
+	return OtherTenant
+}
+
+func (t *TenantLabels) rerank(now int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now < t.next.Load() {
+		return // another caller just ran this pass
+	}
+	t.next.Store(now + int64(t.refresh))
+
+	threshold := t.total.Load() / uint64(t.size)
+	promoted := make(map[string]struct{}, t.topN)
+	for _, c := range t.sketch.Top(t.topN) {
+		if c.Count-c.Error > threshold {
+			promoted[c.Key] = struct{}{}
+		}
+	}
+	for tenant := range t.demoted {
+		if _, ok := promoted[tenant]; !ok && t.onDemote != nil {
+			t.onDemote(tenant)
+		}
+	}
+	t.demoted = make(map[string]struct{})
+	for tenant := range t.promoted {
+		if _, ok := promoted[tenant]; !ok {
+			t.demoted[tenant] = struct{}{}
+		}
+	}
+	t.promoted = promoted
+}
+
+// Labelled returns the tenants that currently have their own label.
+func (t *TenantLabels) Labelled() []string {
+	t.mu.RLock()
+	out := make([]string, 0, len(t.allow)+len(t.promoted))
+	for tenant := range t.allow {
+		out = append(out, tenant)
+	}
+	for tenant := range t.promoted {
+		out = append(out, tenant)
+	}
+	t.mu.RUnlock()
+	sort.Strings(out)
+	return out
+}
+
+// HeavyHitters keeps two space-saving sketches per resource: consumed cost
+// by key and denials by key. Resources beyond maxResources share the
+// "other" sketches.
+type HeavyHitters struct {
+	size         int
+	maxResources int
+
+	mu        sync.RWMutex
+	resources map[string]*resourceHitters
+}
+
+type resourceHitters struct {
+	consumers *TopK
+	rejected  *TopK
+}
+
+// TopConsumers lists the heaviest keys of one resource.
+type TopConsumers struct {
+	Consumers []Count `json:"consumers"`
+	Rejected  []Count `json:"rejected"`
+}
+
+func NewHeavyHitters(sketchSize, maxResources int) *HeavyHitters {
+	if maxResources <= 0 {
+		maxResources = 100
+	}
+	return &HeavyHitters{
+		size:         sketchSize,
+		maxResources: maxResources,
+		resources:    make(map[string]*resourceHitters),
+	}
+}
+
+// Observe records one decision; allowed requests count their cost.
+func (h *HeavyHitters) Observe(resource, key string, cost int64, allowed bool) {
+	r := h.resource(resource)
+	if !allowed {
+		r.rejected.Add(key, 1)
+		return
+	}
+	if cost > 0 {
+		r.consumers.Add(key, uint64(cost))
+	}
+}
+
+func (h *HeavyHitters) resource(name string) *resourceHitters {
+	h.mu.RLock()
+	r, ok := h.resources[name]
+	h.mu.RUnlock()
+	if ok {
+		return r
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r, ok := h.resources[name]; ok {
+		return r
+	}
+	if len(h.resources) >= h.maxResources {
+		name = OtherTenant
+		if r, ok := h.resources[name]; ok {
+			return r
+		}
+	}
+	r = &resourceHitters{consumers: NewTopK(h.size), rejected: NewTopK(h.size)}
+	h.resources[name] = r
+	return r
+}
+
+// Top returns the n heaviest consumers and rejected keys of each resource.
+func (h *HeavyHitters) Top(n int) map[string]TopConsumers {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make(map[string]TopConsumers, len(h.resources))
+	for name, r := range h.resources {
+		out[name] = TopConsumers{
+			Consumers: r.consumers.Top(n),
+			Rejected:  r.rejected.Top(n),
+		}
+	}
+	return out
+}
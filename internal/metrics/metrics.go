@@ -0,0 +1,149 @@
+// Package metrics holds the Prometheus registry each binary serves on
+// ObservabilityConfig.MetricsAddress. The series match the dashboards in
+// deploy/grafana.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpDuration    *prometheus.HistogramVec
+	grpcDuration    *prometheus.HistogramVec
+	decisions       *prometheus.CounterVec
+	limiterDuration *prometheus.HistogramVec
+	redisDuration   *prometheus.HistogramVec
+	redisErrors     *prometheus.CounterVec
+	redisRetries    *prometheus.CounterVec
+
+	knownResource func(resource string) bool
+}
+
+// OtherResource is the resource label value of decisions for resources
+// that SetKnownResources does not accept.
+const OtherResource = "other"
+
+// New returns a registry with the Go runtime and process collectors and the
+// request, decision and store series. Components add their own gauges with
+// Registry.MustRegister.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "helios_http_request_duration_seconds",
+			Help:    "HTTP request latency by route and status",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16), // 100µs to ~3.3s
+		}, []string{"route", "method", "status"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "helios_grpc_request_duration_seconds",
+			Help:    "gRPC request latency by method and status code",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
+		}, []string{"method", "code"}),
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "helios_rate_limit_decisions_total",
+			Help: "Rate limit decisions by tenant, resource, algorithm and result",
+		}, []string{"tenant", "resource", "algorithm", "result"}),
+		limiterDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "helios_limiter_duration_seconds",
+			Help:    "Time taken by the limiter to reach a decision",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 2, 18), // 10µs to ~1.3s
+		}, []string{"algorithm", "operation"}),
+		redisDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "helios_redis_script_duration_seconds",
+			Help:    "Redis script round-trip latency",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 14), // 100µs to ~0.8s
+		}, []string{"script"}),
+		redisErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "helios_redis_errors_total",
+			Help: "Redis script calls that returned an error",
+		}, []string{"script"}),
+		redisRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "helios_redis_retries_total",
+			Help: "Redis script calls sent again after a transient failure",
+		}, []string{"script"}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.grpcDuration,
+		m.decisions,
+		m.limiterDuration,
+		m.redisDuration,
+		m.redisErrors,
+		m.redisRetries,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// ObserveHTTP records one HTTP request. route is the matched route pattern,
+// never the raw path, so IDs in URLs do not create new series.
+func (m *Metrics) ObserveHTTP(route, method string, status int, d time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	m.httpDuration.WithLabelValues(route, method, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+// ObserveGRPC records one unary gRPC call.
+func (m *Metrics) ObserveGRPC(method, code string, d time.Duration) {
+	m.grpcDuration.WithLabelValues(method, code).Observe(d.Seconds())
+}
+
+// SetKnownResources bounds the resource label of decision series: the
+// resource named by a request is kept only if known accepts it. It must be
+// called before the first decision; without it every resource is kept.
+func (m *Metrics) SetKnownResources(known func(resource string) bool) {
+	m.knownResource = known
+}
+
+// ObserveDecision counts one rate limit decision and how long it took.
+// resource is reported as OtherResource unless it is known.
+func (m *Metrics) ObserveDecision(tenant, resource, algorithm string, allowed bool, d time.Duration) {
+	if m.knownResource != nil && !m.knownResource(resource) {
+		resource = OtherResource
+	}
+	result := "allowed"
+	if !allowed {
+		result = "denied"
+	}
+	m.decisions.WithLabelValues(tenant, resource, algorithm, result).Inc()
+	m.limiterDuration.WithLabelValues(algorithm, "allow").Observe(d.Seconds())
+}
+
+// DeleteTenant drops every decision series labelled with tenant. It is
+// meant for TenantLabels.OnDemote, after which the tenant counts as other.
+func (m *Metrics) DeleteTenant(tenant string) {
+	m.decisions.DeletePartialMatch(prometheus.Labels{"tenant": tenant})
+}
+
+// ObserveQuota records how long a quota lookup took.
+func (m *Metrics) ObserveQuota(algorithm string, d time.Duration) {
+	m.limiterDuration.WithLabelValues(algorithm, "quota").Observe(d.Seconds())
+}
+
+// ObserveRedis has the store.Observer signature.
+func (m *Metrics) ObserveRedis(script string, d time.Duration, err error) {
+	m.redisDuration.WithLabelValues(script).Observe(d.Seconds())
+	if err != nil {
+		m.redisErrors.WithLabelValues(script).Inc()
+	}
+}
+
+// ObserveRedisRetry has the store.RetryObserver signature.
+func (m *Metrics) ObserveRedisRetry(script string) {
+	m.redisRetries.WithLabelValues(script).Inc()
+}
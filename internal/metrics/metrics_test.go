@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gather returns each series of the named family in the registry as its
+// sorted label pairs, "k=v,k=v", mapped to its value.
+func gather(t *testing.T, m *Metrics, name string) map[string]float64 {
+	t.Helper()
+	families, err := m.Registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	out := make(map[string]float64)
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			var labels []string
+			for _, l := range metric.GetLabel() {
+				labels = append(labels, l.GetName()+"="+l.GetValue())
+			}
+			sort.Strings(labels)
+			out[strings.Join(labels, ",")] = metric.GetCounter().GetValue()
+		}
+	}
+	return out
+}
+
+func TestObserveDecisionBoundsResources(t *testing.T) {
+	m := New()
+	m.SetKnownResources(func(resource string) bool { return resource == "search" })
+
+	m.ObserveDecision("acme", "search", "token_bucket", true, time.Millisecond)
+	m.ObserveDecision("acme", "search", "token_bucket", false, time.Millisecond)
+	for _, r := range []string{"x1", "x2", "x3"} {
+		m.ObserveDecision("acme", r, "token_bucket", true, time.Millisecond)
+	}
+
+	got := gather(t, m, "helios_rate_limit_decisions_total")
+	want := map[string]float64{
+		"algorithm=token_bucket,resource=search,result=allowed,tenant=acme": 1,
+		"algorithm=token_bucket,resource=search,result=denied,tenant=acme":  1,
+		"algorithm=token_bucket,resource=other,result=allowed,tenant=acme":  3,
+	}
+	if len(got) != len(want) {
+		t.Errorf("series = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestObserveDecisionKeepsResourcesWithoutFilter(t *testing.T) {
+	m := New()
+	m.ObserveDecision("acme", "anything", "sliding_window", true, time.Millisecond)
+	got := gather(t, m, "helios_rate_limit_decisions_total")
+	if got["algorithm=sliding_window,resource=anything,result=allowed,tenant=acme"] != 1 {
+		t.Errorf("series = %v, want the resource kept", got)
+	}
+}
+
+func TestDeleteTenantDropsItsSeries(t *testing.T) {
+	m := New()
+	m.ObserveDecision("acme", "search", "token_bucket", true, time.Millisecond)
+	m.ObserveDecision("acme", "upload", "token_bucket", false, time.Millisecond)
+	m.ObserveDecision("globex", "search", "token_bucket", true, time.Millisecond)
+
+	m.DeleteTenant("acme")
+	got := gather(t, m, "helios_rate_limit_decisions_total")
+	if len(got) != 1 || got["algorithm=token_bucket,resource=search,result=allowed,tenant=globex"] != 1 {
+		t.Errorf("series = %v, want only globex's", got)
+	}
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// Count is a key's estimated total in a TopK sketch. The true total lies in
+// [Count-Error, Count].
+type Count struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+	Error uint64 `json:"error"`
+}
+
+// TopK finds heavy hitters with the space-saving algorithm: it tracks at
+// most capacity keys, and a new key evicts the smallest counter and
+// inherits its count as error. Any key whose share of the total exceeds
+// 1/capacity is guaranteed to be tracked.
+type TopK struct {
+	mu       sync.Mutex
+	capacity int
+	index    map[string]*counter
+	heap     counterHeap // min-heap on count
+}
+
+type counter struct {
+	Count
+	pos int
+}
+
+func NewTopK(capacity int) *TopK {
+	if capacity <= 0 {
+		capacity = 1000
+	}
+	return &TopK{
+		capacity: capacity,
+		index:    make(map[string]*counter, capacity),
+	}
+}
+
+// Add counts n occurrences of key and returns its new estimate.
+func (t *TopK) Add(key string, n uint64) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c, ok := t.index[key]; ok {
+		c.Count.Count += n
+		heap.Fix(&t.heap, c.pos)
+		return c.Count.Count
+	}
+	if len(t.heap) < t.capacity {
+		c := &counter{Count: Count{Key: key, Count: n}}
+		t.index[key] = c
+		heap.Push(&t.heap, c)
+		return n
+	}
+
+	// Replace the minimum; the newcomer may have been seen up to min times
+	// while untracked.
+	c := t.heap[0]
+	delete(t.index, c.Key)
+	c.Error = c.Count.Count
+	c.Count.Count += n
+	c.Key = key
+	t.index[key] = c
+	heap.Fix(&t.heap, 0)
+	return c.Count.Count
+}
+
+// Top returns up to n keys with the highest estimates, largest first.
+func (t *TopK) Top(n int) []Count {
+	t.mu.Lock()
+	out := make([]Count, len(t.heap))
+	for i, c := range t.heap {
+		out[i] = c.Count
+	}
+	t.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	if n >= 0 && n < len(out) {
+		out = out[:n]
+	}
+	return out
+}
+
+type counterHeap []*counter
+
+func (h counterHeap) Len() int           { return len(h) }
+func (h counterHeap) Less(i, j int) bool { return h[i].Count.Count < h[j].Count.Count }
+func (h counterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+func (h *counterHeap) Push(x any) {
+	c := x.(*counter)
+	c.pos = len(*h)
+	*h = append(*h, c)
+}
+func (h *counterHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
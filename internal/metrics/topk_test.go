@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+)
+
+func TestTopKFindsHeavyHitters(t *testing.T) {
+	sketch := NewTopK(10)
+	// 3 heavy keys among 1000 one-off keys.
+	for i := 0; i < 1000; i++ {
+		sketch.Add(fmt.Sprintf("light-%d", i), 1)
+		if i%4 == 0 {
+			sketch.Add("heavy-a", 3)
+			sketch.Add("heavy-b", 2)
+			sketch.Add("heavy-c", 1)
+		}
+	}
+
+	top := sketch.Top(3)
+	want := []string{"heavy-a", "heavy-b", "heavy-c"}
+	for i, c := range top {
+		if c.Key != want[i] {
+			t.Fatalf("Top(3) = %+v, want keys %v", top, want)
+		}
+		if c.Error > c.Count {
+			t.Errorf("%s: error %d exceeds count %d", c.Key, c.Error, c.Count)
+		}
+	}
+	// heavy-a was added 250 times with n=3; the estimate may only overcount.
+	if top[0].Count < 750 || top[0].Count-top[0].Error > 750 {
+		t.Errorf("heavy-a = %+v, want a range containing 750", top[0])
+	}
+}
+
+func TestTopKCapacity(t *testing.T) {
+	sketch := NewTopK(5)
+	for i := 0; i < 100; i++ {
+		sketch.Add(fmt.Sprintf("k%d", i), 1)
+	}
+	if got := len(sketch.Top(-1)); got != 5 {
+		t.Errorf("tracked %d keys, want 5", got)
+	}
+}
+
+func TestTenantLabelsBoundCardinality(t *testing.T) {
+	labels := NewTenantLabels([]string{"vip"}, 2, 50, time.Nanosecond)
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 100; i++ {
+			labels.Label(fmt.Sprintf("tenant-%d", i))
+		}
+		for i := 0; i < 10; i++ {
+			labels.Label("big")
+		}
+		labels.Label("vip")
+
+		// vip plus at most two promoted tenants at any time.
+		if got := labels.Labelled(); len(got) > 3 {
+			t.Fatalf("round %d: %d labelled tenants, want at most 3: %v", round, len(got), got)
+		}
+	}
+
+	if got := labels.Lookup("vip"); got != "vip" {
+		t.Errorf("allow-listed tenant labelled %q", got)
+	}
+	if got := labels.Lookup("big"); got != "big" {
+		t.Errorf("heaviest tenant labelled %q, want its own label", got)
+	}
+	if got := labels.Lookup("tenant-99"); got != OtherTenant {
+		t.Errorf("light tenant labelled %q, want %q", got, OtherTenant)
+	}
+}
+
+func TestHeavyHittersPerResource(t *testing.T) {
+	h := NewHeavyHitters(10, 1)
+	h.Observe("search", "acme:test…", 5, true)
+	h.Observe("search", "acme:test…", 1, false)
+	h.Observe("upload", "globex:demo…", 1, true) // beyond maxResources
+
+	top := h.Top(10)
+	if got := top["search"].Consumers; len(got) != 1 || got[0].Count != 5 {
+		t.Errorf("search consumers = %+v, want acme with 5", got)
+	}
+	if got := top["search"].Rejected; len(got) != 1 || got[0].Count != 1 {
+		t.Errorf("search rejected = %+v, want acme with 1", got)
+	}
+	if _, ok := top[OtherTenant]; !ok {
+		t.Errorf("resources = %v, want overflow in %q", top, OtherTenant)
+	}
+}
+
+func TestTenantLabelsPromoteAndDemote(t *testing.T) {
+	clk := clock.NewManual(time.Unix(1700000000, 0))
+	labels := NewTenantLabels([]string{"vip"}, 1, 10, time.Second)
+	labels.clock = clk
+	var demoted []string
+	labels.OnDemote(func(tenant string) { demoted = append(demoted, tenant) })
+
+	label := func(tenant string, n int) string {
+		var got string
+		for i := 0; i < n; i++ {
+			got = labels.Label(tenant)
+		}
+		return got
+	}
+
+	if got := label("a", 5); got != "a" {
+		t.Fatalf("heaviest tenant labelled %q, want its own label", got)
+	}
+	if got := label("b", 10); got != OtherTenant {
+		t.Errorf("b labelled %q before the next refresh, want %q", got, OtherTenant)
+	}
+
+	// b overtakes a at the next refresh; a's series go one refresh later.
+	clk.Advance(time.Second)
+	if got := label("b", 1); got != "b" {
+		t.Errorf("b labelled %q after overtaking a, want its own label", got)
+	}
+	if got := labels.Lookup("a"); got != OtherTenant {
+		t.Errorf("demoted tenant labelled %q, want %q", got, OtherTenant)
+	}
+	if len(demoted) != 0 {
+		t.Errorf("OnDemote called for %v in the pass that demoted them", demoted)
+	}
+	clk.Advance(time.Second)
+	label("b", 1)
+	if len(demoted) != 1 || demoted[0] != "a" {
+		t.Fatalf("demoted = %v, want [a]", demoted)
+	}
+
+	// A tenant promoted again before its series go keeps them.
+	label("a", 20)
+	clk.Advance(time.Second)
+	label("a", 1)
+	label("b", 20)
+	clk.Advance(time.Second)
+	label("b", 1)
+	if len(demoted) != 1 {
+		t.Errorf("demoted = %v, want b spared after regaining its label", demoted)
+	}
+
+	// The allow-list is never counted, ranked or demoted.
+	if got := label("vip", 100); got != "vip" {
+		t.Errorf("allow-listed tenant labelled %q", got)
+	}
+	if top := labels.sketch.Top(-1); len(top) != 2 {
+		t.Errorf("sketch = %+v, want only a and b", top)
+	}
+	if got := labels.Labelled(); len(got) != 2 || got[0] != "b" || got[1] != "vip" {
+		t.Errorf("labelled = %v, want [b vip]", got)
+	}
+}
@@ -0,0 +1,585 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+	"github.com/xizzxy/helios/internal/limiter"
+	"github.com/xizzxy/helios/internal/resilience"
+)
+
+// Factory builds the limiter that holds one policy's state.
+type Factory func(cfg limiter.Config) limiter.Limiter
+
+// Decision is one policy's verdict on a request.
+type Decision struct {
+	PolicyID  string
+	Mode      string
+	Algorithm limiter.Algorithm
+	Result    *limiter.Result
+	// Priorities is filled in by Quota only, one entry per priority from
+	// low to critical.
+	Priorities []PriorityQuota
+	// Profile is the schedule window in effect for a scheduled policy, or
+	// ProfileDefault outside its windows. It is empty for a policy with no
+	// schedule, and filled in by Quota only.
+	Profile string
+	// Override is the temporary override setting the policy's limit, if
+	// any. It is filled in by Quota only.
+	Override *Override
+}
+
+// PriorityQuota is what one priority may still use of a policy, and how
+// the policy has decided that priority's requests.
+type PriorityQuota struct {
+	Priority  resilience.Priority
+	Remaining int64
+	Allowed   uint64
+	Denied    uint64
+}
+
+// Evaluation is the outcome of every policy that matched a request.
+type Evaluation struct {
+	// Enforced is the most restrictive enforced decision, or nil when the
+	// resource has no enforced policy and the gateway default applies.
+	Enforced *Decision
+	// Shadow holds what each shadow policy would have decided. They never
+	// affect the request.
+	Shadow []Decision
+	// Complete joins the completions of every adaptive policy that
+	// admitted the request, enforced or shadow. It is nil when there are
+	// none; otherwise the caller must report the call's outcome, or
+	// limiter.OutcomeIgnored if the request is denied after all.
+	Complete limiter.Completion
+}
+
+// Stat counts one policy's decisions since it was loaded.
+type Stat struct {
+	Tenant   string
+	Resource string
+	PolicyID string
+	Mode     string
+	Allowed  uint64
+	Denied   uint64
+	Keys     *limiter.KeyStats // nil unless the policy keeps its state in memory
+}
+
+// Engine evaluates tenant policies. Each policy keeps its own limiter
+// state, so shadow and enforced policies on the same key never share
+// budget.
+type Engine struct {
+	factory Factory
+	base    limiter.Config
+
+	mu          sync.RWMutex
+	tenants     map[string]map[string][]*compiled // tenant -> resource -> policies
+	resources   map[string]int                    // resource -> tenants with a policy for it
+	configs     map[string]TenantConfig           // as stored, before overrides
+	overrides   map[string]map[string]Override    // tenant -> override ID -> override
+	timed       map[string]string                 // tenant -> overrides and profiles compiled in
+	due         map[string]time.Time              // tenant -> when its overrides or profiles next change
+	next        time.Time                         // earliest in due, or zero
+	rescheduled chan struct{}                     // signalled when next moves earlier
+
+	revision atomic.Int64 // etcd revision of the last change applied by Sync
+}
+
+type compiled struct {
+	tenant   string
+	id       string
+	resource string
+	mode     string
+	cfg      limiter.Config
+	reserve  Reserve
+	profile  string
+	override *Override
+	limiter  limiter.Limiter
+	allowed  [numPriorities]atomic.Uint64
+	denied   [numPriorities]atomic.Uint64
+}
+
+const numPriorities = int(resilience.PriorityCritical) + 1
+
+func (p *compiled) decided(priority resilience.Priority) (allowed, denied uint64) {
+	return p.allowed[priority].Load(), p.denied[priority].Load()
+}
+
+// NewEngine returns an engine with no policies. base supplies the settings
+// a Limit does not carry, such as MaxKeys and Clock.
+func NewEngine(base limiter.Config, factory Factory) *Engine {
+	return &Engine{
+		factory:     factory,
+		base:        base,
+		tenants:     make(map[string]map[string][]*compiled),
+		resources:   make(map[string]int),
+		configs:     make(map[string]TenantConfig),
+		overrides:   make(map[string]map[string]Override),
+		timed:       make(map[string]string),
+		due:         make(map[string]time.Time),
+		rescheduled: make(chan struct{}, 1),
+	}
+}
+
+// Set replaces a tenant's policies. A policy that keeps its algorithm
+// keeps its limiter state where the limiter allows, so flipping it from
+// shadow to enforce or changing its limits does not reset any buckets.
+func (e *Engine) Set(tc TenantConfig) error {
+	if err := tc.Validate(); err != nil {
+		return fmt.Errorf("tenant %q: %w", tc.TenantID, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.configs[tc.TenantID] = tc.withCron()
+	e.compile(tc.TenantID, e.now())
+	return nil
+}
+
+// SetOverride adds or replaces a temporary override. It applies between
+// its start and end as Refresh observes them.
+func (e *Engine) SetOverride(o Override) error {
+	if err := o.Validate(); err != nil {
+		return fmt.Errorf("override %q: %w", o.ID, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.overrides[o.TenantID] == nil {
+		e.overrides[o.TenantID] = make(map[string]Override)
+	}
+	e.overrides[o.TenantID][o.ID] = o
+	e.compile(o.TenantID, e.now())
+	return nil
+}
+
+// DeleteOverride revokes an override.
+func (e *Engine) DeleteOverride(tenant, id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.overrides[tenant], id)
+	if len(e.overrides[tenant]) == 0 {
+		delete(e.overrides, tenant)
+	}
+	e.compile(tenant, e.now())
+}
+
+// Refresh applies overrides that have started and removes those that have
+// ended by now, switches scheduled policies to the profile in effect, and
+// reports how many tenants it recompiled. Only tenants with an override or
+// profile change due by now are looked at; before the earliest of those,
+// Refresh returns without taking the write lock.
+func (e *Engine) Refresh(now time.Time) int {
+	e.mu.RLock()
+	idle := e.next.IsZero() || now.Before(e.next)
+	e.mu.RUnlock()
+	if idle {
+		return 0
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := 0
+	for tenant, at := range e.due {
+		if now.Before(at) {
+			continue
+		}
+		overrides := e.overrides[tenant]
+		for id, o := range overrides {
+			if !now.Before(o.End) {
+				delete(overrides, id)
+			}
+		}
+		if overrides != nil && len(overrides) == 0 {
+			delete(e.overrides, tenant)
+		}
+		if r := e.resolve(tenant, now); r.state != e.timed[tenant] {
+			e.compile(tenant, now)
+			n++
+		} else {
+			e.track(tenant, now)
+		}
+	}
+	e.next = time.Time{}
+	for _, at := range e.due {
+		if e.next.IsZero() || at.Before(e.next) {
+			e.next = at
+		}
+	}
+	return n
+}
+
+// NextRefresh returns when Refresh next has work to do, or the zero time
+// if no tenant has overrides or schedules.
+func (e *Engine) NextRefresh() time.Time {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.next
+}
+
+// Rescheduled is signalled when NextRefresh moves earlier.
+func (e *Engine) Rescheduled() <-chan struct{} {
+	return e.rescheduled
+}
+
+// track records when a tenant's overrides or profiles next change, as
+// seen at now, and drops tenants with neither. e.mu must be held.
+func (e *Engine) track(tenant string, now time.Time) {
+	var due time.Time
+	earliest := func(t time.Time) {
+		if due.IsZero() || t.Before(due) {
+			due = t
+		}
+	}
+	for _, o := range e.overrides[tenant] {
+		if now.Before(o.Start) {
+			earliest(o.Start)
+		}
+		earliest(o.End)
+	}
+	for _, l := range e.configs[tenant].Limits {
+		if len(l.Schedule) > 0 {
+			earliest(l.nextChange(now))
+		}
+	}
+
+	if due.IsZero() {
+		delete(e.due, tenant)
+		return
+	}
+	e.due[tenant] = due
+	if e.next.IsZero() || due.Before(e.next) {
+		e.next = due
+		select {
+		case e.rescheduled <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// activeOverrides returns the overrides that apply at now, and their IDs
+// in a form that changes whenever the set does.
+func activeOverrides(overrides map[string]Override, now time.Time) ([]Override, string) {
+	var active []Override
+	var ids []string
+	for id, o := range overrides {
+		if o.Active(now) {
+			active = append(active, o)
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return active, strings.Join(ids, ",")
+}
+
+func (e *Engine) now() time.Time {
+	return clock.Or(e.base.Clock).Now()
+}
+
+// resolved is a tenant's config as it applies at some time.
+type resolved struct {
+	tc        TenantConfig
+	overrides map[string]Override // by policy ID
+	profiles  map[string]string   // by policy ID, for scheduled policies
+	// state names the overrides and profiles in effect, and changes
+	// whenever they do.
+	state string
+	ok    bool
+}
+
+// resolve applies the profiles and overrides in effect at now to a
+// tenant's config. Overrides take precedence over profiles. e.mu must be
+// held.
+func (e *Engine) resolve(tenant string, now time.Time) resolved {
+	active, activeIDs := activeOverrides(e.overrides[tenant], now)
+	tc, ok := e.configs[tenant]
+	if !ok && len(active) == 0 {
+		return resolved{}
+	}
+	if !ok {
+		tc = TenantConfig{TenantID: tenant}
+	}
+	r := resolved{ok: true}
+	tc, r.profiles = tc.withSchedules(now)
+	r.tc, r.overrides = tc.withOverrides(active)
+
+	state := make([]string, 0, len(r.profiles))
+	for id, name := range r.profiles {
+		state = append(state, id+"="+name)
+	}
+	sort.Strings(state)
+	if activeIDs != "" || len(state) > 0 {
+		r.state = activeIDs + ";" + strings.Join(state, ",")
+	}
+	return r
+}
+
+// compile rebuilds a tenant's policies as they apply at now. e.mu must be
+// held.
+func (e *Engine) compile(tenant string, now time.Time) {
+	e.track(tenant, now)
+	r := e.resolve(tenant, now)
+	if !r.ok {
+		e.setPolicies(tenant, nil)
+		delete(e.timed, tenant)
+		return
+	}
+	if r.state != "" {
+		e.timed[tenant] = r.state
+	} else {
+		delete(e.timed, tenant)
+	}
+	tc := r.tc
+
+	previous := make(map[string]*compiled)
+	for _, policies := range e.tenants[tc.TenantID] {
+		for _, p := range policies {
+			previous[p.id] = p
+		}
+	}
+
+	ids := make([]string, 0, len(tc.Limits))
+	for id := range tc.Limits {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	byResource := make(map[string][]*compiled, len(ids))
+	for _, id := range ids {
+		l := tc.Limits[id]
+		p := &compiled{
+			tenant:   tc.TenantID,
+			id:       id,
+			resource: l.Resource,
+			mode:     l.Mode,
+			cfg:      e.limiterConfig(tc, l),
+			reserve:  l.Reserve,
+		}
+		if o, ok := r.overrides[id]; ok {
+			p.override = &o
+		}
+		p.profile = r.profiles[id]
+		if p.resource == "" {
+			p.resource = id
+		}
+		if p.mode == "" {
+			p.mode = ModeEnforce
+		}
+		if old, ok := previous[id]; ok && old.cfg.Algorithm == p.cfg.Algorithm {
+			if old.cfg == p.cfg {
+				p.limiter = old.limiter
+			} else {
+				p.limiter = limiter.Reconfigure(old.limiter, p.cfg)
+			}
+			if p.limiter != nil {
+				for i := range p.allowed {
+					p.allowed[i].Store(old.allowed[i].Load())
+					p.denied[i].Store(old.denied[i].Load())
+				}
+			}
+		}
+		if p.limiter == nil {
+			p.limiter = e.factory(p.cfg)
+		}
+		byResource[p.resource] = append(byResource[p.resource], p)
+	}
+	e.setPolicies(tc.TenantID, byResource)
+}
+
+// setPolicies replaces a tenant's policies, or drops them if byResource is
+// nil, and keeps the resource index in step. e.mu must be held.
+func (e *Engine) setPolicies(tenant string, byResource map[string][]*compiled) {
+	for resource := range e.tenants[tenant] {
+		if e.resources[resource]--; e.resources[resource] == 0 {
+			delete(e.resources, resource)
+		}
+	}
+	if byResource == nil {
+		delete(e.tenants, tenant)
+		return
+	}
+	for resource := range byResource {
+		e.resources[resource]++
+	}
+	e.tenants[tenant] = byResource
+}
+
+// HasResource reports whether any tenant has a policy for resource.
+func (e *Engine) HasResource(resource string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.resources[resource] > 0
+}
+
+// Delete drops a tenant's policies; its requests fall back to the gateway
+// default, or to the limits of its active overrides.
+func (e *Engine) Delete(tenant string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.configs, tenant)
+	e.compile(tenant, e.now())
+}
+
+func (e *Engine) limiterConfig(tc TenantConfig, l Limit) limiter.Config {
+	cfg := e.base
+	cfg.Limit = l.Limit
+	cfg.Burst = l.Burst
+	cfg.Window = l.Window
+	if tc.Algorithm != "" {
+		cfg.Algorithm = limiter.Algorithm(tc.Algorithm)
+	}
+	return cfg
+}
+
+// Evaluate runs every policy for the tenant's resource against key. The
+// request is denied if any enforced policy denies it, or if it would dip
+// into capacity reserved for a priority above its own. Enforced policies
+// are charged only for requests they all admit: when one denies, the
+// others get the cost back if their limiter is a limiter.Refunder.
+func (e *Engine) Evaluate(ctx context.Context, tenant, resource, key string, cost int64, priority resilience.Priority) (*Evaluation, error) {
+	priority = clampPriority(priority)
+	e.mu.RLock()
+	policies := e.tenants[tenant][resource]
+	e.mu.RUnlock()
+
+	ev := &Evaluation{}
+	var charged []*compiled // enforced policies that admitted the request
+	for _, p := range policies {
+		// Namespace the key so policies sharing a store keep separate state.
+		res, err := limiter.AllowReserved(ctx, p.limiter, key+"#"+p.id, cost, p.reserve.Floor(priority))
+		if err != nil {
+			if ev.Complete != nil {
+				ev.Complete(limiter.OutcomeIgnored, 0)
+			}
+			refund(ctx, charged, key, cost)
+			return nil, fmt.Errorf("policy %q: %w", p.id, err)
+		}
+		if res.Allowed {
+			p.allowed[priority].Add(1)
+		} else {
+			p.denied[priority].Add(1)
+		}
+		ev.Complete = limiter.JoinCompletions(ev.Complete, res.Complete)
+
+		d := Decision{PolicyID: p.id, Mode: p.mode, Algorithm: p.cfg.Algorithm, Result: res}
+		if p.mode == ModeShadow {
+			ev.Shadow = append(ev.Shadow, d)
+			continue
+		}
+		if res.Allowed {
+			charged = append(charged, p)
+		}
+		if ev.Enforced == nil || moreRestrictive(res, ev.Enforced.Result) {
+			ev.Enforced = &d
+		}
+	}
+	if ev.Enforced != nil && !ev.Enforced.Result.Allowed {
+		refund(ctx, charged, key, cost)
+	}
+	return ev, nil
+}
+
+// refund gives cost back to policies that admitted a request that was
+// turned away. A failed refund only leaves the policy charged for it, as
+// it would have been without refunds.
+func refund(ctx context.Context, charged []*compiled, key string, cost int64) {
+	for _, p := range charged {
+		limiter.Refund(ctx, p.limiter, key+"#"+p.id, cost)
+	}
+}
+
+// Quota reads, without charging, the state of each of the tenant's
+// policies for resource at key, including what is left for each priority.
+func (e *Engine) Quota(ctx context.Context, tenant, resource, key string) ([]Decision, error) {
+	e.mu.RLock()
+	policies := e.tenants[tenant][resource]
+	e.mu.RUnlock()
+
+	out := make([]Decision, 0, len(policies))
+	for _, p := range policies {
+		res, err := p.limiter.GetQuota(ctx, key+"#"+p.id)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %w", p.id, err)
+		}
+		d := Decision{PolicyID: p.id, Mode: p.mode, Algorithm: p.cfg.Algorithm, Result: res, Profile: p.profile, Override: p.override}
+		for pr := resilience.PriorityLow; pr <= resilience.PriorityCritical; pr++ {
+			q := PriorityQuota{Priority: pr, Remaining: res.Remaining}
+			q.Allowed, q.Denied = p.decided(pr)
+			if floor := p.reserve.Floor(pr); floor > 0 {
+				// A zero-cost call reads the state net of the reserve.
+				r, err := limiter.AllowReserved(ctx, p.limiter, key+"#"+p.id, 0, floor)
+				if err != nil {
+					return nil, fmt.Errorf("policy %q: %w", p.id, err)
+				}
+				q.Remaining = r.Remaining
+			}
+			d.Priorities = append(d.Priorities, q)
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// clampPriority maps out-of-range priorities to the nearest valid one.
+func clampPriority(p resilience.Priority) resilience.Priority {
+	return min(max(p, resilience.PriorityLow), resilience.PriorityCritical)
+}
+
+// moreRestrictive prefers denials, then the later retry, then the lower
+// remaining budget.
+func moreRestrictive(a, b *limiter.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.ResetTime.After(b.ResetTime)
+	}
+	return a.Remaining < b.Remaining
+}
+
+// Stats returns per-policy decision counts, ordered by tenant and policy.
+func (e *Engine) Stats() []Stat {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var stats []Stat
+	for _, resources := range e.tenants {
+		for _, policies := range resources {
+			for _, p := range policies {
+				st := Stat{
+					Tenant:   p.tenant,
+					Resource: p.resource,
+					PolicyID: p.id,
+					Mode:     p.mode,
+				}
+				for pr := range p.allowed {
+					st.Allowed += p.allowed[pr].Load()
+					st.Denied += p.denied[pr].Load()
+				}
+				if kt, ok := p.limiter.(limiter.KeyTracker); ok {
+					ks := kt.KeyStats()
+					st.Keys = &ks
+				}
+				stats = append(stats, st)
+			}
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Tenant != stats[j].Tenant {
+			return stats[i].Tenant < stats[j].Tenant
+		}
+		return stats[i].PolicyID < stats[j].PolicyID
+	})
+	return stats
+}
+
+// Revision is the etcd revision of the last policy change Sync applied, or
+// 0 before the first load.
+func (e *Engine) Revision() int64 {
+	return e.revision.Load()
+}
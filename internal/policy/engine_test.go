@@ -0,0 +1,488 @@
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+	"github.com/xizzxy/helios/internal/limiter"
+	"github.com/xizzxy/helios/internal/resilience"
+)
+
+func newTestEngine() *Engine {
+	base := limiter.Config{Clock: clock.NewManual(time.Unix(1700000000, 0))}
+	return NewEngine(base, func(cfg limiter.Config) limiter.Limiter {
+		return limiter.NewLocalManager(cfg).ForTenant("")
+	})
+}
+
+func TestShadowRunsBesideEnforced(t *testing.T) {
+	e := newTestEngine()
+	err := e.Set(TenantConfig{
+		TenantID: "acme",
+		Limits: map[string]Limit{
+			"api":        {Limit: 10, Burst: 10, Window: time.Minute},
+			"api-strict": {Limit: 2, Burst: 2, Window: time.Minute, Resource: "api", Mode: ModeShadow},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		ev, err := e.Evaluate(ctx, "acme", "api", "acme:api:k", 1, resilience.PriorityNormal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Enforced == nil || ev.Enforced.PolicyID != "api" {
+			t.Fatalf("request %d: enforced = %+v, want policy api", i, ev.Enforced)
+		}
+		if !ev.Enforced.Result.Allowed {
+			t.Errorf("request %d denied by the enforced policy", i)
+		}
+		if len(ev.Shadow) != 1 {
+			t.Fatalf("request %d: %d shadow decisions, want 1", i, len(ev.Shadow))
+		}
+		if want := i < 2; ev.Shadow[0].Result.Allowed != want {
+			t.Errorf("request %d: shadow allowed = %v, want %v", i, ev.Shadow[0].Result.Allowed, want)
+		}
+		if want := int64(9 - i); ev.Enforced.Result.Remaining != want {
+			t.Errorf("request %d: enforced remaining = %d, want %d", i, ev.Enforced.Result.Remaining, want)
+		}
+	}
+
+	stats := e.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("got %d stats, want 2", len(stats))
+	}
+	if s := stats[1]; s.PolicyID != "api-strict" || s.Allowed != 2 || s.Denied != 3 {
+		t.Errorf("shadow stat = %+v, want 2 allowed and 3 denied", s)
+	}
+}
+
+func TestFlippingModeKeepsState(t *testing.T) {
+	e := newTestEngine()
+	tc := TenantConfig{
+		TenantID: "acme",
+		Limits:   map[string]Limit{"default": {Limit: 3, Burst: 3, Window: time.Minute, Mode: ModeShadow}},
+	}
+	if err := e.Set(tc); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := e.Evaluate(ctx, "acme", "default", "k", 1, resilience.PriorityNormal); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := tc.Limits["default"]
+	l.Mode = ModeEnforce
+	tc.Limits["default"] = l
+	if err := e.Set(tc); err != nil {
+		t.Fatal(err)
+	}
+	ev, err := e.Evaluate(ctx, "acme", "default", "k", 1, resilience.PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Enforced == nil || ev.Enforced.Result.Allowed {
+		t.Errorf("enforced = %+v, want a denial from the budget spent in shadow mode", ev.Enforced)
+	}
+}
+
+func TestDeniedRequestIsNotChargedToOtherPolicies(t *testing.T) {
+	for _, algo := range []string{"token_bucket", "sliding_window"} {
+		t.Run(algo, func(t *testing.T) {
+			e := newTestEngine()
+			err := e.Set(TenantConfig{
+				TenantID:  "acme",
+				Algorithm: algo,
+				Limits: map[string]Limit{
+					"per-minute": {Limit: 10, Burst: 10, Window: time.Minute, Resource: "api"},
+					"per-hour":   {Limit: 3, Burst: 3, Window: time.Hour, Resource: "api"},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			for i := 0; i < 6; i++ {
+				ev, err := e.Evaluate(ctx, "acme", "api", "k", 1, resilience.PriorityNormal)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := i < 3; ev.Enforced.Result.Allowed != want {
+					t.Errorf("request %d: allowed = %v, want %v", i, ev.Enforced.Result.Allowed, want)
+				}
+			}
+
+			decisions, err := e.Quota(ctx, "acme", "api", "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range decisions {
+				if d.PolicyID == "per-minute" && d.Result.Remaining != 7 {
+					t.Errorf("per-minute remaining = %d, want 7: only the three admitted requests count", d.Result.Remaining)
+				}
+			}
+		})
+	}
+}
+
+func TestHasResourceFollowsPolicies(t *testing.T) {
+	e := newTestEngine()
+	set := func(tenant string, resources ...string) {
+		limits := make(map[string]Limit)
+		for _, r := range resources {
+			limits[r] = Limit{Limit: 1, Window: time.Minute}
+		}
+		if err := e.Set(TenantConfig{TenantID: tenant, Limits: limits}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set("acme", "search", "upload")
+	set("globex", "search")
+	set("acme", "upload")
+	if !e.HasResource("search") || !e.HasResource("upload") {
+		t.Error("lost a resource that still has a policy")
+	}
+	e.Delete("globex")
+	if e.HasResource("search") {
+		t.Error("search is still known after its last policy went")
+	}
+	if e.HasResource("anything") {
+		t.Error("a resource without a policy is known")
+	}
+}
+
+func TestNoPolicyFallsThrough(t *testing.T) {
+	e := newTestEngine()
+	ev, err := e.Evaluate(context.Background(), "unknown", "default", "k", 1, resilience.PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Enforced != nil || len(ev.Shadow) != 0 {
+		t.Errorf("evaluation = %+v, want empty", ev)
+	}
+}
+
+func TestValidateRejectsUnknownMode(t *testing.T) {
+	tc := TenantConfig{Limits: map[string]Limit{"default": {Limit: 1, Mode: "dry-run"}}}
+	if err := tc.Validate(); err == nil {
+		t.Error("Validate accepted an unknown mode")
+	}
+}
+
+func TestReserveHoldsCapacityForHigherPriorities(t *testing.T) {
+	e := newTestEngine()
+	err := e.Set(TenantConfig{
+		TenantID:  "acme",
+		Algorithm: string(limiter.AlgoTokenBucket),
+		Limits: map[string]Limit{"api": {
+			Limit: 10, Burst: 10, Window: time.Hour,
+			Reserve: Reserve{Normal: 0.5, Critical: 0.2},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	admitted := func(p resilience.Priority) int {
+		n := 0
+		for i := 0; i < 10; i++ {
+			ev, err := e.Evaluate(ctx, "acme", "api", "k", 1, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.Enforced.Result.Allowed {
+				n++
+			}
+		}
+		return n
+	}
+	// Low stops at the normal reserve, normal at the critical one, and
+	// critical may drain the bucket.
+	for _, tc := range []struct {
+		p    resilience.Priority
+		want int
+	}{{resilience.PriorityLow, 5}, {resilience.PriorityNormal, 3}, {resilience.PriorityCritical, 2}} {
+		if got := admitted(tc.p); got != tc.want {
+			t.Errorf("%s: admitted %d, want %d", tc.p, got, tc.want)
+		}
+	}
+
+	quota, err := e.Quota(ctx, "acme", "api", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range quota[0].Priorities {
+		if q.Remaining != 0 || q.Allowed+q.Denied != 10 {
+			t.Errorf("%s: %+v, want nothing left after 10 decisions", q.Priority, q)
+		}
+	}
+}
+
+func TestValidateRejectsFullReserve(t *testing.T) {
+	tc := TenantConfig{Limits: map[string]Limit{"default": {Limit: 1, Reserve: Reserve{Critical: 1}}}}
+	if err := tc.Validate(); err == nil {
+		t.Error("Validate accepted a reserve of the whole capacity")
+	}
+}
+
+func TestAdaptivePolicyHoldsSlotsUntilComplete(t *testing.T) {
+	e := newTestEngine()
+	err := e.Set(TenantConfig{
+		TenantID:  "acme",
+		Algorithm: string(limiter.AlgoAdaptive),
+		Limits:    map[string]Limit{"api": {Limit: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	var pending []limiter.Completion
+	for i := 0; i < 3; i++ {
+		ev, err := e.Evaluate(ctx, "acme", "api", "acme:api:k", 1, resilience.PriorityNormal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i < 2; ev.Enforced.Result.Allowed != want {
+			t.Fatalf("call %d: allowed = %v, want %v", i, ev.Enforced.Result.Allowed, want)
+		}
+		if ev.Complete != nil {
+			pending = append(pending, ev.Complete)
+		}
+	}
+	if len(pending) != 2 {
+		t.Fatalf("%d completions, want one per admitted call", len(pending))
+	}
+
+	pending[0](limiter.OutcomeIgnored, 0)
+	quota, err := e.Quota(ctx, "acme", "api", "acme:api:k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quota) != 1 || quota[0].Result.Limit != 2 || quota[0].Result.Remaining != 1 {
+		t.Errorf("quota = %+v, want one of 2 slots free", quota[0].Result)
+	}
+}
+
+func TestOverrideAppliesBetweenStartAndEnd(t *testing.T) {
+	clk := clock.NewManual(time.Unix(1700000000, 0))
+	e := NewEngine(limiter.Config{Clock: clk}, func(cfg limiter.Config) limiter.Limiter {
+		return limiter.NewLocalManager(cfg).ForTenant("")
+	})
+	err := e.Set(TenantConfig{
+		TenantID:  "acme",
+		Algorithm: string(limiter.AlgoTokenBucket),
+		Limits:    map[string]Limit{"api": {Limit: 10, Burst: 10, Window: time.Hour}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := clk.Now().Add(time.Minute)
+	err = e.SetOverride(Override{
+		ID: "launch", TenantID: "acme", Resource: "api", Limit: 20,
+		Start: start, End: start.Add(time.Hour), Reason: "launch", GrantedBy: "alice",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	spend := func(n int) (last *Decision) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			ev, err := e.Evaluate(ctx, "acme", "api", "k", 1, resilience.PriorityNormal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last = ev.Enforced
+		}
+		return last
+	}
+	if d := spend(4); d.Result.Limit != 10 || d.Result.Remaining != 6 {
+		t.Fatalf("before start: %+v, want 6 of 10 left", d.Result)
+	}
+
+	clk.Set(start)
+	if n := e.Refresh(clk.Now()); n != 1 {
+		t.Fatalf("Refresh at start recompiled %d tenants, want 1", n)
+	}
+	// The bucket keeps the 4 tokens spent and grows towards the new burst.
+	if d := spend(1); d.Result.Limit != 20 || d.Result.Remaining != 5 {
+		t.Errorf("at start: %+v, want 5 of 20 left", d.Result)
+	}
+	quota, err := e.Quota(ctx, "acme", "api", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := quota[0].Override; o == nil || o.ID != "launch" {
+		t.Errorf("quota override = %+v, want launch", o)
+	}
+
+	clk.Set(start.Add(time.Hour))
+	if n := e.Refresh(clk.Now()); n != 1 {
+		t.Fatalf("Refresh at end recompiled %d tenants, want 1", n)
+	}
+	if d := spend(1); d.Result.Limit != 10 || d.Override != nil {
+		t.Errorf("after end: %+v, want the configured limit of 10", d.Result)
+	}
+	if n := e.Refresh(clk.Now()); n != 0 {
+		t.Errorf("idle Refresh recompiled %d tenants", n)
+	}
+}
+
+func TestOverrideWithoutPolicyActsAsOne(t *testing.T) {
+	e := newTestEngine()
+	now := time.Unix(1700000000, 0)
+	err := e.SetOverride(Override{
+		ID: "x", TenantID: "beta", Resource: "export", Limit: 1,
+		Start: now, End: now.Add(time.Hour), Reason: "migration", GrantedBy: "bob",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := e.Evaluate(context.Background(), "beta", "export", "k", 1, resilience.PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Enforced == nil || ev.Enforced.PolicyID != "override:x" {
+		t.Fatalf("enforced = %+v, want the override's own policy", ev.Enforced)
+	}
+
+	e.DeleteOverride("beta", "x")
+	if ev, _ := e.Evaluate(context.Background(), "beta", "export", "k", 1, resilience.PriorityNormal); ev.Enforced != nil {
+		t.Errorf("enforced = %+v after revocation, want the gateway default", ev.Enforced)
+	}
+}
+
+func TestOverrideNeedsReasonAndGrantor(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	o := Override{ID: "x", TenantID: "acme", Resource: "api", Limit: 1, Start: now, End: now.Add(time.Hour)}
+	if err := o.Validate(); err == nil {
+		t.Error("Validate accepted an override without a reason or grantor")
+	}
+}
+
+func TestScheduleSwitchesProfileAndKeepsState(t *testing.T) {
+	// 05:59 UTC, a minute before the night window ends.
+	clk := clock.NewManual(time.Date(2024, time.June, 3, 5, 59, 0, 0, time.UTC))
+	e := NewEngine(limiter.Config{Clock: clk}, func(cfg limiter.Config) limiter.Limiter {
+		return limiter.NewLocalManager(cfg).ForTenant("")
+	})
+	err := e.Set(TenantConfig{
+		TenantID:  "acme",
+		Algorithm: string(limiter.AlgoTokenBucket),
+		Limits: map[string]Limit{"batch": {
+			Limit: 10, Burst: 10, Window: time.Hour,
+			Schedule: []Window{{Name: "night", Cron: "* 0-5 * * *", Limit: 20, Burst: 20}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 15; i++ {
+		if _, err := e.Evaluate(ctx, "acme", "batch", "k", 1, resilience.PriorityNormal); err != nil {
+			t.Fatal(err)
+		}
+	}
+	quota, err := e.Quota(ctx, "acme", "batch", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := quota[0]; q.Profile != "night" || q.Result.Limit != 20 || q.Result.Remaining != 5 {
+		t.Fatalf("at night: profile %q, %+v, want 5 of 20 left", q.Profile, q.Result)
+	}
+
+	clk.Set(time.Date(2024, time.June, 3, 6, 0, 0, 0, time.UTC))
+	if n := e.Refresh(clk.Now()); n != 1 {
+		t.Fatalf("Refresh at 06:00 recompiled %d tenants, want 1", n)
+	}
+	// The bucket holds what was left of the night's, a little refilled.
+	quota, err = e.Quota(ctx, "acme", "batch", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := quota[0]; q.Profile != ProfileDefault || q.Result.Limit != 10 || q.Result.Remaining != 5 {
+		t.Errorf("by day: profile %q, %+v, want 5 of 10 left", q.Profile, q.Result)
+	}
+	if n := e.Refresh(clk.Now().Add(time.Minute)); n != 0 {
+		t.Errorf("Refresh within the profile recompiled %d tenants", n)
+	}
+}
+
+func TestRefreshWaitsForTheNextChange(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, time.June, 3, 5, 30, 0, 0, time.UTC))
+	e := NewEngine(limiter.Config{Clock: clk}, func(cfg limiter.Config) limiter.Limiter {
+		return limiter.NewLocalManager(cfg).ForTenant("")
+	})
+	for tenant, schedule := range map[string][]Window{
+		"acme":   {{Name: "night", Cron: "* 0-5 * * *", Limit: 20}},
+		"globex": nil,
+	} {
+		err := e.Set(TenantConfig{TenantID: tenant, Limits: map[string]Limit{"api": {Limit: 10, Schedule: schedule}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-e.Rescheduled()
+
+	sixAM := time.Date(2024, time.June, 3, 6, 0, 0, 0, time.UTC)
+	if next := e.NextRefresh(); !next.Equal(sixAM) {
+		t.Errorf("next refresh = %v, want the end of acme's night window at %v", next, sixAM)
+	}
+	if _, ok := e.due["globex"]; ok {
+		t.Error("globex, with neither schedule nor override, is tracked")
+	}
+	if n := e.Refresh(sixAM.Add(-time.Second)); n != 0 {
+		t.Errorf("Refresh before the change recompiled %d tenants", n)
+	}
+
+	// An override starting sooner brings the next refresh forward.
+	start := clk.Now().Add(5 * time.Minute)
+	err := e.SetOverride(Override{
+		ID: "x", TenantID: "globex", Resource: "api", Limit: 50,
+		Start: start, End: start.Add(time.Hour), Reason: "launch", GrantedBy: "alice",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.Rescheduled():
+	default:
+		t.Error("an earlier override did not signal Rescheduled")
+	}
+	if next := e.NextRefresh(); !next.Equal(start) {
+		t.Errorf("next refresh = %v, want the override's start at %v", next, start)
+	}
+	if n := e.Refresh(start); n != 1 {
+		t.Errorf("Refresh at the override's start recompiled %d tenants, want 1", n)
+	}
+	if next := e.NextRefresh(); !next.Equal(sixAM) {
+		t.Errorf("next refresh = %v after the start, want %v", next, sixAM)
+	}
+}
+
+func TestValidateRejectsBadSchedule(t *testing.T) {
+	for _, w := range []Window{
+		{Cron: "* 0-5 * * *", Limit: 1},
+		{Name: "night", Cron: "* 0-5 * *", Limit: 1},
+		{Name: "night", Cron: "* 0-5 * * *", Limit: -1},
+		// The limiter would take a limit of 0 as unset.
+		{Name: "night", Cron: "* 0-5 * * *", Limit: 0, Burst: 5},
+	} {
+		tc := TenantConfig{Limits: map[string]Limit{"default": {Limit: 1, Schedule: []Window{w}}}}
+		if err := tc.Validate(); err == nil {
+			t.Errorf("Validate accepted window %+v", w)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+)
+
+// OverridePrefix is the etcd prefix overrides are stored under, as
+// OverridePrefix<tenant>/<id>. Each key is attached to a lease that runs
+// out shortly after the override ends.
+const OverridePrefix = "/helios/overrides/"
+
+// OverrideAuditPrefix is the etcd prefix of the override audit trail, as
+// OverrideAuditPrefix<tenant>/<unix nanoseconds>-<id>. Entries never
+// expire.
+const OverrideAuditPrefix = "/helios/audit/overrides/"
+
+// OverrideKey is the etcd key for one of a tenant's overrides.
+func OverrideKey(tenantID, id string) string {
+	return OverridePrefix + tenantID + "/" + id
+}
+
+// Override temporarily replaces the limit of a tenant's enforced policies
+// for a resource between Start and End. If the resource has no enforced
+// policy, the override acts as one of its own, with policy ID
+// "override:<id>".
+type Override struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Resource string `json:"resource"`
+	Limit    int64  `json:"limit"`
+	// Burst defaults to Limit.
+	Burst int64 `json:"burst,omitempty"`
+	// Window is only used when the override acts as its own policy, and
+	// defaults to a minute.
+	Window    time.Duration `json:"window,omitempty"`
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Reason    string        `json:"reason"`
+	GrantedBy string        `json:"granted_by"`
+	Created   time.Time     `json:"created"`
+}
+
+// OverrideEvent is one entry of the override audit trail.
+type OverrideEvent struct {
+	Action string `json:"action"` // "granted" or "revoked"
+	Actor  string `json:"actor"`
+	// Authenticated is false when Actor is only what the caller claimed.
+	Authenticated bool      `json:"authenticated"`
+	At            time.Time `json:"at"`
+	Override      Override  `json:"override"`
+}
+
+const (
+	OverrideGranted = "granted"
+	OverrideRevoked = "revoked"
+)
+
+// Validate reports what is wrong with the override, if anything.
+func (o Override) Validate() error {
+	switch {
+	case o.TenantID == "" || o.Resource == "":
+		return fmt.Errorf("override needs a tenant and a resource")
+	case o.Limit <= 0:
+		return fmt.Errorf("override limit must be positive")
+	case o.Burst < 0 || o.Window < 0:
+		return fmt.Errorf("override burst and window must not be negative")
+	case !o.End.After(o.Start):
+		return fmt.Errorf("override must end after it starts")
+	case o.Reason == "":
+		return fmt.Errorf("override needs a reason")
+	case o.GrantedBy == "":
+		return fmt.Errorf("override needs to say who granted it")
+	}
+	return nil
+}
+
+// Active reports whether the override applies at t.
+func (o Override) Active(t time.Time) bool {
+	return !t.Before(o.Start) && t.Before(o.End)
+}
+
+// policyID is the ID the override takes when it acts as its own policy.
+func (o Override) policyID() string {
+	return "override:" + o.ID
+}
+
+// withOverrides returns tc with the given overrides applied. Where several
+// target the same resource, the most recently created one wins. It also
+// maps each affected policy ID to the override that set its limit.
+func (tc TenantConfig) withOverrides(overrides []Override) (TenantConfig, map[string]Override) {
+	if len(overrides) == 0 {
+		return tc, nil
+	}
+	winners := make(map[string]Override)
+	for _, o := range overrides {
+		w, ok := winners[o.Resource]
+		if !ok || o.Created.After(w.Created) || (o.Created.Equal(w.Created) && o.ID > w.ID) {
+			winners[o.Resource] = o
+		}
+	}
+
+	limits := make(map[string]Limit, len(tc.Limits)+len(winners))
+	for id, l := range tc.Limits {
+		limits[id] = l
+	}
+	applied := make(map[string]Override)
+	for _, o := range winners {
+		burst := o.Burst
+		if burst == 0 {
+			burst = o.Limit
+		}
+		matched := false
+		for id, l := range tc.Limits {
+			if l.resource(id) != o.Resource || l.Mode == ModeShadow {
+				continue
+			}
+			l.Limit, l.Burst = o.Limit, burst
+			limits[id] = l
+			applied[id] = o
+			matched = true
+		}
+		if !matched {
+			window := o.Window
+			if window <= 0 {
+				window = time.Minute
+			}
+			limits[o.policyID()] = Limit{Limit: o.Limit, Burst: burst, Window: window, Resource: o.Resource}
+			applied[o.policyID()] = o
+		}
+	}
+	tc.Limits = limits
+	return tc, applied
+}
+
+// resource is the resource the policy with the given ID applies to.
+func (l Limit) resource(id string) string {
+	if l.Resource != "" {
+		return l.Resource
+	}
+	return id
+}
@@ -0,0 +1,107 @@
+// Package policy holds the tenant rate-limit policies the control plane
+// stores in etcd, and evaluates them in the gateway.
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xizzxy/helios/internal/limiter"
+	"github.com/xizzxy/helios/internal/resilience"
+)
+
+// TenantPrefix is the etcd prefix tenant configs are stored under.
+const TenantPrefix = "/helios/tenants/"
+
+// TenantKey is the etcd key for a tenant's config.
+func TenantKey(tenantID string) string {
+	return TenantPrefix + tenantID
+}
+
+type TenantConfig struct {
+	TenantID  string           `json:"tenant_id"`
+	Limits    map[string]Limit `json:"limits"`
+	APIKeys   []string         `json:"api_keys"`
+	Algorithm string           `json:"algorithm"` // "token_bucket", "sliding_window" or "adaptive"
+	Mode      string           `json:"mode"`      // "fast" or "strong"
+	Created   time.Time        `json:"created"`
+	Updated   time.Time        `json:"updated"`
+}
+
+// Limit is one policy, keyed by its ID in TenantConfig.Limits. Several
+// policies may target the same resource, e.g. an enforced limit and a
+// stricter one in shadow mode. Under the "adaptive" algorithm Limit is the
+// initial concurrency limit, Burst the most it may grow to, and Window is
+// unused.
+type Limit struct {
+	Limit  int64         `json:"limit"`
+	Window time.Duration `json:"window"`
+	Burst  int64         `json:"burst"`
+	// Resource the policy applies to; defaults to its key in Limits.
+	Resource string `json:"resource,omitempty"`
+	// Mode is "enforce" (the default) or "shadow".
+	Mode string `json:"mode,omitempty"`
+	// Reserve holds capacity back for higher priority requests.
+	Reserve Reserve `json:"reserve"`
+	// Schedule switches Limit and Burst to another profile during its
+	// windows. The policy keeps its state across the switch.
+	Schedule []Window `json:"schedule,omitempty"`
+}
+
+// Reserve holds back fractions of a policy's capacity (the burst of a token
+// bucket, the limit of a sliding window or the current concurrency limit)
+// by request priority. A request is denied if admitting it would leave
+// less than its priority's share untouched.
+type Reserve struct {
+	// Normal is the share low-priority requests may not use.
+	Normal float64 `json:"normal,omitempty"`
+	// Critical is the share only critical requests may use.
+	Critical float64 `json:"critical,omitempty"`
+}
+
+// Floor is the share of capacity that must remain after a request of
+// priority p. Capacity reserved for critical requests is closed to low
+// priority ones too.
+func (r Reserve) Floor(p resilience.Priority) float64 {
+	switch {
+	case p >= resilience.PriorityCritical:
+		return 0
+	case p == resilience.PriorityNormal:
+		return r.Critical
+	default:
+		return max(r.Normal, r.Critical)
+	}
+}
+
+const (
+	ModeEnforce = "enforce"
+	ModeShadow  = "shadow"
+)
+
+// Validate reports the first invalid policy in the config.
+func (tc TenantConfig) Validate() error {
+	switch limiter.Algorithm(tc.Algorithm) {
+	case "", limiter.AlgoTokenBucket, limiter.AlgoSlidingWindow, limiter.AlgoAdaptive:
+	default:
+		return fmt.Errorf("unknown algorithm %q", tc.Algorithm)
+	}
+	for id, l := range tc.Limits {
+		switch l.Mode {
+		case "", ModeEnforce, ModeShadow:
+		default:
+			return fmt.Errorf("limit %q: unknown mode %q (want %q or %q)", id, l.Mode, ModeEnforce, ModeShadow)
+		}
+		if l.Limit < 0 || l.Burst < 0 || l.Window < 0 {
+			return fmt.Errorf("limit %q: limit, burst and window must not be negative", id)
+		}
+		for _, share := range []float64{l.Reserve.Normal, l.Reserve.Critical} {
+			if share < 0 || share >= 1 {
+				return fmt.Errorf("limit %q: reserve shares must be at least 0 and below 1", id)
+			}
+		}
+		if err := l.validateSchedule(); err != nil {
+			return fmt.Errorf("limit %q: %w", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProfileDefault names the limits a scheduled policy has outside all of
+// its windows.
+const ProfileDefault = "default"
+
+// Window is a limit profile a policy switches to while the time matches
+// Cron, a five-field cron expression in UTC:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field is "*", a number, a range "a-b", a step "*/n" or "a-b/n", or a
+// comma-separated list of those. Day of week runs from 0 (Sunday) to 6, and
+// 7 is Sunday too. As in cron, a time matches when both day fields do, or
+// either of them when both are restricted. "* 0-5 * * *" is midnight to
+// 06:00 every day, and "* 9-16 * * 1-5" business hours on weekdays.
+type Window struct {
+	Name  string `json:"name"`
+	Cron  string `json:"cron"`
+	Limit int64  `json:"limit"`
+	Burst int64  `json:"burst"`
+
+	spec *cronSpec // Cron, parsed once by withCron
+}
+
+// scheduleHorizon bounds the search for a schedule's next change. A
+// schedule that stays put for longer is looked at again after it.
+const scheduleHorizon = 24 * time.Hour
+
+// profile returns the limit in effect at t and the name of its profile.
+// The first matching window wins; outside all of them the policy's own
+// limit and burst apply.
+func (l Limit) profile(t time.Time) (Limit, string) {
+	for _, w := range l.Schedule {
+		spec := w.spec
+		if spec == nil {
+			parsed, err := parseCron(w.Cron)
+			if err != nil {
+				continue
+			}
+			spec = &parsed
+		}
+		if !spec.matches(t) {
+			continue
+		}
+		l.Limit, l.Burst = w.Limit, w.Burst
+		return l, w.Name
+	}
+	return l, ProfileDefault
+}
+
+// nextChange returns the first minute after now whose profile differs
+// from the one at now, or now plus scheduleHorizon if there is none
+// before it.
+func (l Limit) nextChange(now time.Time) time.Time {
+	_, current := l.profile(now)
+	t := now.UTC().Truncate(time.Minute)
+	for end := now.Add(scheduleHorizon); t.Before(end); {
+		t = t.Add(time.Minute)
+		if _, name := l.profile(t); name != current {
+			return t
+		}
+	}
+	return t
+}
+
+func (l Limit) validateSchedule() error {
+	names := make(map[string]bool, len(l.Schedule))
+	for _, w := range l.Schedule {
+		switch {
+		case w.Name == "" || w.Name == ProfileDefault:
+			return fmt.Errorf("schedule windows need a name other than %q", ProfileDefault)
+		case names[w.Name]:
+			return fmt.Errorf("schedule window %q appears twice", w.Name)
+		case w.Limit <= 0:
+			return fmt.Errorf("schedule window %q: limit must be positive", w.Name)
+		case w.Burst < 0:
+			return fmt.Errorf("schedule window %q: burst must not be negative", w.Name)
+		}
+		names[w.Name] = true
+		if _, err := parseCron(w.Cron); err != nil {
+			return fmt.Errorf("schedule window %q: %w", w.Name, err)
+		}
+	}
+	return nil
+}
+
+// withCron returns tc with every schedule window's cron expression parsed,
+// so that profiles are looked up without parsing. tc must be valid.
+func (tc TenantConfig) withCron() TenantConfig {
+	limits := make(map[string]Limit, len(tc.Limits))
+	for id, l := range tc.Limits {
+		if len(l.Schedule) > 0 {
+			schedule := make([]Window, len(l.Schedule))
+			for i, w := range l.Schedule {
+				if spec, err := parseCron(w.Cron); err == nil {
+					w.spec = &spec
+				}
+				schedule[i] = w
+			}
+			l.Schedule = schedule
+		}
+		limits[id] = l
+	}
+	tc.Limits = limits
+	return tc
+}
+
+// withSchedules returns tc with each scheduled policy's limits set to the
+// profile in effect at t, and the profile names by policy ID.
+func (tc TenantConfig) withSchedules(t time.Time) (TenantConfig, map[string]string) {
+	var profiles map[string]string
+	for id, l := range tc.Limits {
+		if len(l.Schedule) == 0 {
+			continue
+		}
+		if profiles == nil {
+			profiles = make(map[string]string)
+			limits := make(map[string]Limit, len(tc.Limits))
+			for id, l := range tc.Limits {
+				limits[id] = l
+			}
+			tc.Limits = limits
+		}
+		tc.Limits[id], profiles[id] = l.profile(t)
+	}
+	return tc, profiles
+}
+
+// cronSpec holds the values each cron field matches, as bit sets.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a "*" day field, which the other day field
+	// then decides alone.
+	domAny, dowAny bool
+}
+
+func parseCron(expr string) (cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSpec{}, fmt.Errorf("cron %q: want 5 fields, got %d", expr, len(fields))
+	}
+	var spec cronSpec
+	for i, f := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&spec.minute, 0, 59},
+		{&spec.hour, 0, 23},
+		{&spec.dom, 1, 31},
+		{&spec.month, 1, 12},
+		{&spec.dow, 0, 7},
+	} {
+		bits, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return cronSpec{}, fmt.Errorf("cron %q: %w", expr, err)
+		}
+		*f.bits = bits
+	}
+	if spec.dow&(1<<7) != 0 {
+		spec.dow |= 1
+	}
+	spec.domAny = strings.HasPrefix(fields[2], "*")
+	spec.dowAny = strings.HasPrefix(fields[4], "*")
+	return spec, nil
+}
+
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if r, s, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			rng, step = r, n
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("bad value in %q", part)
+				}
+			}
+			if from < lo || to > hi || from > to {
+				return 0, fmt.Errorf("%q is outside %d-%d", part, lo, hi)
+			}
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (s cronSpec) matches(t time.Time) bool {
+	t = t.UTC()
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
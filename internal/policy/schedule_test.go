@@ -0,0 +1,46 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronMatches(t *testing.T) {
+	// 2024-06-03 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.June, day, hour, minute, 0, 0, time.UTC)
+	}
+	for _, tc := range []struct {
+		cron string
+		t    time.Time
+		want bool
+	}{
+		{"* 0-5 * * *", at(3, 0, 0), true},
+		{"* 0-5 * * *", at(3, 5, 59), true},
+		{"* 0-5 * * *", at(3, 6, 0), false},
+		{"* 9-16 * * 1-5", at(3, 12, 0), true},
+		{"* 9-16 * * 1-5", at(2, 12, 0), false},
+		{"* * * * 7", at(2, 12, 0), true},
+		{"*/15 * * * *", at(3, 1, 30), true},
+		{"*/15 * * * *", at(3, 1, 31), false},
+		{"0,30 12 * 6 *", at(3, 12, 30), true},
+		{"* * 1 * 1", at(3, 12, 0), true}, // either day field when both are set
+		{"* * 1 * 2", at(3, 12, 0), false},
+	} {
+		spec, err := parseCron(tc.cron)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.cron, err)
+		}
+		if got := spec.matches(tc.t); got != tc.want {
+			t.Errorf("%q at %s: matches = %v, want %v", tc.cron, tc.t.Format(time.RFC1123), got, tc.want)
+		}
+	}
+}
+
+func TestParseCronRejectsBadExpressions(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 5-2 * * *", "* */0 * * *", "* * 0 * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded", expr)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Source is the part of an etcd client Sync reads from.
+type Source interface {
+	clientv3.KV
+	clientv3.Watcher
+}
+
+// relistBackoff is how long Sync waits to list a prefix again after its
+// watch ended.
+var relistBackoff = time.Second
+
+// Sync loads every tenant config and override from etcd into the engine,
+// then applies changes in the background until ctx is cancelled. A config
+// that fails to parse or validate is logged and leaves the tenant's
+// previous policies in place. Overrides start and end, and scheduled
+// policies switch profiles, on time without a change in etcd. When a watch
+// fails, after compaction or an etcd restart, its prefix is listed again
+// and watched from the new revision.
+func (e *Engine) Sync(ctx context.Context, client Source, logger *slog.Logger) error {
+	tenants := &prefixWatch{
+		prefix: TenantPrefix,
+		name:   "Tenant policy",
+		put:    func(key, value []byte) { e.apply(key, value, logger) },
+		del: func(key []byte) {
+			tenant := strings.TrimPrefix(string(key), TenantPrefix)
+			e.Delete(tenant)
+			logger.Info("Removed tenant policies", "tenant", tenant)
+		},
+		synced:  func(rev int64) { e.revision.Store(rev) },
+		backoff: relistBackoff,
+	}
+	// Deleted override keys were revoked, or their lease ran out after
+	// Refresh had already removed them.
+	overrides := &prefixWatch{
+		prefix: OverridePrefix,
+		name:   "Override",
+		put:    func(key, value []byte) { e.applyOverride(key, value, logger) },
+		del: func(key []byte) {
+			tenant, id, _ := strings.Cut(strings.TrimPrefix(string(key), OverridePrefix), "/")
+			e.DeleteOverride(tenant, id)
+			logger.Info("Removed override", "tenant", tenant, "override", id)
+		},
+		backoff: relistBackoff,
+	}
+
+	rev, err := tenants.list(ctx, client)
+	if err != nil {
+		return fmt.Errorf("list tenant policies: %w", err)
+	}
+	if _, err := overrides.list(ctx, client, clientv3.WithRev(rev)); err != nil {
+		return fmt.Errorf("list overrides: %w", err)
+	}
+	logger.Info("Loaded tenant policies", "tenants", len(tenants.keys), "overrides", len(overrides.keys), "revision", rev)
+
+	go tenants.follow(ctx, client, rev, logger)
+	go overrides.follow(ctx, client, rev, logger)
+
+	// Sleep until the next override or profile change, waking early when
+	// a new one comes sooner.
+	go func() {
+		timer := time.NewTimer(e.untilRefresh())
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.Rescheduled():
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+			case <-timer.C:
+				if n := e.Refresh(e.now()); n > 0 {
+					logger.Info("Applied override and schedule changes", "tenants", n)
+				}
+			}
+			timer.Reset(e.untilRefresh())
+		}
+	}()
+	return nil
+}
+
+// prefixWatch keeps the engine in step with every key under prefix.
+type prefixWatch struct {
+	prefix  string
+	name    string // in log messages
+	put     func(key, value []byte)
+	del     func(key []byte)
+	synced  func(rev int64) // optional, after each change is applied
+	backoff time.Duration   // before listing again
+
+	keys map[string]bool // present as of the last revision applied
+}
+
+// list applies every key under the prefix, deletes the ones that went away
+// since the last listing, and returns the revision read.
+func (w *prefixWatch) list(ctx context.Context, client Source, opts ...clientv3.OpOption) (int64, error) {
+	resp, err := client.Get(ctx, w.prefix, append([]clientv3.OpOption{clientv3.WithPrefix()}, opts...)...)
+	if err != nil {
+		return 0, err
+	}
+	keys := make(map[string]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		keys[string(kv.Key)] = true
+		w.put(kv.Key, kv.Value)
+	}
+	for key := range w.keys {
+		if !keys[key] {
+			w.del([]byte(key))
+		}
+	}
+	w.keys = keys
+	w.changed(resp.Header.Revision)
+	return resp.Header.Revision, nil
+}
+
+// follow applies changes after rev until ctx is cancelled. Whenever the
+// watch reports an error or its channel closes, it lists the prefix again
+// and watches on from there.
+func (w *prefixWatch) follow(ctx context.Context, client Source, rev int64, logger *slog.Logger) {
+	for {
+		rev = w.watch(ctx, client, rev, logger)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.backoff):
+		}
+
+		logger.Warn(w.name+" watch ended; listing again", "prefix", w.prefix, "revision", rev)
+		next, err := w.list(ctx, client)
+		if err != nil {
+			// Watch on from rev; if it was compacted, this fails at once
+			// and the listing is retried.
+			logger.Error(w.name+" listing failed", "prefix", w.prefix, "error", err)
+			continue
+		}
+		rev = next
+	}
+}
+
+// watch applies events after rev until the watch fails or closes, and
+// returns the last revision applied.
+func (w *prefixWatch) watch(ctx context.Context, client Source, rev int64, logger *slog.Logger) int64 {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for wr := range client.Watch(ctx, w.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1)) {
+		if err := wr.Err(); err != nil {
+			logger.Error(w.name+" watch failed", "error", err)
+			return rev
+		}
+		for _, ev := range wr.Events {
+			if ev.Type == clientv3.EventTypeDelete {
+				delete(w.keys, string(ev.Kv.Key))
+				w.del(ev.Kv.Key)
+				continue
+			}
+			w.keys[string(ev.Kv.Key)] = true
+			w.put(ev.Kv.Key, ev.Kv.Value)
+		}
+		if wr.Header.Revision > rev {
+			rev = wr.Header.Revision
+			w.changed(rev)
+		}
+	}
+	return rev
+}
+
+func (w *prefixWatch) changed(rev int64) {
+	if w.synced != nil {
+		w.synced(rev)
+	}
+}
+
+// untilRefresh is how long the refresh loop may sleep.
+func (e *Engine) untilRefresh() time.Duration {
+	next := e.NextRefresh()
+	if next.IsZero() {
+		return scheduleHorizon
+	}
+	return max(next.Sub(e.now()), 0)
+}
+
+func (e *Engine) apply(key, value []byte, logger *slog.Logger) {
+	var tc TenantConfig
+	if err := json.Unmarshal(value, &tc); err != nil {
+		logger.Warn("Failed to parse tenant config", "key", string(key), "error", err)
+		return
+	}
+	if tc.TenantID == "" {
+		tc.TenantID = strings.TrimPrefix(string(key), TenantPrefix)
+	}
+	if err := e.Set(tc); err != nil {
+		logger.Warn("Rejected tenant policies", "key", string(key), "error", err)
+		return
+	}
+	logger.Debug("Applied tenant policies", "tenant", tc.TenantID, "policies", len(tc.Limits))
+}
+
+func (e *Engine) applyOverride(key, value []byte, logger *slog.Logger) {
+	var o Override
+	if err := json.Unmarshal(value, &o); err != nil {
+		logger.Warn("Failed to parse override", "key", string(key), "error", err)
+		return
+	}
+	if err := e.SetOverride(o); err != nil {
+		logger.Warn("Rejected override", "key", string(key), "error", err)
+		return
+	}
+	logger.Info("Loaded override",
+		"tenant", o.TenantID,
+		"resource", o.Resource,
+		"override", o.ID,
+		"limit", o.Limit,
+		"start", o.Start,
+		"end", o.End,
+		"granted_by", o.GrantedBy,
+	)
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeEtcd serves Get from a map and hands every watch channel to the test.
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Watcher
+
+	mu      sync.Mutex
+	kvs     map[string]string
+	rev     int64
+	watches chan fakeWatch
+}
+
+type fakeWatch struct {
+	prefix string
+	ch     chan clientv3.WatchResponse
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{kvs: make(map[string]string), rev: 1, watches: make(chan fakeWatch, 8)}
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: f.rev}}
+	for k, v := range f.kvs {
+		if strings.HasPrefix(k, key) {
+			resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v)})
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeEtcd) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	ch := make(chan clientv3.WatchResponse, 1)
+	f.watches <- fakeWatch{prefix: key, ch: ch}
+	return ch
+}
+
+// put stores v as JSON and returns the event a watch would report.
+func (f *fakeEtcd) put(t *testing.T, key string, v any) clientv3.WatchResponse {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kvs[key] = string(b)
+	f.rev++
+	return clientv3.WatchResponse{
+		Header: etcdserverpb.ResponseHeader{Revision: f.rev},
+		Events: []*clientv3.Event{{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(key), Value: b}}},
+	}
+}
+
+func (f *fakeEtcd) delete(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.kvs, key)
+	f.rev++
+}
+
+func (f *fakeEtcd) nextWatch(t *testing.T, prefix string) fakeWatch {
+	t.Helper()
+	select {
+	case w := <-f.watches:
+		if w.prefix != prefix {
+			t.Fatalf("watching %s, want %s", w.prefix, prefix)
+		}
+		return w
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s was not watched", prefix)
+		return fakeWatch{}
+	}
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: not before the deadline", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSyncRelistsWhenTheWatchEnds(t *testing.T) {
+	defer func(d time.Duration) { relistBackoff = d }(relistBackoff)
+	relistBackoff = 10 * time.Millisecond
+
+	f := newFakeEtcd()
+	policy := func(tenant, resource string) TenantConfig {
+		return TenantConfig{TenantID: tenant, Limits: map[string]Limit{resource: {Limit: 10, Burst: 10, Window: time.Minute}}}
+	}
+	f.put(t, TenantKey("acme"), policy("acme", "api"))
+	f.put(t, TenantKey("old"), policy("old", "legacy"))
+
+	e := newTestEngine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := e.Sync(ctx, f, slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+		t.Fatal(err)
+	}
+	// The two watches start concurrently.
+	watches := map[string]fakeWatch{}
+	for i := 0; i < 2; i++ {
+		w := <-f.watches
+		watches[w.prefix] = w
+	}
+
+	// Changes made while the tenant watch is down, as after an etcd
+	// restart, are picked up by listing again.
+	f.put(t, TenantKey("beta"), policy("beta", "search"))
+	f.delete(TenantKey("old"))
+	close(watches[TenantPrefix].ch)
+	eventually(t, "relisted tenants", func() bool { return e.HasResource("search") && !e.HasResource("legacy") })
+
+	// And later changes still arrive on the new watch.
+	w := f.nextWatch(t, TenantPrefix)
+	w.ch <- f.put(t, TenantKey("gamma"), policy("gamma", "upload"))
+	eventually(t, "watched tenant", func() bool { return e.HasResource("upload") })
+	eventually(t, "revision", func() bool { return e.Revision() == f.rev })
+
+	// A compacted override watch lists the overrides again too.
+	now := time.Unix(1700000000, 0)
+	f.put(t, OverrideKey("acme", "launch"), Override{
+		ID: "launch", TenantID: "acme", Resource: "api", Limit: 20,
+		Start: now.Add(-time.Minute), End: now.Add(time.Hour), Reason: "launch", GrantedBy: "alice",
+	})
+	watches[OverridePrefix].ch <- clientv3.WatchResponse{CompactRevision: f.rev}
+	eventually(t, "relisted overrides", func() bool {
+		quota, err := e.Quota(ctx, "acme", "api", "k")
+		return err == nil && len(quota) == 1 && quota[0].Override != nil
+	})
+	f.nextWatch(t, OverridePrefix)
+}
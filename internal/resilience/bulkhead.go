@@ -0,0 +1,253 @@
+package resilience
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xizzxy/helios/internal/config"
+)
+
+var (
+	// ErrBulkheadFull is returned when a request would overflow the queue,
+	// or its tenant's share of it.
+	ErrBulkheadFull = errors.New("bulkhead queue is full")
+	// ErrBulkheadTimeout is returned when a queued request waits longer
+	// than the queue timeout.
+	ErrBulkheadTimeout = errors.New("timed out waiting for a bulkhead slot")
+)
+
+// Bulkhead caps concurrent calls. Calls beyond the cap wait in a bounded
+// queue until a slot frees or their wait times out.
+//
+// Without tenant isolation the queue is plain FIFO. With it, each tenant
+// queues separately and freed slots go to the tenant whose head request
+// has the earliest weighted-fair-queuing finish tag, so a tenant's share
+// of the slots under contention follows its weight. A tenant may also hold
+// no more than its weighted share of the queue, so one noisy tenant cannot
+// fill it, and may run no more than the tenant cap times its weight at
+// once, so one tenant's slow calls cannot hold every slot.
+type Bulkhead struct {
+	capacity  int
+	queueSize int
+	tenantCap int // running calls per unit of weight, 0 for no cap
+	timeout   time.Duration
+	isolation bool
+	weights   map[string]float64
+
+	mu          sync.Mutex
+	inUse       int
+	queued      int
+	vtime       float64 // virtual time: finish tag of the last dispatched call
+	seq         uint64  // arrival order, breaks finish tag ties
+	tenants     map[string]*tenantState
+	totalWeight float64 // of the tenants in the map
+
+	rejected uint64
+	timedOut uint64
+}
+
+// tenantState exists while a tenant has calls running or queued.
+type tenantState struct {
+	weight     float64
+	active     int
+	queue      *list.List // of *waiter, FIFO
+	lastFinish float64
+}
+
+type waiter struct {
+	tenant  string
+	finish  float64
+	seq     uint64
+	ready   chan struct{}
+	granted bool
+	elem    *list.Element
+}
+
+// BulkheadStats is a snapshot of a bulkhead.
+type BulkheadStats struct {
+	InUse    int    `json:"in_use"`
+	Queued   int    `json:"queued"`
+	Tenants  int    `json:"tenants"`
+	Rejected uint64 `json:"rejected"`
+	TimedOut uint64 `json:"timed_out"`
+}
+
+func NewBulkhead(cfg config.BulkheadConfig) *Bulkhead {
+	capacity := cfg.MaxConcurrency
+	if capacity <= 0 {
+		capacity = 1000
+	}
+	timeout := cfg.QueueTimeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &Bulkhead{
+		capacity:  capacity,
+		queueSize: max(cfg.QueueSize, 0),
+		tenantCap: max(cfg.TenantMaxConcurrency, 0),
+		timeout:   timeout,
+		isolation: cfg.TenantIsolation,
+		weights:   cfg.TenantWeights,
+		tenants:   make(map[string]*tenantState),
+	}
+}
+
+// Acquire takes a slot for tenant, waiting in the queue if none is free.
+// The returned release must be called once the call finishes.
+func (b *Bulkhead) Acquire(ctx context.Context, tenant string) (release func(), err error) {
+	if !b.isolation {
+		tenant = ""
+	}
+
+	b.mu.Lock()
+	t := b.tenant(tenant)
+	if b.inUse < b.capacity && b.queued == 0 && t.active < b.runShare(t) {
+		b.inUse++
+		t.active++
+		b.mu.Unlock()
+		return b.releaser(tenant), nil
+	}
+	if b.queued >= b.queueSize || t.queue.Len() >= b.queueShare(t) {
+		b.rejected++
+		b.forget(tenant, t)
+		b.mu.Unlock()
+		return nil, ErrBulkheadFull
+	}
+
+	start := max(b.vtime, t.lastFinish)
+	b.seq++
+	w := &waiter{tenant: tenant, finish: start + 1/t.weight, seq: b.seq, ready: make(chan struct{})}
+	t.lastFinish = w.finish
+	w.elem = t.queue.PushBack(w)
+	b.queued++
+	// Slots may be free while every queued call waits on its tenant's cap.
+	b.dispatch()
+	b.mu.Unlock()
+
+	timer := time.NewTimer(b.timeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return b.releaser(tenant), nil
+	case <-timer.C:
+		err = ErrBulkheadTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if w.granted {
+		// Dispatched while timing out; the slot is ours after all.
+		return b.releaser(tenant), nil
+	}
+	t.queue.Remove(w.elem)
+	b.queued--
+	if err == ErrBulkheadTimeout {
+		b.timedOut++
+	}
+	b.forget(tenant, t)
+	return nil, err
+}
+
+// tenant returns the tenant's state, creating it. Callers hold mu.
+func (b *Bulkhead) tenant(name string) *tenantState {
+	if t, ok := b.tenants[name]; ok {
+		return t
+	}
+	weight := 1.0
+	if w, ok := b.weights[name]; ok && w > 0 {
+		weight = w
+	}
+	t := &tenantState{weight: weight, queue: list.New(), lastFinish: b.vtime}
+	b.tenants[name] = t
+	b.totalWeight += weight
+	return t
+}
+
+// forget drops the state of a tenant with nothing running or queued.
+func (b *Bulkhead) forget(name string, t *tenantState) {
+	if t.active == 0 && t.queue.Len() == 0 {
+		delete(b.tenants, name)
+		b.totalWeight -= t.weight
+	}
+}
+
+// queueShare is how many queued calls t may hold: its weighted share of
+// the queue among the tenants currently present, at least one.
+func (b *Bulkhead) queueShare(t *tenantState) int {
+	if !b.isolation {
+		return b.queueSize
+	}
+	return max(1, int(float64(b.queueSize)*t.weight/b.totalWeight))
+}
+
+// runShare is how many calls t may run at once: the tenant cap scaled by
+// its weight, at least one and at most every slot.
+func (b *Bulkhead) runShare(t *tenantState) int {
+	if !b.isolation || b.tenantCap == 0 {
+		return b.capacity
+	}
+	return min(b.capacity, max(1, int(math.Ceil(float64(b.tenantCap)*t.weight))))
+}
+
+func (b *Bulkhead) releaser(tenant string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.release(tenant) })
+	}
+}
+
+func (b *Bulkhead) release(tenant string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inUse--
+	t := b.tenants[tenant]
+	t.active--
+	b.forget(tenant, t)
+	b.dispatch()
+}
+
+// dispatch hands free slots to queued calls, earliest finish tag first,
+// skipping tenants at their running cap. Callers hold mu.
+func (b *Bulkhead) dispatch() {
+	for b.inUse < b.capacity && b.queued > 0 {
+		var next *waiter
+		var nextTenant *tenantState
+		for _, t := range b.tenants {
+			if t.queue.Len() == 0 || t.active >= b.runShare(t) {
+				continue
+			}
+			head := t.queue.Front().Value.(*waiter)
+			if next == nil || head.finish < next.finish || (head.finish == next.finish && head.seq < next.seq) {
+				next, nextTenant = head, t
+			}
+		}
+		if next == nil {
+			return
+		}
+		nextTenant.queue.Remove(next.elem)
+		b.queued--
+		b.inUse++
+		nextTenant.active++
+		b.vtime = next.finish
+		next.granted = true
+		close(next.ready)
+	}
+}
+
+func (b *Bulkhead) Stats() BulkheadStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BulkheadStats{
+		InUse:    b.inUse,
+		Queued:   b.queued,
+		Tenants:  len(b.tenants),
+		Rejected: b.rejected,
+		TimedOut: b.timedOut,
+	}
+}
@@ -0,0 +1,169 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/config"
+)
+
+// queueUp starts Acquire calls in order, waiting for each to be queued.
+// The returned function waits for them all and lists tenants in the order
+// they were granted a slot.
+func queueUp(t *testing.T, b *Bulkhead, tenants []string) func() []string {
+	t.Helper()
+	out := make(chan string, len(tenants))
+	var wg sync.WaitGroup
+	for _, tenant := range tenants {
+		wg.Add(1)
+		before := b.Stats().Queued
+		go func(tenant string) {
+			defer wg.Done()
+			release, err := b.Acquire(context.Background(), tenant)
+			if err != nil {
+				t.Errorf("%s: %v", tenant, err)
+				return
+			}
+			out <- tenant
+			release()
+		}(tenant)
+		for b.Stats().Queued == before {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	return func() []string {
+		wg.Wait()
+		close(out)
+		var order []string
+		for tenant := range out {
+			order = append(order, tenant)
+		}
+		return order
+	}
+}
+
+func TestBulkheadFIFO(t *testing.T) {
+	b := NewBulkhead(config.BulkheadConfig{MaxConcurrency: 1, QueueSize: 10, QueueTimeout: time.Minute})
+	release, err := b.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	granted := queueUp(t, b, []string{"noisy", "noisy", "quiet"})
+	release()
+	if got := granted(); !equal(got, []string{"noisy", "noisy", "quiet"}) {
+		t.Errorf("order = %v, want arrival order", got)
+	}
+}
+
+func TestBulkheadWeightedFairQueuing(t *testing.T) {
+	b := NewBulkhead(config.BulkheadConfig{
+		MaxConcurrency:  1,
+		QueueSize:       100,
+		QueueTimeout:    time.Minute,
+		TenantIsolation: true,
+		TenantWeights:   map[string]float64{"gold": 2},
+	})
+	release, err := b.Acquire(context.Background(), "noisy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// noisy queues first, but the others still get turns in proportion to
+	// their weights instead of waiting behind all of it.
+	// Finish tags: noisy 1,2,3,4; quiet 1,2; gold 0.5,1. Ties go to the
+	// earlier arrival.
+	granted := queueUp(t, b, []string{"noisy", "noisy", "noisy", "noisy", "quiet", "quiet", "gold", "gold"})
+	release()
+	want := []string{"gold", "noisy", "quiet", "gold", "noisy", "quiet", "noisy", "noisy"}
+	if got := granted(); !equal(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestBulkheadTenantQueueShare(t *testing.T) {
+	b := NewBulkhead(config.BulkheadConfig{MaxConcurrency: 1, QueueSize: 4, QueueTimeout: time.Minute, TenantIsolation: true})
+	release, err := b.Acquire(context.Background(), "quiet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two tenants present: noisy may hold half of the queue.
+	granted := queueUp(t, b, []string{"noisy", "noisy"})
+	if _, err := b.Acquire(context.Background(), "noisy"); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("third queued noisy request: err = %v, want ErrBulkheadFull", err)
+	}
+	release()
+	granted()
+	if st := b.Stats(); st.Rejected != 1 || st.InUse != 0 || st.Tenants != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestBulkheadTenantRunCap(t *testing.T) {
+	b := NewBulkhead(config.BulkheadConfig{
+		MaxConcurrency:       4,
+		QueueSize:            10,
+		QueueTimeout:         time.Minute,
+		TenantIsolation:      true,
+		TenantWeights:        map[string]float64{"gold": 2},
+		TenantMaxConcurrency: 1,
+	})
+	acquire := func(tenant string) func() {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		release, err := b.Acquire(ctx, tenant)
+		if err != nil {
+			t.Fatalf("%s: %v, want a free slot", tenant, err)
+		}
+		return release
+	}
+
+	release := acquire("noisy")
+	// noisy is at its cap, so its next call queues although slots are free.
+	granted := queueUp(t, b, []string{"noisy"})
+	if st := b.Stats(); st.InUse != 1 || st.Queued != 1 {
+		t.Errorf("stats = %+v, want one running and one queued", st)
+	}
+
+	// Other tenants still get the free slots, gold twice for its weight.
+	for _, tenant := range []string{"quiet", "gold", "gold"} {
+		defer acquire(tenant)()
+	}
+	if st := b.Stats(); st.InUse != 4 || st.Queued != 1 {
+		t.Errorf("stats = %+v, want every slot running and noisy still queued", st)
+	}
+
+	release()
+	if got := granted(); !equal(got, []string{"noisy"}) {
+		t.Errorf("granted = %v, want the queued noisy call once noisy's slot freed", got)
+	}
+}
+
+func TestBulkheadQueueTimeout(t *testing.T) {
+	b := NewBulkhead(config.BulkheadConfig{MaxConcurrency: 1, QueueSize: 1, QueueTimeout: 10 * time.Millisecond})
+	release, err := b.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if _, err := b.Acquire(context.Background(), "b"); !errors.Is(err, ErrBulkheadTimeout) {
+		t.Errorf("err = %v, want ErrBulkheadTimeout", err)
+	}
+	if st := b.Stats(); st.Queued != 0 || st.TimedOut != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+	"github.com/xizzxy/helios/internal/config"
+)
+
+// ErrCircuitOpen is returned by Execute while the breaker rejects calls.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half_open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker opens after FailureThreshold consecutive failures, rejects
+// calls for TimeoutDuration, then lets up to MaxConcurrentRequest probes
+// through. A successful probe closes it again; a failed one re-opens it.
+// Calls the caller cancelled count as neither.
+type CircuitBreaker struct {
+	clock       clock.Clock
+	threshold   int
+	timeout     time.Duration
+	maxProbes   int
+	mu          sync.Mutex
+	state       State
+	failures    int
+	openedAt    time.Time
+	probes      int
+	transitions uint64
+}
+
+func NewCircuitBreaker(cfg config.CircuitBreakerConfig) *CircuitBreaker {
+	threshold := cfg.FailureThreshold
+	if threshold <= 0 {
+		threshold = 10
+	}
+	timeout := cfg.TimeoutDuration
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	maxProbes := cfg.MaxConcurrentRequest
+	if maxProbes <= 0 {
+		maxProbes = 1
+	}
+
+	return &CircuitBreaker{
+		threshold: threshold,
+		timeout:   timeout,
+		maxProbes: maxProbes,
+	}
+}
+
+// Execute runs fn if the breaker admits the call and records its outcome.
+// context.Canceled says nothing about the backend, so it is not recorded.
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	if err := cb.before(); err != nil {
+		return err
+	}
+	err := fn()
+	if errors.Is(err, context.Canceled) {
+		cb.release()
+	} else {
+		cb.after(err)
+	}
+	return err
+}
+
+// State reports the current state, moving open to half-open once the
+// timeout has elapsed.
+func (cb *CircuitBreaker) State() State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.advance(cb.now())
+	return cb.state
+}
+
+// Transitions returns how many times the breaker has changed state.
+func (cb *CircuitBreaker) Transitions() uint64 {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.transitions
+}
+
+func (cb *CircuitBreaker) before() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.advance(cb.now())
+	switch cb.state {
+	case StateOpen:
+		return ErrCircuitOpen
+	case StateHalfOpen:
+		if cb.probes >= cb.maxProbes {
+			return ErrCircuitOpen
+		}
+		cb.probes++
+	}
+	return nil
+}
+
+// release frees a half-open probe without deciding anything.
+func (cb *CircuitBreaker) release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == StateHalfOpen && cb.probes > 0 {
+		cb.probes--
+	}
+}
+
+func (cb *CircuitBreaker) after(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == StateHalfOpen {
+		if cb.probes > 0 {
+			cb.probes--
+		}
+		if err != nil {
+			cb.setState(StateOpen, cb.now())
+		} else {
+			cb.setState(StateClosed, cb.now())
+		}
+		return
+	}
+
+	if err == nil {
+		cb.failures = 0
+		return
+	}
+	cb.failures++
+	if cb.state == StateClosed && cb.failures >= cb.threshold {
+		cb.setState(StateOpen, cb.now())
+	}
+}
+
+func (cb *CircuitBreaker) now() time.Time {
+	return clock.Or(cb.clock).Now()
+}
+
+func (cb *CircuitBreaker) advance(now time.Time) {
+	if cb.state == StateOpen && now.Sub(cb.openedAt) >= cb.timeout {
+		cb.setState(StateHalfOpen, now)
+	}
+}
+
+func (cb *CircuitBreaker) setState(state State, now time.Time) {
+	if cb.state == state {
+		return
+	}
+	cb.state = state
+	cb.failures = 0
+	cb.probes = 0
+	cb.transitions++
+	if state == StateOpen {
+		cb.openedAt = now
+	}
+}
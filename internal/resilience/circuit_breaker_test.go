@@ -0,0 +1,126 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+	"github.com/xizzxy/helios/internal/config"
+)
+
+func newTestBreaker(threshold, probes int) (*CircuitBreaker, *clock.Manual) {
+	clk := clock.NewManual(time.Unix(1700000000, 0))
+	cb := NewCircuitBreaker(config.CircuitBreakerConfig{
+		FailureThreshold:     threshold,
+		TimeoutDuration:      10 * time.Second,
+		MaxConcurrentRequest: probes,
+	})
+	cb.clock = clk
+	return cb, clk
+}
+
+// call is one step of a breaker scenario: advance the clock, run a call
+// that returns err, and check what Execute returned and the state after.
+type call struct {
+	advance time.Duration
+	err     error
+	want    error
+	state   State
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		calls []call
+	}{
+		{"opens after consecutive failures", []call{
+			{err: errFlaky, want: errFlaky, state: StateClosed},
+			{err: errFlaky, want: errFlaky, state: StateClosed},
+			{err: errFlaky, want: errFlaky, state: StateOpen},
+			{want: ErrCircuitOpen, state: StateOpen},
+		}},
+		{"a success resets the count", []call{
+			{err: errFlaky, want: errFlaky, state: StateClosed},
+			{err: errFlaky, want: errFlaky, state: StateClosed},
+			{state: StateClosed},
+			{err: errFlaky, want: errFlaky, state: StateClosed},
+			{err: errFlaky, want: errFlaky, state: StateClosed},
+		}},
+		{"a successful probe closes it", []call{
+			{err: errFlaky, want: errFlaky},
+			{err: errFlaky, want: errFlaky},
+			{err: errFlaky, want: errFlaky, state: StateOpen},
+			{advance: 9 * time.Second, want: ErrCircuitOpen, state: StateOpen},
+			{advance: time.Second, state: StateClosed},
+			{err: errFlaky, want: errFlaky, state: StateClosed},
+		}},
+		{"a failed probe reopens it", []call{
+			{err: errFlaky, want: errFlaky},
+			{err: errFlaky, want: errFlaky},
+			{err: errFlaky, want: errFlaky, state: StateOpen},
+			{advance: 10 * time.Second, err: errFlaky, want: errFlaky, state: StateOpen},
+			{advance: 9 * time.Second, want: ErrCircuitOpen, state: StateOpen},
+		}},
+		{"cancellation is not a failure", []call{
+			{err: errFlaky, want: errFlaky},
+			{err: errFlaky, want: errFlaky},
+			{err: context.Canceled, want: context.Canceled, state: StateClosed},
+			{err: errFlaky, want: errFlaky, state: StateOpen},
+			{advance: 10 * time.Second, err: context.Canceled, want: context.Canceled, state: StateHalfOpen},
+			{state: StateClosed},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cb, clk := newTestBreaker(3, 1)
+			for i, c := range tc.calls {
+				clk.Advance(c.advance)
+				err := cb.Execute(func() error { return c.err })
+				if !errors.Is(err, c.want) || (c.want == nil && err != nil) {
+					t.Fatalf("call %d: err = %v, want %v", i, err, c.want)
+				}
+				if got := cb.State(); got != c.state {
+					t.Fatalf("call %d: state = %s, want %s", i, got, c.state)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerLimitsHalfOpenProbes(t *testing.T) {
+	cb, clk := newTestBreaker(1, 2)
+	cb.Execute(func() error { return errFlaky })
+	clk.Advance(10 * time.Second)
+
+	// Two probes may be in flight; a third is rejected until one returns.
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- cb.Execute(func() error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+	}
+	<-started
+	<-started
+	if err := cb.Execute(func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("third probe: err = %v, want ErrCircuitOpen", err)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("probe: %v", err)
+		}
+	}
+	if cb.State() != StateClosed {
+		t.Errorf("state = %s after successful probes, want closed", cb.State())
+	}
+	if cb.Transitions() != 3 {
+		t.Errorf("transitions = %d, want 3", cb.Transitions())
+	}
+}
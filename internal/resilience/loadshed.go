@@ -0,0 +1,261 @@
+package resilience
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/xizzxy/helios/internal/config"
+)
+
+// Priority orders requests for load shedding and reserved policy
+// capacity; lower priorities are shed first.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityCritical // never shed
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// ParsePriority parses "low", "normal" or "critical".
+func ParsePriority(s string) (Priority, error) {
+	for p := PriorityLow; p <= PriorityCritical; p++ {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority %q", s)
+}
+
+// Shedding levels. A request is shed when its priority is below the level.
+const (
+	ShedNone   = 0 // admit everything
+	ShedLow    = 1 // shed low priority requests
+	ShedNormal = 2 // admit only critical requests
+)
+
+const (
+	// severePressure is the pressure at which normal traffic is shed too.
+	severePressure = 1.25
+	// exitRatio is the hysteresis band: a level is left only once pressure
+	// falls below this fraction of the pressure that entered it.
+	exitRatio = 0.9
+	// latencySamples bounds the latencies kept per sampling interval.
+	latencySamples = 4096
+)
+
+// LoadSignals is one sample of the overload signals. Pressure is the
+// highest signal relative to its threshold; 1 means a threshold is reached.
+type LoadSignals struct {
+	CPU      float64       `json:"cpu"`    // fraction of GOMAXPROCS
+	Memory   float64       `json:"memory"` // heap as a fraction of the memory limit
+	InFlight int64         `json:"in_flight"`
+	P99      time.Duration `json:"p99_latency"`
+	Pressure float64       `json:"pressure"`
+}
+
+// LoadShedder admits requests while the process keeps up and sheds the
+// lowest priorities first once CPU, heap, in-flight requests or p99
+// latency cross their thresholds. Levels rise as soon as pressure does but
+// only step down after Cooldown, once pressure is back under the
+// hysteresis band, so shedding does not flap.
+type LoadShedder struct {
+	cfg      config.LoadSheddingConfig
+	cooldown time.Duration
+	memLimit uint64
+	cpu      cpuSampler
+
+	inFlight atomic.Int64
+	latency  latencyWindow
+
+	level       atomic.Int32
+	changed     time.Time // last level change; sampling goroutine only
+	signals     atomic.Pointer[LoadSignals]
+	shed        [PriorityCritical]atomic.Uint64
+	transitions atomic.Uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewLoadShedder starts sampling the process every SampleInterval.
+func NewLoadShedder(cfg config.LoadSheddingConfig) *LoadShedder {
+	interval := cfg.SampleInterval
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	cooldown := cfg.Cooldown
+	if cooldown <= 0 {
+		cooldown = 5 * time.Second
+	}
+	l := &LoadShedder{
+		cfg:      cfg,
+		cooldown: cooldown,
+		memLimit: memoryLimit(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	l.signals.Store(&LoadSignals{})
+	go l.run(interval)
+	return l
+}
+
+// Admit reports whether a request of priority p may proceed. Admitted
+// requests must call done with their latency when they finish.
+func (l *LoadShedder) Admit(p Priority) (done func(time.Duration), ok bool) {
+	if p >= PriorityCritical {
+		return func(time.Duration) {}, true
+	}
+	if int32(p) < l.level.Load() {
+		l.shed[p].Add(1)
+		return nil, false
+	}
+	l.inFlight.Add(1)
+	return func(d time.Duration) {
+		l.inFlight.Add(-1)
+		l.latency.record(d)
+	}, true
+}
+
+// RetryAfter is the delay suggested to shed clients, in whole seconds.
+func (l *LoadShedder) RetryAfter() int {
+	return int(math.Ceil(l.cooldown.Seconds()))
+}
+
+// Level returns the current shedding level.
+func (l *LoadShedder) Level() int { return int(l.level.Load()) }
+
+// Signals returns the latest sample.
+func (l *LoadShedder) Signals() LoadSignals { return *l.signals.Load() }
+
+// Shed returns how many requests of priority p were rejected.
+func (l *LoadShedder) Shed(p Priority) uint64 {
+	if p < 0 || p >= PriorityCritical {
+		return 0
+	}
+	return l.shed[p].Load()
+}
+
+// Transitions returns how many times the level has changed.
+func (l *LoadShedder) Transitions() uint64 { return l.transitions.Load() }
+
+func (l *LoadShedder) run(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			l.update(l.sample(now), now)
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+func (l *LoadShedder) sample(now time.Time) LoadSignals {
+	sig := LoadSignals{
+		CPU:      l.cpu.sample(now),
+		InFlight: l.inFlight.Load(),
+		P99:      l.latency.p99(),
+	}
+	if l.memLimit > 0 {
+		sig.Memory = float64(heapBytes()) / float64(l.memLimit)
+	}
+	return sig
+}
+
+// update computes the pressure of sig and moves the level.
+func (l *LoadShedder) update(sig LoadSignals, now time.Time) {
+	ratio := func(v, threshold float64) float64 {
+		if threshold <= 0 {
+			return 0
+		}
+		return v / threshold
+	}
+	sig.Pressure = max(
+		ratio(sig.CPU, l.cfg.CPUThreshold),
+		ratio(sig.Memory, l.cfg.MemoryThreshold),
+		ratio(float64(sig.InFlight), float64(l.cfg.QueueLengthThreshold)),
+		ratio(float64(sig.P99), float64(l.cfg.LatencyThreshold)),
+	)
+	l.signals.Store(&sig)
+
+	target := int32(ShedNone)
+	switch {
+	case sig.Pressure >= severePressure:
+		target = ShedNormal
+	case sig.Pressure >= 1:
+		target = ShedLow
+	}
+
+	level := l.level.Load()
+	entry := [...]float64{0, 1, severePressure}
+	switch {
+	case target > level:
+		l.setLevel(target, now)
+	case target < level && sig.Pressure < entry[level]*exitRatio && now.Sub(l.changed) >= l.cooldown:
+		l.setLevel(level-1, now)
+	}
+}
+
+func (l *LoadShedder) setLevel(level int32, now time.Time) {
+	l.level.Store(level)
+	l.changed = now
+	l.transitions.Add(1)
+}
+
+// Close stops sampling.
+func (l *LoadShedder) Close() {
+	close(l.stop)
+	<-l.done
+}
+
+// latencyWindow keeps the most recent request latencies in a ring that
+// writers fill without locking.
+type latencyWindow struct {
+	ring    [latencySamples]atomic.Int64
+	written atomic.Uint64
+	read    uint64 // written count at the last p99; sampling goroutine only
+}
+
+func (w *latencyWindow) record(d time.Duration) {
+	i := w.written.Add(1) - 1
+	w.ring[i%latencySamples].Store(int64(d))
+}
+
+// p99 returns the 99th percentile of the latencies recorded since the
+// previous call, or 0 when there were none.
+func (w *latencyWindow) p99() time.Duration {
+	end := w.written.Load()
+	n := end - w.read
+	w.read = end
+	if n == 0 {
+		return 0
+	}
+	if n > latencySamples {
+		n = latencySamples
+	}
+	samples := make([]int64, n)
+	for i := uint64(0); i < n; i++ {
+		samples[i] = w.ring[(end-n+i)%latencySamples].Load()
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return time.Duration(samples[(len(samples)*99)/100])
+}
@@ -0,0 +1,94 @@
+package resilience
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/config"
+)
+
+func newTestShedder(t *testing.T) *LoadShedder {
+	t.Helper()
+	// Sampling is driven by hand through update.
+	l := NewLoadShedder(config.LoadSheddingConfig{
+		Enabled:              true,
+		CPUThreshold:         0.8,
+		LatencyThreshold:     100 * time.Millisecond,
+		QueueLengthThreshold: 100,
+		SampleInterval:       time.Hour,
+		Cooldown:             5 * time.Second,
+	})
+	t.Cleanup(l.Close)
+	return l
+}
+
+func admitted(l *LoadShedder, p Priority) bool {
+	done, ok := l.Admit(p)
+	if ok {
+		done(0)
+	}
+	return ok
+}
+
+func TestLoadShedderShedsByPriority(t *testing.T) {
+	l := newTestShedder(t)
+	now := time.Unix(1000, 0)
+
+	l.update(LoadSignals{CPU: 0.85}, now) // pressure 1.06
+	if l.Level() != ShedLow {
+		t.Fatalf("level = %d, want %d", l.Level(), ShedLow)
+	}
+	if admitted(l, PriorityLow) || !admitted(l, PriorityNormal) {
+		t.Error("want low shed and normal admitted")
+	}
+
+	l.update(LoadSignals{InFlight: 150}, now) // pressure 1.5
+	if admitted(l, PriorityNormal) || !admitted(l, PriorityCritical) {
+		t.Error("want normal shed and critical admitted")
+	}
+	if l.Shed(PriorityLow) != 1 || l.Shed(PriorityNormal) != 1 {
+		t.Errorf("shed counts = %d low, %d normal", l.Shed(PriorityLow), l.Shed(PriorityNormal))
+	}
+}
+
+func TestLoadShedderHysteresis(t *testing.T) {
+	l := newTestShedder(t)
+	now := time.Unix(1000, 0)
+
+	l.update(LoadSignals{P99: 110 * time.Millisecond}, now)
+	if l.Level() != ShedLow {
+		t.Fatalf("level = %d, want %d", l.Level(), ShedLow)
+	}
+
+	// Just under the threshold is inside the hysteresis band.
+	l.update(LoadSignals{P99: 95 * time.Millisecond}, now.Add(10*time.Second))
+	if l.Level() != ShedLow {
+		t.Errorf("left shedding inside the hysteresis band")
+	}
+	// Well under, but before the cooldown has passed.
+	l.update(LoadSignals{P99: 10 * time.Millisecond}, now.Add(time.Second))
+	if l.Level() != ShedLow {
+		t.Errorf("left shedding before the cooldown")
+	}
+	l.update(LoadSignals{P99: 10 * time.Millisecond}, now.Add(6*time.Second))
+	if l.Level() != ShedNone {
+		t.Errorf("level = %d after recovery, want %d", l.Level(), ShedNone)
+	}
+	if l.Transitions() != 2 {
+		t.Errorf("transitions = %d, want 2", l.Transitions())
+	}
+}
+
+func TestLatencyWindowP99(t *testing.T) {
+	var w latencyWindow
+	for i := 1; i <= 1000; i++ {
+		w.record(time.Duration(i) * time.Millisecond)
+	}
+	if got := w.p99(); got != 991*time.Millisecond {
+		t.Errorf("p99 = %v, want 991ms", got)
+	}
+	// Only latencies since the previous call count.
+	if got := w.p99(); got != 0 {
+		t.Errorf("p99 of an empty interval = %v, want 0", got)
+	}
+}
@@ -0,0 +1,108 @@
+package resilience
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc. It is 100 on
+// every mainstream Linux platform.
+const clockTicks = 100
+
+// cpuSampler measures the process's CPU use from /proc/self/stat as a
+// fraction of the CPUs Go may run on.
+type cpuSampler struct {
+	lastCPU  time.Duration
+	lastWall time.Time
+}
+
+// sample returns the CPU fraction used since the previous call, or 0 where
+// /proc is unavailable.
+func (s *cpuSampler) sample(now time.Time) float64 {
+	cpu, ok := processCPU()
+	if !ok {
+		return 0
+	}
+	defer func() { s.lastCPU, s.lastWall = cpu, now }()
+	if s.lastWall.IsZero() {
+		return 0
+	}
+	wall := now.Sub(s.lastWall)
+	if wall <= 0 {
+		return 0
+	}
+	return float64(cpu-s.lastCPU) / float64(wall) / float64(runtime.GOMAXPROCS(0))
+}
+
+// processCPU reads utime+stime from /proc/self/stat.
+func processCPU() (time.Duration, bool) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, false
+	}
+	// The command name may contain spaces; fields resume after its ')'.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, false
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	// fields[0] is field 3 (state); utime and stime are fields 14 and 15.
+	if len(fields) < 13 {
+		return 0, false
+	}
+	utime, err1 := strconv.ParseInt(fields[11], 10, 64)
+	stime, err2 := strconv.ParseInt(fields[12], 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicks, true
+}
+
+var heapSample = []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+
+// heapBytes is the memory held by live and not yet swept heap objects.
+func heapBytes() uint64 {
+	metrics.Read(heapSample)
+	if heapSample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return heapSample[0].Value.Uint64()
+}
+
+// memoryLimit is what heap usage is measured against: GOMEMLIMIT when set,
+// else the cgroup v2 limit, else the machine's memory. It returns 0 when
+// none is known.
+func memoryLimit() uint64 {
+	if limit := debug.SetMemoryLimit(-1); limit > 0 && limit < math.MaxInt64 {
+		return uint64(limit)
+	}
+	if data, err := os.ReadFile("/sys/fs/cgroup/memory.max"); err == nil {
+		if n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			return n
+		}
+	}
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err == nil {
+				return kb << 10
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package resilience
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/xizzxy/helios/internal/config"
+)
+
+// Retryability says whether a failed call may be sent again. Every call
+// that goes through a RetryPolicy declares one.
+type Retryability int
+
+const (
+	// NotRetryable calls are never sent twice.
+	NotRetryable Retryability = iota
+	// RetryIfUnsent calls change state, so they are retried only when the
+	// error proves the first attempt never reached the server.
+	RetryIfUnsent
+	// Idempotent calls may be retried on any transient error.
+	Idempotent
+)
+
+// RetryPolicy retries failed calls with capped exponential backoff and full
+// jitter: the wait before retry n is uniform in [0, min(MaxInterval,
+// InitialInterval*Multiplier^n)). It never waits past the caller's
+// deadline, so retries spend what is left of the request's time budget
+// and no more.
+type RetryPolicy struct {
+	maxRetries int
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+}
+
+// NewRetryPolicy returns a policy for cfg, or nil when retries are
+// disabled. A nil policy runs each call once.
+func NewRetryPolicy(cfg config.RetryConfig) *RetryPolicy {
+	if !cfg.Enabled || cfg.MaxRetries <= 0 {
+		return nil
+	}
+	p := &RetryPolicy{
+		maxRetries: cfg.MaxRetries,
+		initial:    cfg.InitialInterval,
+		max:        cfg.MaxInterval,
+		multiplier: cfg.Multiplier,
+	}
+	if p.initial <= 0 {
+		p.initial = 100 * time.Millisecond
+	}
+	if p.max < p.initial {
+		p.max = p.initial
+	}
+	if p.multiplier < 1 {
+		p.multiplier = 2
+	}
+	return p
+}
+
+// Do calls fn until it succeeds or retryable reports its error as final,
+// the retries run out, or the next wait would not end before ctx's
+// deadline. onRetry, if not nil, is called before each retry. Do returns
+// the last error.
+func (p *RetryPolicy) Do(ctx context.Context, retryable func(error) bool, onRetry func(), fn func() error) error {
+	err := fn()
+	if p == nil {
+		return err
+	}
+	for n := 0; n < p.maxRetries && err != nil && retryable(err); n++ {
+		wait := p.backoff(n)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		if onRetry != nil {
+			onRetry()
+		}
+		err = fn()
+	}
+	return err
+}
+
+// backoff is the jittered wait before retry n, counting from zero.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	ceiling := float64(p.initial) * math.Pow(p.multiplier, float64(n))
+	if ceiling > float64(p.max) {
+		ceiling = float64(p.max)
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
@@ -0,0 +1,90 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/config"
+)
+
+var errFlaky = errors.New("flaky")
+
+func always(error) bool { return true }
+
+func TestRetryPolicyBackoffBounds(t *testing.T) {
+	p := NewRetryPolicy(config.RetryConfig{
+		Enabled:         true,
+		MaxRetries:      10,
+		InitialInterval: 10 * time.Millisecond,
+		MaxInterval:     50 * time.Millisecond,
+		Multiplier:      2,
+	})
+	ceilings := []time.Duration{10, 20, 40, 50, 50}
+	for n, ceiling := range ceilings {
+		for i := 0; i < 100; i++ {
+			if d := p.backoff(n); d < 0 || d >= ceiling*time.Millisecond {
+				t.Fatalf("backoff(%d) = %v, want in [0, %v)", n, d, ceiling*time.Millisecond)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyRetriesUntilSuccess(t *testing.T) {
+	p := NewRetryPolicy(config.RetryConfig{Enabled: true, MaxRetries: 3, InitialInterval: time.Millisecond})
+	calls, retries := 0, 0
+	err := p.Do(context.Background(), always, func() { retries++ }, func() error {
+		calls++
+		if calls < 3 {
+			return errFlaky
+		}
+		return nil
+	})
+	if err != nil || calls != 3 || retries != 2 {
+		t.Errorf("err = %v, calls = %d, retries = %d", err, calls, retries)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), always, nil, func() error { calls++; return errFlaky })
+	if !errors.Is(err, errFlaky) || calls != 4 {
+		t.Errorf("exhausted: err = %v, calls = %d, want 4", err, calls)
+	}
+}
+
+func TestRetryPolicyHonoursClassification(t *testing.T) {
+	p := NewRetryPolicy(config.RetryConfig{Enabled: true, MaxRetries: 3, InitialInterval: time.Millisecond})
+	calls := 0
+	p.Do(context.Background(), func(error) bool { return false }, nil, func() error { calls++; return errFlaky })
+	if calls != 1 {
+		t.Errorf("calls = %d, want a final error not to be retried", calls)
+	}
+
+	var nilPolicy *RetryPolicy
+	calls = 0
+	nilPolicy.Do(context.Background(), always, nil, func() error { calls++; return errFlaky })
+	if calls != 1 {
+		t.Errorf("nil policy made %d calls, want 1", calls)
+	}
+}
+
+func TestRetryPolicyStaysWithinDeadline(t *testing.T) {
+	p := NewRetryPolicy(config.RetryConfig{
+		Enabled:         true,
+		MaxRetries:      100,
+		InitialInterval: 20 * time.Millisecond,
+		MaxInterval:     time.Second,
+		Multiplier:      2,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	err := p.Do(ctx, always, nil, func() error { return errFlaky })
+	if !errors.Is(err, errFlaky) {
+		t.Errorf("err = %v, want the last call's error", err)
+	}
+	if over := time.Since(deadline); over > 0 {
+		t.Errorf("returned %v after the deadline", over)
+	}
+}
@@ -0,0 +1,287 @@
+// Package sim replays recorded traffic through a limiter configuration on a
+// virtual clock, to show what a policy change would have done to real
+// requests before it is rolled out.
+package sim
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+	"github.com/xizzxy/helios/internal/limiter"
+)
+
+// Policy is a named limiter configuration to evaluate.
+type Policy struct {
+	Name   string
+	Config limiter.Config
+}
+
+// ParsePolicy reads "algorithm[,limit=N][,burst=N][,window=D][,name=S]",
+// e.g. "token_bucket,limit=100,burst=200,window=1m".
+func ParsePolicy(spec string) (Policy, error) {
+	parts := strings.Split(spec, ",")
+	p := Policy{
+		Name: spec,
+		Config: limiter.Config{
+			Algorithm: limiter.Algorithm(strings.TrimSpace(parts[0])),
+			Limit:     100,
+			Window:    time.Minute,
+		},
+	}
+	switch p.Config.Algorithm {
+	case limiter.AlgoTokenBucket, limiter.AlgoSlidingWindow:
+	default:
+		return Policy{}, fmt.Errorf("policy %q: unknown algorithm %q", spec, parts[0])
+	}
+
+	for _, part := range parts[1:] {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return Policy{}, fmt.Errorf("policy %q: expected key=value, got %q", spec, part)
+		}
+		var err error
+		switch k {
+		case "limit":
+			p.Config.Limit, err = strconv.ParseInt(v, 10, 64)
+		case "burst":
+			p.Config.Burst, err = strconv.ParseInt(v, 10, 64)
+		case "window":
+			p.Config.Window, err = time.ParseDuration(v)
+		case "name":
+			p.Name = v
+		default:
+			err = fmt.Errorf("unknown setting %q", k)
+		}
+		if err != nil {
+			return Policy{}, fmt.Errorf("policy %q: %s: %w", spec, k, err)
+		}
+	}
+	return p, nil
+}
+
+// Options control how denied requests behave.
+type Options struct {
+	// Retry makes denied clients come back at the reported ResetTime, as a
+	// well-behaved client honouring Retry-After would.
+	Retry bool
+	// MaxWait is how long after its original timestamp a client keeps
+	// retrying before giving up.
+	MaxWait time.Duration
+}
+
+// Run replays reqs through a fresh limiter built from p, in timestamp
+// order; requests with equal timestamps keep their order in reqs. The
+// limiter reads time from a manual clock set to each event, so the replay
+// runs as fast as the limiter can decide.
+func Run(ctx context.Context, reqs []Request, p Policy, opts Options) (*Report, error) {
+	report := newReport(p.Name)
+	if len(reqs) == 0 {
+		return report, nil
+	}
+
+	events := make(attemptQueue, 0, len(reqs))
+	for i := range reqs {
+		events = append(events, attempt{at: reqs[i].Timestamp, req: i, seq: i})
+	}
+	heap.Init(&events)
+	seq := len(reqs)
+
+	clk := clock.NewManual(events[0].at)
+	cfg := p.Config
+	cfg.Clock = clk
+	mgr := limiter.NewLocalManager(cfg)
+
+	for events.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		a := heap.Pop(&events).(attempt)
+		req := reqs[a.req]
+		clk.Set(a.at)
+
+		res, err := mgr.ForTenant(req.Tenant).Allow(ctx, req.LimiterKey(), req.Cost)
+		if err != nil {
+			return nil, fmt.Errorf("allow %s at %s: %w", req.LimiterKey(), a.at.Format(time.RFC3339Nano), err)
+		}
+
+		first := a.retries == 0
+		if first {
+			report.observe(req, res.Allowed)
+		} else {
+			report.Retries++
+		}
+
+		if res.Allowed {
+			report.admit(a.at.Sub(req.Timestamp))
+			continue
+		}
+		// A reset that is not in the future means the cost can never fit.
+		if !opts.Retry || !res.ResetTime.After(a.at) || res.ResetTime.Sub(req.Timestamp) > opts.MaxWait {
+			report.Dropped++
+			continue
+		}
+		heap.Push(&events, attempt{at: res.ResetTime, req: a.req, seq: seq, retries: a.retries + 1})
+		seq++
+	}
+
+	report.finish()
+	return report, nil
+}
+
+// attempt is one try of a request; retries are rescheduled attempts.
+type attempt struct {
+	at      time.Time
+	req     int
+	seq     int // breaks ties so replays are deterministic
+	retries int
+}
+
+type attemptQueue []attempt
+
+func (q attemptQueue) Len() int { return len(q) }
+func (q attemptQueue) Less(i, j int) bool {
+	if !q[i].at.Equal(q[j].at) {
+		return q[i].at.Before(q[j].at)
+	}
+	return q[i].seq < q[j].seq
+}
+func (q attemptQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *attemptQueue) Push(x any)   { *q = append(*q, x.(attempt)) }
+func (q *attemptQueue) Pop() any {
+	old := *q
+	a := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return a
+}
+
+// Counts are first-attempt decisions.
+type Counts struct {
+	Requests int64 `json:"requests"`
+	Allowed  int64 `json:"allowed"`
+	Denied   int64 `json:"denied"`
+}
+
+// Report summarises one policy's replay.
+type Report struct {
+	Policy string `json:"policy"`
+	Counts
+	Tenants map[string]*Counts `json:"tenants"`
+
+	// Denial bursts are runs of consecutive first-attempt denials on one
+	// limiter key.
+	Bursts          int64         `json:"denial_bursts"`
+	MaxBurst        int64         `json:"max_burst"`
+	LongestBurst    time.Duration `json:"longest_burst_ns"`
+	Retries         int64         `json:"retries"`
+	Dropped         int64         `json:"dropped"`
+	AdmissionP50    time.Duration `json:"admission_p50_ns"`
+	AdmissionP90    time.Duration `json:"admission_p90_ns"`
+	AdmissionP99    time.Duration `json:"admission_p99_ns"`
+	AdmissionMax    time.Duration `json:"admission_max_ns"`
+	admissionDelays []time.Duration
+	runs            map[string]*burst
+}
+
+type burst struct {
+	length int64
+	start  time.Time
+	last   time.Time
+}
+
+func newReport(policy string) *Report {
+	return &Report{
+		Policy:  policy,
+		Tenants: make(map[string]*Counts),
+		runs:    make(map[string]*burst),
+	}
+}
+
+// DenialRate is the share of requests denied on their first attempt.
+func (r *Report) DenialRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Denied) / float64(r.Requests)
+}
+
+func (r *Report) observe(req Request, allowed bool) {
+	tc, ok := r.Tenants[req.Tenant]
+	if !ok {
+		tc = &Counts{}
+		r.Tenants[req.Tenant] = tc
+	}
+	r.Requests++
+	tc.Requests++
+
+	key := req.LimiterKey()
+	if allowed {
+		r.Allowed++
+		tc.Allowed++
+		r.closeRun(key)
+		return
+	}
+	r.Denied++
+	tc.Denied++
+
+	run, ok := r.runs[key]
+	if !ok {
+		run = &burst{start: req.Timestamp}
+		r.runs[key] = run
+	}
+	run.length++
+	run.last = req.Timestamp
+}
+
+func (r *Report) closeRun(key string) {
+	run, ok := r.runs[key]
+	if !ok {
+		return
+	}
+	delete(r.runs, key)
+	r.Bursts++
+	if run.length > r.MaxBurst {
+		r.MaxBurst = run.length
+	}
+	if d := run.last.Sub(run.start); d > r.LongestBurst {
+		r.LongestBurst = d
+	}
+}
+
+func (r *Report) admit(delay time.Duration) {
+	r.admissionDelays = append(r.admissionDelays, delay)
+}
+
+func (r *Report) finish() {
+	for key := range r.runs {
+		r.closeRun(key)
+	}
+
+	d := r.admissionDelays
+	if len(d) == 0 {
+		return
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	r.AdmissionP50 = percentile(d, 0.50)
+	r.AdmissionP90 = percentile(d, 0.90)
+	r.AdmissionP99 = percentile(d, 0.99)
+	r.AdmissionMax = d[len(d)-1]
+}
+
+// percentile uses the nearest-rank method on sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
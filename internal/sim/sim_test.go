@@ -0,0 +1,105 @@
+package sim
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testTrace is out of timestamp order on purpose. Tenant a's key gets a
+// burst of four, which a bucket of two tokens refilling one per second
+// admits half of, then one more denial half a second later.
+func testTrace() []Request {
+	t0 := time.Unix(1700000000, 0)
+	at := func(d time.Duration) time.Time { return t0.Add(d) }
+	return []Request{
+		newRequest(at(10*time.Second), "a", "api", "k", 1),
+		newRequest(at(0), "a", "api", "k", 1),
+		newRequest(at(500*time.Millisecond), "b", "api", "k", 1),
+		newRequest(at(0), "a", "api", "k", 1),
+		newRequest(at(500*time.Millisecond), "a", "api", "k", 1),
+		newRequest(at(0), "a", "api", "k", 1),
+		newRequest(at(0), "a", "api", "k", 1),
+	}
+}
+
+func TestRunReplaysTrace(t *testing.T) {
+	p, err := ParsePolicy("token_bucket,limit=60,burst=2,window=1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want Report
+	}{
+		{
+			name: "no retries",
+			want: Report{
+				Counts:       Counts{Requests: 7, Allowed: 4, Denied: 3},
+				Bursts:       1,
+				MaxBurst:     3,
+				LongestBurst: 500 * time.Millisecond,
+				Dropped:      3,
+			},
+		},
+		{
+			// The three denied requests come back at each reset: one at 1s,
+			// one at 2s and the last, from 0.5s, at 3s.
+			name: "retries",
+			opts: Options{Retry: true, MaxWait: 2500 * time.Millisecond},
+			want: Report{
+				Counts:       Counts{Requests: 7, Allowed: 4, Denied: 3},
+				Bursts:       1,
+				MaxBurst:     3,
+				LongestBurst: 500 * time.Millisecond,
+				Retries:      6,
+				AdmissionP90: 2500 * time.Millisecond,
+				AdmissionP99: 2500 * time.Millisecond,
+				AdmissionMax: 2500 * time.Millisecond,
+			},
+		},
+		{
+			// The request from 0.5s would have to wait 2.5s for its turn.
+			name: "retries within 2s",
+			opts: Options{Retry: true, MaxWait: 2 * time.Second},
+			want: Report{
+				Counts:       Counts{Requests: 7, Allowed: 4, Denied: 3},
+				Bursts:       1,
+				MaxBurst:     3,
+				LongestBurst: 500 * time.Millisecond,
+				Retries:      5,
+				Dropped:      1,
+				AdmissionP90: 2 * time.Second,
+				AdmissionP99: 2 * time.Second,
+				AdmissionMax: 2 * time.Second,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Run(context.Background(), testTrace(), p, tc.opts)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+
+			g := *got
+			g.Policy, g.Tenants, g.admissionDelays, g.runs = "", nil, nil, nil
+			if !reflect.DeepEqual(g, tc.want) {
+				t.Errorf("report = %+v\nwant %+v", g, tc.want)
+			}
+			if a, b := got.Tenants["a"], got.Tenants["b"]; *a != (Counts{6, 3, 3}) || *b != (Counts{1, 1, 0}) {
+				t.Errorf("tenants a = %+v, b = %+v, want {6 3 3} and {1 1 0}", *a, *b)
+			}
+
+			again, err := Run(context.Background(), testTrace(), p, tc.opts)
+			if err != nil {
+				t.Fatalf("second run: %v", err)
+			}
+			if !reflect.DeepEqual(got, again) {
+				t.Errorf("replaying the same trace gave a different report:\n%+v\n%+v", got, again)
+			}
+		})
+	}
+}
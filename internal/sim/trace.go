@@ -0,0 +1,166 @@
+package sim
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request is one line of a trace.
+type Request struct {
+	Timestamp time.Time
+	Tenant    string
+	Resource  string
+	Key       string
+	Cost      int64
+}
+
+// LimiterKey is the key the gateway rate limits this request under.
+func (r Request) LimiterKey() string {
+	return fmt.Sprintf("%s:%s:%s", r.Tenant, r.Resource, r.Key)
+}
+
+// ReadTrace parses a "csv" or "jsonl" trace and returns it ordered by
+// timestamp. CSV files need a header naming the columns timestamp, tenant,
+// resource, key and cost; resource, key and cost are optional. Timestamps
+// are RFC 3339 or Unix seconds, fractions allowed.
+func ReadTrace(r io.Reader, format string) ([]Request, error) {
+	var (
+		reqs []Request
+		err  error
+	)
+	switch format {
+	case "csv":
+		reqs, err = readCSV(r)
+	case "jsonl", "json":
+		reqs, err = readJSONL(r)
+	default:
+		return nil, fmt.Errorf("unknown trace format %q (want csv or jsonl)", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(reqs, func(i, j int) bool {
+		return reqs[i].Timestamp.Before(reqs[j].Timestamp)
+	})
+	return reqs, nil
+}
+
+func readCSV(r io.Reader) ([]Request, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"timestamp", "tenant"} {
+		if _, ok := cols[required]; !ok {
+			return nil, fmt.Errorf("csv header is missing %q", required)
+		}
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var reqs []Request
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return reqs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+
+		ts, err := parseTimestamp(field(rec, "timestamp"))
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		cost := int64(1)
+		if s := field(rec, "cost"); s != "" {
+			if cost, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return nil, fmt.Errorf("csv line %d: invalid cost %q", line, s)
+			}
+		}
+		reqs = append(reqs, newRequest(ts, field(rec, "tenant"), field(rec, "resource"), field(rec, "key"), cost))
+	}
+}
+
+type jsonRequest struct {
+	Timestamp json.RawMessage `json:"timestamp"`
+	Tenant    string          `json:"tenant"`
+	Resource  string          `json:"resource"`
+	Key       string          `json:"key"`
+	Cost      *int64          `json:"cost"`
+}
+
+func readJSONL(r io.Reader) ([]Request, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var reqs []Request
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var jr jsonRequest
+		if err := json.Unmarshal([]byte(text), &jr); err != nil {
+			return nil, fmt.Errorf("jsonl line %d: %w", line, err)
+		}
+		ts, err := parseTimestamp(strings.Trim(string(jr.Timestamp), `"`))
+		if err != nil {
+			return nil, fmt.Errorf("jsonl line %d: %w", line, err)
+		}
+		cost := int64(1)
+		if jr.Cost != nil {
+			cost = *jr.Cost
+		}
+		reqs = append(reqs, newRequest(ts, jr.Tenant, jr.Resource, jr.Key, cost))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read jsonl: %w", err)
+	}
+	return reqs, nil
+}
+
+// newRequest applies the same defaults as the gateway's /allow handler.
+func newRequest(ts time.Time, tenant, resource, key string, cost int64) Request {
+	if resource == "" {
+		resource = "default"
+	}
+	return Request{Timestamp: ts, Tenant: tenant, Resource: resource, Key: key, Cost: cost}
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.New("missing timestamp")
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		whole, frac := math.Modf(secs)
+		return time.Unix(int64(whole), int64(math.Round(frac*1e9))).UTC(), nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q: want RFC 3339 or Unix seconds", s)
+	}
+	return ts, nil
+}
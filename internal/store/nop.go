@@ -1,15 +1,61 @@
+//go:build !full
+// +build !full
+
 package store
 
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+	"github.com/xizzxy/helios/internal/config"
+	"github.com/xizzxy/helios/internal/resilience"
+)
+
 // Nop (stub) store used in FAST mode when Redis is not compiled in.
 
+// ErrUnavailable is returned by every store operation in builds without the
+// "full" tag.
+var ErrUnavailable = errors.New("redis store not compiled in (build with -tags full)")
+
 type Client struct{}
 
-func NewClientFromEnv() (*Client, error) { return &Client{}, nil }
-func (c *Client) Close() error           { return nil }
+func NewClientFromEnv() (*Client, error)                { return &Client{}, nil }
+func NewClient(cfg config.RedisConfig) (*Client, error) { return &Client{}, nil }
+func (c *Client) Close() error                          { return nil }
+func (c *Client) SetClock(clk clock.Clock)              {}
+func (c *Client) SetObserver(o Observer)                {}
+
+func (c *Client) SetRetryPolicy(p *resilience.RetryPolicy, o RetryObserver) {}
 
 // Compatibility types/aliases
 type Stats map[string]any
 
 func (c *Client) Stats() Stats    { return Stats{"mode": "nop"} }
 func (c *Client) GetStats() Stats { return c.Stats() }
-func (c *Client) Ping() error     { return nil }
+func (c *Client) Ping() error     { return ErrUnavailable }
+
+func (c *Client) TokenBucketAllow(ctx context.Context, key string, limit, windowSec int64, cost int, burst, reserve int64) (bool, int64, time.Time, error) {
+	return false, 0, time.Time{}, ErrUnavailable
+}
+
+func (c *Client) SlidingWindowAllow(ctx context.Context, key string, limit, windowSec int64, cost int, reserve int64) (bool, int64, time.Time, error) {
+	return false, 0, time.Time{}, ErrUnavailable
+}
+
+func (c *Client) SlidingWindowReturn(ctx context.Context, key string, cost int64) error {
+	return ErrUnavailable
+}
+
+func (c *Client) SyncWindowCounters(ctx context.Context, keys []string, deltas []int64, ttl time.Duration, instance string, staleAfter time.Duration) ([]int64, int64, error) {
+	return nil, 0, ErrUnavailable
+}
+
+func (c *Client) LeaseTokens(ctx context.Context, key string, limit, windowSec, burst, want, minGrant int64, maxFraction float64) (int64, int64, time.Time, error) {
+	return 0, 0, time.Time{}, ErrUnavailable
+}
+
+func (c *Client) ReturnTokens(ctx context.Context, key string, tokens, burst int64) error {
+	return ErrUnavailable
+}
@@ -0,0 +1,11 @@
+package store
+
+import "time"
+
+// Observer is told about every script the client runs: its name, how long
+// the round trip took and the error, if any.
+type Observer func(script string, d time.Duration, err error)
+
+// RetryObserver is told each time the client sends a script again after a
+// transient failure.
+type RetryObserver func(script string)
@@ -5,37 +5,182 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"strconv"
+	"io"
+	"net"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xizzxy/helios/internal/clock"
+	"github.com/xizzxy/helios/internal/config"
+	"github.com/xizzxy/helios/internal/resilience"
+	"github.com/xizzxy/helios/internal/tracing"
 )
 
+var tracer = tracing.Tracer("github.com/xizzxy/helios/internal/store")
+
 type Client struct {
-	redis *redis.Client
+	redis   *redis.Client
+	clock   clock.Clock
+	observe Observer
+	retry   *resilience.RetryPolicy
+	retried RetryObserver
 }
 
+// NewClientFromEnv builds a client from the HELIOS_REDIS_* environment.
 func NewClientFromEnv() (*Client, error) {
-	addr := getEnv("HELIOS_REDIS_ADDRESS", "localhost:6379")
-	password := getEnv("HELIOS_REDIS_PASSWORD", "")
-	db := getEnvInt("HELIOS_REDIS_DATABASE", 0)
+	return NewClient(config.LoadConfig().Redis)
+}
+
+// NewClient connects to Redis using ACL credentials and, when enabled, TLS.
+func NewClient(cfg config.RedisConfig) (*Client, error) {
+	tlsCfg, err := cfg.TLS.ClientTLS()
+	if err != nil {
+		return nil, fmt.Errorf("redis tls: %w", err)
+	}
 
 	client := redis.NewClient(&redis.Options{
-		Addr:         addr,
-		Password:     password,
-		DB:           db,
-		PoolSize:     getEnvInt("HELIOS_REDIS_POOL_SIZE", 100),
-		MinIdleConns: getEnvInt("HELIOS_REDIS_MIN_IDLE_CONNS", 10),
-		MaxRetries:   getEnvInt("HELIOS_REDIS_MAX_RETRIES", 3),
-		DialTimeout:  getEnvDuration("HELIOS_REDIS_DIAL_TIMEOUT", 5*time.Second),
-		ReadTimeout:  getEnvDuration("HELIOS_REDIS_READ_TIMEOUT", 3*time.Second),
-		WriteTimeout: getEnvDuration("HELIOS_REDIS_WRITE_TIMEOUT", 3*time.Second),
+		Addr:         cfg.Address,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           cfg.Database,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		MaxRetries:   cfg.MaxRetries,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		TLSConfig:    tlsCfg,
 	})
 
-	return &Client{redis: client}, nil
+	return &Client{redis: client, clock: clock.Real}, nil
+}
+
+// SetClock replaces the clock whose time is passed to the Lua scripts.
+// Scripts never read Redis server time, so a manual clock makes the store
+// fully deterministic.
+func (c *Client) SetClock(clk clock.Clock) {
+	c.clock = clock.Or(clk)
+}
+
+// SetObserver registers o to time every script call. It must be called
+// before the client is shared.
+func (c *Client) SetObserver(o Observer) {
+	c.observe = o
+}
+
+// SetRetryPolicy makes the client retry failed scripts under p, telling o
+// about each retry. go-redis should then be built with its own retries
+// off, since it resends any command after a dropped connection. It must
+// be called before the client is shared.
+func (c *Client) SetRetryPolicy(p *resilience.RetryPolicy, o RetryObserver) {
+	c.retry, c.retried = p, o
+}
+
+// eval runs a script in its own span and reports each attempt to the
+// observer under name. Failures are retried as far as safety allows: any
+// transient error for Idempotent scripts, only errors proving the script
+// never reached Redis for RetryIfUnsent ones.
+func (c *Client) eval(ctx context.Context, name string, safety resilience.Retryability, script string, keys []string, args ...interface{}) *redis.Cmd {
+	ctx, span := tracer.Start(ctx, "redis."+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation", "EVAL"),
+		attribute.String("helios.script", name),
+	))
+	defer span.End()
+
+	retryable := unsent
+	switch safety {
+	case resilience.NotRetryable:
+		retryable = func(error) bool { return false }
+	case resilience.Idempotent:
+		retryable = transient
+	}
+	attempts := 1
+	onRetry := func() {
+		attempts++
+		if c.retried != nil {
+			c.retried(name)
+		}
+	}
+
+	var cmd *redis.Cmd
+	err := c.retry.Do(ctx, retryable, onRetry, func() error {
+		start := time.Now()
+		cmd = c.redis.Eval(ctx, script, keys, args...)
+		err := cmd.Err()
+		if err == redis.Nil {
+			err = nil
+		}
+		if c.observe != nil {
+			c.observe(name, time.Since(start), err)
+		}
+		return err
+	})
+	span.SetAttributes(attribute.Int("helios.attempts", attempts))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return cmd
+}
+
+// unsent reports whether err proves the command never ran: the connection
+// could not be made, no pooled connection freed up in time, or Redis
+// refused the command before executing it.
+func unsent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	// go-redis keeps its pool errors in an internal package.
+	if err.Error() == "redis: connection pool timeout" {
+		return true
+	}
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		msg := redisErr.Error()
+		for _, prefix := range []string{"LOADING ", "MASTERDOWN ", "TRYAGAIN ", "CLUSTERDOWN "} {
+			if strings.HasPrefix(msg, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// transient reports whether an idempotent call that failed with err is
+// worth sending again. After a timeout or a dropped connection the first
+// attempt may or may not have run.
+func transient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if unsent(err) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// mutating is the retryability of a script that changes state when it
+// consumes amount, and only refreshes idempotent state otherwise.
+func mutating(amount int64) resilience.Retryability {
+	if amount == 0 {
+		return resilience.Idempotent
+	}
+	return resilience.RetryIfUnsent
 }
 
 func (c *Client) Ping() error {
@@ -78,8 +223,10 @@ func (c *Client) GetStats(ctx context.Context) (map[string]any, error) {
 	return c.Stats(), nil
 }
 
-// TokenBucketAllow implements atomic token bucket using Redis Lua script
-func (c *Client) TokenBucketAllow(ctx context.Context, key string, limit, windowSec int64, cost int, burst int64) (bool, int64, time.Time, error) {
+// TokenBucketAllow implements atomic token bucket using Redis Lua script.
+// The call is denied unless reserve tokens are left after it, and the
+// remaining count excludes them.
+func (c *Client) TokenBucketAllow(ctx context.Context, key string, limit, windowSec int64, cost int, burst, reserve int64) (bool, int64, time.Time, error) {
 	// Lua script for atomic token bucket operations
 	script := `
 		local key = KEYS[1]
@@ -88,6 +235,7 @@ func (c *Client) TokenBucketAllow(ctx context.Context, key string, limit, window
 		local window = tonumber(ARGV[3])
 		local cost = tonumber(ARGV[4])
 		local burst = tonumber(ARGV[5])
+		local reserve = tonumber(ARGV[6]) or 0
 		
 		-- Get current bucket state
 		local bucket = redis.call('HMGET', key, 'tokens', 'last_refill')
@@ -95,34 +243,39 @@ func (c *Client) TokenBucketAllow(ctx context.Context, key string, limit, window
 		local last_refill = tonumber(bucket[2]) or now
 		
 		-- Calculate tokens to add
-		local elapsed = (now - last_refill) / 1000.0
-		local tokens_to_add = elapsed * limit / window
-		tokens = math.min(tokens + tokens_to_add, burst)
+		local refill_per_ms = limit / (window * 1000.0)
+		local elapsed = math.max(0, now - last_refill)
+		tokens = math.min(tokens + elapsed * refill_per_ms, burst)
 		
 		-- Check if we can allow the request
-		if tokens >= cost then
+		local allowed = 0
+		if tokens >= cost + reserve then
+			allowed = 1
 			tokens = tokens - cost
-			
-			-- Update bucket state
-			redis.call('HMSET', key, 'tokens', tokens, 'last_refill', now)
-			redis.call('EXPIRE', key, window * 2)
-			
-			return {1, tokens, now + (window * 1000)}
-		else
-			-- Update last refill time even if request is denied
-			redis.call('HMSET', key, 'tokens', tokens, 'last_refill', now)
-			redis.call('EXPIRE', key, window * 2)
-			
-			-- Calculate retry after
-			local tokens_needed = cost - tokens
-			local retry_after = math.ceil(tokens_needed * window / limit)
-			
-			return {0, tokens, now + (retry_after * 1000)}
 		end
+		
+		-- Update bucket state; an expired key is indistinguishable from
+		-- a full bucket, so keep it until it would have refilled.
+		redis.call('HMSET', key, 'tokens', tokens, 'last_refill', now)
+		redis.call('PEXPIRE', key, math.ceil((burst - tokens) / refill_per_ms) + 1000)
+		
+		-- Reset is when the bucket is full again or, for a denial, when
+		-- cost tokens are available above the reserve. A cost above
+		-- burst never fits.
+		local want = burst
+		if allowed == 0 and cost + reserve <= burst then
+			want = cost + reserve
+		end
+		local reset = now
+		if tokens < want then
+			reset = now + math.floor((want - tokens) / refill_per_ms + 0.5)
+		end
+		
+		return {allowed, math.max(math.floor(tokens) - reserve, 0), reset}
 	`
 
-	now := time.Now().UnixMilli()
-	result, err := c.redis.Eval(ctx, script, []string{key}, now, limit, windowSec, cost, burst).Result()
+	now := c.clock.Now().UnixMilli()
+	result, err := c.eval(ctx, "token_bucket", mutating(int64(cost)), script, []string{key}, now, limit, windowSec, cost, burst, reserve).Result()
 	if err != nil {
 		return false, 0, time.Time{}, fmt.Errorf("redis token bucket eval: %w", err)
 	}
@@ -136,8 +289,10 @@ func (c *Client) TokenBucketAllow(ctx context.Context, key string, limit, window
 	return allowed, remaining, resetTime, nil
 }
 
-// SlidingWindowAllow implements atomic sliding window using Redis Lua script
-func (c *Client) SlidingWindowAllow(ctx context.Context, key string, limit, windowSec int64, cost int) (bool, int64, time.Time, error) {
+// SlidingWindowAllow implements atomic sliding window using Redis Lua
+// script. The call is denied unless reserve requests are still free in the
+// window after it, and the remaining count excludes them.
+func (c *Client) SlidingWindowAllow(ctx context.Context, key string, limit, windowSec int64, cost int, reserve int64) (bool, int64, time.Time, error) {
 	// Lua script for atomic sliding window operations
 	script := `
 		local key = KEYS[1]
@@ -145,6 +300,8 @@ func (c *Client) SlidingWindowAllow(ctx context.Context, key string, limit, wind
 		local limit = tonumber(ARGV[2])
 		local window = tonumber(ARGV[3])
 		local cost = tonumber(ARGV[4])
+		local reserve = tonumber(ARGV[5]) or 0
+		local seq_key = KEYS[2]
 		
 		-- Remove expired entries
 		local window_start = now - (window * 1000)
@@ -154,33 +311,51 @@ func (c *Client) SlidingWindowAllow(ctx context.Context, key string, limit, wind
 		local current_count = redis.call('ZCARD', key)
 		
 		-- Check if we can allow the request
-		if current_count + cost <= limit then
-			-- Add entries for the cost
-			for i = 1, cost do
-				redis.call('ZADD', key, now, now .. ':' .. i)
+		if current_count + cost + reserve <= limit then
+			-- Add entries for the cost; members come from a counter so
+			-- requests in the same millisecond stay distinct
+			if cost > 0 then
+				local seq = redis.call('INCRBY', seq_key, cost)
+				for i = 1, cost do
+					redis.call('ZADD', key, now, seq - cost + i)
+				end
+				redis.call('PEXPIRE', seq_key, window * 1000)
 			end
 			
 			-- Set expiration
 			redis.call('EXPIRE', key, window)
 			
-			local remaining = limit - current_count - cost
-			return {1, remaining, now + (window * 1000)}
-		else
-			-- Calculate next available time
-			local oldest_score = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
-			local retry_time = now + (window * 1000)
+			-- The window is empty again once the newest request expires
+			local reset = now
+			local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+			if #newest > 0 then
+				reset = tonumber(newest[2]) + (window * 1000)
+			end
 			
-			if #oldest_score > 0 then
-				retry_time = oldest_score[2] + (window * 1000)
+			local remaining = limit - current_count - cost - reserve
+			return {1, remaining, reset}
+		else
+			-- Next available time: once enough of the oldest entries have
+			-- expired to fit cost above the reserve, or the window is empty
+			-- if that never fits
+			local need = cost + reserve
+			local index = -1
+			if need <= limit then
+				index = current_count + need - limit - 1
+			end
+			local reset = now
+			local entry = redis.call('ZRANGE', key, index, index, 'WITHSCORES')
+			if #entry > 0 then
+				reset = tonumber(entry[2]) + (window * 1000)
 			end
 			
-			local remaining = math.max(0, limit - current_count)
-			return {0, remaining, retry_time}
+			local remaining = math.max(0, limit - current_count - reserve)
+			return {0, remaining, reset}
 		end
 	`
 
-	now := time.Now().UnixMilli()
-	result, err := c.redis.Eval(ctx, script, []string{key}, now, limit, windowSec, cost).Result()
+	now := c.clock.Now().UnixMilli()
+	result, err := c.eval(ctx, "sliding_window", mutating(int64(cost)), script, []string{key, key + ":seq"}, now, limit, windowSec, cost, reserve).Result()
 	if err != nil {
 		return false, 0, time.Time{}, fmt.Errorf("redis sliding window eval: %w", err)
 	}
@@ -194,29 +369,136 @@ func (c *Client) SlidingWindowAllow(ctx context.Context, key string, limit, wind
 	return allowed, remaining, resetTime, nil
 }
 
-// Helper functions for environment variable parsing
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// SlidingWindowReturn drops the newest cost requests from the window at
+// key, giving back what SlidingWindowAllow recorded for them.
+func (c *Client) SlidingWindowReturn(ctx context.Context, key string, cost int64) error {
+	script := `
+		local key = KEYS[1]
+		local cost = tonumber(ARGV[1])
+		
+		redis.call('ZPOPMAX', key, cost)
+		return 1
+	`
+
+	if err := c.eval(ctx, "sliding_window_return", resilience.RetryIfUnsent, script, []string{key}, cost).Err(); err != nil {
+		return fmt.Errorf("redis sliding window return eval: %w", err)
 	}
-	return defaultValue
+	return nil
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+// SyncWindowCounters adds deltas[i] to the shared per-window counter at
+// keys[i], all in one round trip, and registers the calling instance as a
+// live participant. It returns the counter totals in key order and the
+// number of instances seen within staleAfter.
+func (c *Client) SyncWindowCounters(ctx context.Context, keys []string, deltas []int64, ttl time.Duration, instance string, staleAfter time.Duration) ([]int64, int64, error) {
+	script := `
+		local members = KEYS[#KEYS]
+		local ttl = tonumber(ARGV[1])
+		local instance = ARGV[2]
+		local now = tonumber(ARGV[3])
+		local stale = tonumber(ARGV[4])
+		
+		local result = {}
+		for i = 1, #KEYS - 1 do
+			result[i] = redis.call('INCRBY', KEYS[i], tonumber(ARGV[4 + i]))
+			redis.call('PEXPIRE', KEYS[i], ttl)
+		end
+		
+		-- Track live instances so callers can split the error budget
+		redis.call('ZADD', members, now, instance)
+		redis.call('ZREMRANGEBYSCORE', members, 0, now - stale)
+		redis.call('PEXPIRE', members, stale * 2)
+		
+		result[#KEYS] = redis.call('ZCARD', members)
+		return result
+	`
+
+	now := c.clock.Now().UnixMilli()
+	args := []interface{}{ttl.Milliseconds(), instance, now, staleAfter.Milliseconds()}
+	var moved int64
+	for _, d := range deltas {
+		args = append(args, d)
+		if d != 0 {
+			moved = d
 		}
 	}
-	return defaultValue
+	result, err := c.eval(ctx, "sync_window", mutating(moved), script, append(keys[:len(keys):len(keys)], "helios:sync:instances"), args...).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("redis sync counter eval: %w", err)
+	}
+
+	res := result.([]interface{})
+	totals := make([]int64, len(keys))
+	for i := range totals {
+		totals[i] = res[i].(int64)
+	}
+	return totals, res[len(keys)].(int64), nil
 }
 
-func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
-		}
+// LeaseTokens refills the token bucket at key and hands out a block of up to
+// want tokens, capped at maxFraction of what is left. At least minGrant
+// tokens are granted when available so a single request can always proceed.
+// It uses the same hash layout as TokenBucketAllow.
+func (c *Client) LeaseTokens(ctx context.Context, key string, limit, windowSec, burst, want, minGrant int64, maxFraction float64) (int64, int64, time.Time, error) {
+	script := `
+		local key = KEYS[1]
+		local now = tonumber(ARGV[1])
+		local limit = tonumber(ARGV[2])
+		local window = tonumber(ARGV[3])
+		local burst = tonumber(ARGV[4])
+		local want = tonumber(ARGV[5])
+		local min_grant = tonumber(ARGV[6])
+		local max_fraction = tonumber(ARGV[7])
+		
+		local bucket = redis.call('HMGET', key, 'tokens', 'last_refill')
+		local tokens = tonumber(bucket[1]) or burst
+		local last_refill = tonumber(bucket[2]) or now
+		
+		local elapsed = (now - last_refill) / 1000.0
+		tokens = math.min(tokens + elapsed * limit / window, burst)
+		
+		local grant = math.min(want, math.floor(tokens * max_fraction))
+		grant = math.max(grant, min_grant)
+		if grant > tokens then
+			grant = 0
+		end
+		tokens = tokens - grant
+		
+		redis.call('HMSET', key, 'tokens', tokens, 'last_refill', now)
+		redis.call('EXPIRE', key, window * 2)
+		
+		local refill_ms = math.ceil((burst - tokens) * window * 1000 / limit)
+		return {grant, math.floor(tokens), now + refill_ms}
+	`
+
+	now := c.clock.Now().UnixMilli()
+	result, err := c.eval(ctx, "lease_tokens", resilience.RetryIfUnsent, script, []string{key}, now, limit, windowSec, burst, want, minGrant, maxFraction).Result()
+	if err != nil {
+		return 0, 0, time.Time{}, fmt.Errorf("redis lease eval: %w", err)
 	}
-	return defaultValue
+
+	res := result.([]interface{})
+	return res[0].(int64), res[1].(int64), time.UnixMilli(res[2].(int64)), nil
 }
 
+// ReturnTokens gives tokens back to the bucket at key, up to burst: unused
+// leased tokens, or the cost of a refunded call.
+func (c *Client) ReturnTokens(ctx context.Context, key string, tokens, burst int64) error {
+	script := `
+		local key = KEYS[1]
+		local tokens = tonumber(ARGV[1])
+		local burst = tonumber(ARGV[2])
+		
+		local current = tonumber(redis.call('HGET', key, 'tokens'))
+		if current == nil then
+			return 0
+		end
+		redis.call('HSET', key, 'tokens', math.min(current + tokens, burst))
+		return 1
+	`
+
+	if err := c.eval(ctx, "return_tokens", resilience.RetryIfUnsent, script, []string{key}, tokens, burst).Err(); err != nil {
+		return fmt.Errorf("redis lease return eval: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build full
+// +build full
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestRetryClassification(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	read := &net.OpError{Op: "read", Net: "tcp", Err: timeoutErr{}}
+
+	tests := []struct {
+		name              string
+		err               error
+		unsent, transient bool
+	}{
+		{"dial refused", dial, true, true},
+		{"wrapped dial", fmt.Errorf("redis: %w", dial), true, true},
+		{"pool timeout", errors.New("redis: connection pool timeout"), true, true},
+		{"loading", redisError("LOADING Redis is loading the dataset in memory"), true, true},
+		{"read timeout", read, false, true},
+		{"connection reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, false, true},
+		{"eof", io.EOF, false, true},
+		{"script error", redisError("ERR Error running script"), false, false},
+		{"deadline", context.DeadlineExceeded, false, false},
+		{"closed", redis.ErrClosed, false, false},
+	}
+	for _, tt := range tests {
+		if got := unsent(tt.err); got != tt.unsent {
+			t.Errorf("%s: unsent = %v, want %v", tt.name, got, tt.unsent)
+		}
+		if got := transient(tt.err); got != tt.transient {
+			t.Errorf("%s: transient = %v, want %v", tt.name, got, tt.transient)
+		}
+	}
+}
+
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+func (redisError) RedisError()     {}
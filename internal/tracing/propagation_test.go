@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+	return rec
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	rec := recordSpans(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	var inner trace.SpanContext
+	router.GET("/allow/:tenant", func(c *gin.Context) {
+		inner = trace.SpanContextFromContext(c.Request.Context())
+		c.Status(http.StatusTooManyRequests)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/allow/acme", nil)
+	req.Header.Set("traceparent", traceparent)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /allow/:tenant" {
+		t.Errorf("span name = %q, want the route pattern", span.Name())
+	}
+	if got := span.Parent().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("parent trace ID = %s, want the caller's", got)
+	}
+	if inner.SpanID() != span.SpanContext().SpanID() {
+		t.Error("handler context does not carry the server span")
+	}
+}
+
+func TestGRPCInterceptorsPropagate(t *testing.T) {
+	rec := recordSpans(t)
+
+	// The client injects into outgoing metadata; hand it to the server as
+	// incoming metadata, as the transport would.
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	err := UnaryClientInterceptor()(context.Background(), "/helios.cluster.v1.Peer/Allow", nil, nil, nil, invoker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent.Get("traceparent")) == 0 {
+		t.Fatal("client did not inject traceparent")
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), sent)
+	info := &grpc.UnaryServerInfo{FullMethod: "/helios.cluster.v1.Peer/Allow"}
+	_, err = UnaryServerInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	client, server := spans[0], spans[1]
+	if server.Parent().SpanID() != client.SpanContext().SpanID() {
+		t.Error("server span is not a child of the client span")
+	}
+}
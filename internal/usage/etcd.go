@@ -0,0 +1,122 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Prefix holds usage records as
+// Prefix<tenant>/<granularity>/<bucket start, unix seconds>/<writer>.
+const Prefix = "/helios/usage/"
+
+// maxTxnOps is etcd's default limit on operations per transaction.
+const maxTxnOps = 128
+
+// Retention is how long each granularity is kept.
+type Retention map[Granularity]time.Duration
+
+// EtcdStore keeps usage in etcd. Records expire through leases that are
+// renewed by granting a new one every tenth of the retention, so a record
+// lives between 90% and 100% of its retention.
+type EtcdStore struct {
+	client    *clientv3.Client
+	retention Retention
+
+	mu     sync.Mutex
+	leases map[Granularity]lease
+}
+
+type lease struct {
+	id      clientv3.LeaseID
+	granted time.Time
+}
+
+func NewEtcdStore(client *clientv3.Client, retention Retention) *EtcdStore {
+	return &EtcdStore{client: client, retention: retention, leases: make(map[Granularity]lease)}
+}
+
+func bucketPrefix(tenant string, g Granularity) string {
+	return Prefix + tenant + "/" + string(g) + "/"
+}
+
+// bucketKey pads the start so that keys sort by time.
+func bucketKey(tenant string, g Granularity, start time.Time) string {
+	return fmt.Sprintf("%s%011d/", bucketPrefix(tenant, g), start.Unix())
+}
+
+// Put writes every bucket in as few round trips as etcd allows, one
+// transaction per maxTxnOps keys.
+func (s *EtcdStore) Put(ctx context.Context, writer string, buckets []Bucket) error {
+	ops := make([]clientv3.Op, 0, len(buckets))
+	for _, b := range buckets {
+		data, err := json.Marshal(b.Rows)
+		if err != nil {
+			return err
+		}
+		var opts []clientv3.OpOption
+		if ttl := s.retention[b.Granularity]; ttl > 0 {
+			id, err := s.lease(ctx, b.Granularity, ttl)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, clientv3.WithLease(id))
+		}
+		ops = append(ops, clientv3.OpPut(bucketKey(b.Tenant, b.Granularity, b.Start)+writer, string(data), opts...))
+	}
+	for len(ops) > 0 {
+		n := min(len(ops), maxTxnOps)
+		if _, err := s.client.Txn(ctx).Then(ops[:n]...).Commit(); err != nil {
+			return err
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
+
+func (s *EtcdStore) lease(ctx context.Context, g Granularity, ttl time.Duration) (clientv3.LeaseID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.leases[g]; ok && time.Since(l.granted) < ttl/10 {
+		return l.id, nil
+	}
+	resp, err := s.client.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("grant usage lease: %w", err)
+	}
+	s.leases[g] = lease{id: resp.ID, granted: time.Now()}
+	return resp.ID, nil
+}
+
+func (s *EtcdStore) Query(ctx context.Context, tenant string, g Granularity, from, to time.Time) ([]Bucket, error) {
+	resp, err := s.client.Get(ctx, bucketKey(tenant, g, g.Start(from)),
+		clientv3.WithRange(bucketKey(tenant, g, to)))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := bucketPrefix(tenant, g)
+	buckets := make([]Bucket, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		start, _, ok := strings.Cut(strings.TrimPrefix(string(kv.Key), prefix), "/")
+		if !ok {
+			continue
+		}
+		sec, err := strconv.ParseInt(start, 10, 64)
+		if err != nil {
+			continue
+		}
+		b := Bucket{Tenant: tenant, Granularity: g, Start: time.Unix(sec, 0).UTC()}
+		if err := json.Unmarshal(kv.Value, &b.Rows); err != nil {
+			return nil, fmt.Errorf("parse usage record %s: %w", kv.Key, err)
+		}
+		buckets = append(buckets, b)
+	}
+	return Merge(buckets), nil
+}
@@ -0,0 +1,287 @@
+// Package usage meters consumption for billing. Gateways add up consumed
+// and denied cost per tenant, resource and API key into minute, hour and
+// day buckets. They periodically write their running totals to a store,
+// where the control plane sums the totals of every writer when it reports
+// usage.
+package usage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+)
+
+// Granularity is the width of a usage bucket.
+type Granularity string
+
+const (
+	Minute Granularity = "minute"
+	Hour   Granularity = "hour"
+	Day    Granularity = "day"
+)
+
+// Granularities lists every bucket width a gateway records and stores.
+var Granularities = []Granularity{Minute, Hour, Day}
+
+// ParseGranularity accepts "minute", "hour" or "day".
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case Minute, Hour, Day:
+		return g, nil
+	}
+	return "", fmt.Errorf("unknown granularity %q (want minute, hour or day)", s)
+}
+
+func (g Granularity) Duration() time.Duration {
+	switch g {
+	case Minute:
+		return time.Minute
+	case Hour:
+		return time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// Start returns the start of the bucket holding t. Day buckets start at
+// midnight UTC.
+func (g Granularity) Start(t time.Time) time.Time {
+	return t.UTC().Truncate(g.Duration())
+}
+
+// Row is the usage of one API key on one resource within a bucket.
+type Row struct {
+	Resource string `json:"resource"`
+	Key      string `json:"key"`      // API key fingerprint, see Fingerprint
+	Consumed int64  `json:"consumed"` // cost of allowed requests
+	Denied   int64  `json:"denied"`   // cost of denied requests
+	Allowed  int64  `json:"allowed_requests"`
+	Rejected int64  `json:"denied_requests"`
+}
+
+func (r *Row) add(o Row) {
+	r.Consumed += o.Consumed
+	r.Denied += o.Denied
+	r.Allowed += o.Allowed
+	r.Rejected += o.Rejected
+}
+
+// Bucket holds a tenant's usage for one time bucket, sorted by resource
+// and key.
+type Bucket struct {
+	Tenant      string      `json:"tenant"`
+	Granularity Granularity `json:"granularity"`
+	Start       time.Time   `json:"start"`
+	Rows        []Row       `json:"rows"`
+}
+
+// Fingerprint identifies an API key in usage records without storing it.
+func Fingerprint(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Store persists usage buckets.
+type Store interface {
+	// Put replaces writer's running totals for each bucket.
+	Put(ctx context.Context, writer string, buckets []Bucket) error
+	// Query returns the tenant's buckets starting in [from, to), summed
+	// across writers and ordered by start.
+	Query(ctx context.Context, tenant string, g Granularity, from, to time.Time) ([]Bucket, error)
+}
+
+type bucketID struct {
+	tenant string
+	g      Granularity
+	start  time.Time
+}
+
+type rowID struct {
+	resource string
+	key      string
+}
+
+type bucketState struct {
+	rows  map[rowID]*Row
+	dirty bool
+}
+
+// Aggregator keeps the running totals of the open buckets in memory and
+// writes the changed ones to the store every flush interval, all in one
+// Put. Because it writes totals rather than increments, a failed write is
+// simply retried by the next flush.
+type Aggregator struct {
+	store  Store
+	writer string
+	clock  clock.Clock
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	buckets map[bucketID]*bucketState
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewAggregator starts an aggregator that flushes every interval. writer
+// must be unique to this process, so that restarts never overwrite the
+// totals of an earlier run.
+func NewAggregator(store Store, writer string, interval time.Duration, clk clock.Clock, logger *slog.Logger) *Aggregator {
+	a := &Aggregator{
+		store:   store,
+		writer:  writer,
+		clock:   clock.Or(clk),
+		logger:  logger,
+		buckets: make(map[bucketID]*bucketState),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go a.run(interval)
+	return a
+}
+
+// Record adds one decision to the current minute, hour and day buckets.
+func (a *Aggregator) Record(tenant, resource, key string, cost int64, allowed bool) {
+	now := a.clock.Now()
+	delta := Row{Denied: cost, Rejected: 1}
+	if allowed {
+		delta = Row{Consumed: cost, Allowed: 1}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, g := range Granularities {
+		id := bucketID{tenant: tenant, g: g, start: g.Start(now)}
+		b, ok := a.buckets[id]
+		if !ok {
+			b = &bucketState{rows: make(map[rowID]*Row)}
+			a.buckets[id] = b
+		}
+		r, ok := b.rows[rowID{resource, key}]
+		if !ok {
+			r = &Row{Resource: resource, Key: key}
+			b.rows[rowID{resource, key}] = r
+		}
+		r.add(delta)
+		b.dirty = true
+	}
+}
+
+func (a *Aggregator) run(interval time.Duration) {
+	defer close(a.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := a.Flush(ctx); err != nil {
+				a.logger.Warn("Usage flush failed; retrying next interval", "error", err)
+			}
+			cancel()
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// Flush writes every bucket that changed since the last flush and forgets
+// buckets that have closed and are fully written.
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	var pending []Bucket
+	for id, b := range a.buckets {
+		if !b.dirty {
+			continue
+		}
+		pending = append(pending, snapshot(id, b))
+		b.dirty = false
+	}
+	a.mu.Unlock()
+
+	var err error
+	if len(pending) > 0 {
+		err = a.store.Put(ctx, a.writer, pending)
+	}
+
+	now := a.clock.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		for _, b := range pending {
+			if st, ok := a.buckets[bucketID{b.Tenant, b.Granularity, b.Start}]; ok {
+				st.dirty = true
+			}
+		}
+	}
+	for id, b := range a.buckets {
+		// A minute of grace covers decisions that raced the bucket boundary.
+		if !b.dirty && id.start.Add(id.g.Duration()+time.Minute).Before(now) {
+			delete(a.buckets, id)
+		}
+	}
+	return err
+}
+
+func snapshot(id bucketID, b *bucketState) Bucket {
+	rows := make([]Row, 0, len(b.rows))
+	for _, r := range b.rows {
+		rows = append(rows, *r)
+	}
+	sortRows(rows)
+	return Bucket{Tenant: id.tenant, Granularity: id.g, Start: id.start, Rows: rows}
+}
+
+func sortRows(rows []Row) {
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Resource != rows[j].Resource {
+			return rows[i].Resource < rows[j].Resource
+		}
+		return rows[i].Key < rows[j].Key
+	})
+}
+
+// Merge sums buckets with the same start, as written by different gateways.
+func Merge(buckets []Bucket) []Bucket {
+	byStart := make(map[time.Time]map[rowID]*Row)
+	var out []Bucket
+	for _, b := range buckets {
+		rows, ok := byStart[b.Start]
+		if !ok {
+			rows = make(map[rowID]*Row)
+			byStart[b.Start] = rows
+			out = append(out, Bucket{Tenant: b.Tenant, Granularity: b.Granularity, Start: b.Start})
+		}
+		for _, r := range b.Rows {
+			id := rowID{r.Resource, r.Key}
+			if sum, ok := rows[id]; ok {
+				sum.add(r)
+			} else {
+				r := r
+				rows[id] = &r
+			}
+		}
+	}
+	for i := range out {
+		for _, r := range byStart[out[i].Start] {
+			out[i].Rows = append(out[i].Rows, *r)
+		}
+		sortRows(out[i].Rows)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// Close stops the periodic flush and writes what is left.
+func (a *Aggregator) Close(ctx context.Context) error {
+	close(a.stop)
+	<-a.done
+	return a.Flush(ctx)
+}
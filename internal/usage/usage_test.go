@@ -0,0 +1,142 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xizzxy/helios/internal/clock"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// memStore keeps the latest Put per writer and bucket.
+type memStore struct {
+	mu   sync.Mutex
+	fail bool
+	puts int
+	data map[string]map[bucketID]Bucket
+}
+
+func newMemStore() *memStore { return &memStore{data: make(map[string]map[bucketID]Bucket)} }
+
+func (m *memStore) Put(ctx context.Context, writer string, buckets []Bucket) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.puts++
+	if m.fail {
+		return errors.New("store down")
+	}
+	if m.data[writer] == nil {
+		m.data[writer] = make(map[bucketID]Bucket)
+	}
+	for _, b := range buckets {
+		m.data[writer][bucketID{b.Tenant, b.Granularity, b.Start}] = b
+	}
+	return nil
+}
+
+func (m *memStore) Query(ctx context.Context, tenant string, g Granularity, from, to time.Time) ([]Bucket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var all []Bucket
+	for _, buckets := range m.data {
+		for id, b := range buckets {
+			if id.tenant == tenant && id.g == g && !id.start.Before(g.Start(from)) && id.start.Before(to) {
+				all = append(all, b)
+			}
+		}
+	}
+	return Merge(all), nil
+}
+
+func TestAggregatorBuckets(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 59, 30, 0, time.UTC)
+	clk := clock.NewManual(start)
+	store := newMemStore()
+	a := NewAggregator(store, "gw-0", time.Hour, clk, discard)
+	defer a.Close(context.Background())
+
+	a.Record("acme", "search", "k1", 5, true)
+	a.Record("acme", "search", "k1", 2, false)
+	clk.Advance(time.Minute) // into the next hour
+	a.Record("acme", "search", "k1", 1, true)
+	if err := a.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.puts != 1 {
+		t.Errorf("flush took %d writes, want 1", store.puts)
+	}
+
+	ctx := context.Background()
+	minutes, _ := store.Query(ctx, "acme", Minute, start.Add(-time.Hour), start.Add(time.Hour))
+	if len(minutes) != 2 {
+		t.Fatalf("got %d minute buckets, want 2", len(minutes))
+	}
+	if r := minutes[0].Rows[0]; r.Consumed != 5 || r.Denied != 2 || r.Allowed != 1 || r.Rejected != 1 {
+		t.Errorf("first minute = %+v", r)
+	}
+	hours, _ := store.Query(ctx, "acme", Hour, start.Add(-time.Hour), start.Add(2*time.Hour))
+	if len(hours) != 2 || !hours[1].Start.Equal(time.Date(2026, 3, 2, 11, 0, 0, 0, time.UTC)) {
+		t.Fatalf("hours = %+v, want 10:00 and 11:00", hours)
+	}
+	days, _ := store.Query(ctx, "acme", Day, start.Add(-24*time.Hour), start.Add(24*time.Hour))
+	if len(days) != 1 || days[0].Rows[0].Consumed != 6 || days[0].Rows[0].Denied != 2 {
+		t.Errorf("days = %+v, want one bucket with 6 consumed and 2 denied", days)
+	}
+}
+
+func TestAggregatorRetriesFailedFlush(t *testing.T) {
+	clk := clock.NewManual(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+	store := newMemStore()
+	a := NewAggregator(store, "gw-0", time.Hour, clk, discard)
+	defer a.Close(context.Background())
+
+	a.Record("acme", "search", "k1", 3, true)
+	store.fail = true
+	if err := a.Flush(context.Background()); err == nil {
+		t.Fatal("expected flush error")
+	}
+	// The bucket has closed by the time the store recovers; it must still
+	// be written rather than forgotten.
+	clk.Advance(48 * time.Hour)
+	store.fail = false
+	if err := a.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := store.Query(context.Background(), "acme", Hour, time.Time{}, clk.Now())
+	if len(got) != 1 || got[0].Rows[0].Consumed != 3 {
+		t.Errorf("hour buckets = %+v, want the retried total", got)
+	}
+
+	a.mu.Lock()
+	open := len(a.buckets)
+	a.mu.Unlock()
+	if open != 0 {
+		t.Errorf("%d closed buckets still held after a successful flush", open)
+	}
+}
+
+func TestMergeSumsWriters(t *testing.T) {
+	start := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	merged := Merge([]Bucket{
+		{Tenant: "acme", Granularity: Day, Start: start, Rows: []Row{{Resource: "search", Key: "k1", Consumed: 4}}},
+		{Tenant: "acme", Granularity: Day, Start: start.Add(24 * time.Hour), Rows: []Row{{Resource: "search", Key: "k1", Consumed: 1}}},
+		{Tenant: "acme", Granularity: Day, Start: start, Rows: []Row{
+			{Resource: "search", Key: "k1", Consumed: 6, Denied: 1},
+			{Resource: "upload", Key: "k1", Consumed: 2},
+		}},
+	})
+	if len(merged) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(merged))
+	}
+	rows := merged[0].Rows
+	if len(rows) != 2 || rows[0].Consumed != 10 || rows[0].Denied != 1 || rows[1].Resource != "upload" {
+		t.Errorf("first day rows = %+v", rows)
+	}
+}